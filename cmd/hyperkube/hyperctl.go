@@ -0,0 +1,172 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"text/tabwriter"
+
+	"k8s.io/kubernetes/pkg/api"
+	"k8s.io/kubernetes/pkg/kubelet/hyper"
+	"k8s.io/kubernetes/pkg/kubelet/hyper/translate"
+	kuberuntime "k8s.io/kubernetes/pkg/runtime"
+	utilyaml "k8s.io/kubernetes/pkg/util/yaml"
+)
+
+// NewHyperctl creates a new hyperkube Server for debugging the hyper
+// runtime on a node: previewing the hyperd spec a pod manifest translates
+// into, listing the kube-managed hyper pods with their parsed metadata, and
+// dumping spec checkpoints.
+func NewHyperctl() *Server {
+	hks := Server{
+		SimpleUsage: "hyperctl <translate manifest-file | pods | checkpoints [pod-full-name]>",
+		name:        "hyperctl",
+		Long: `Debugging helper for the hyper container runtime. "translate" renders the
+		hyperd pod spec a manifest file would be created with, without running it;
+		"pods" lists the kube-managed hyper pods on this node with their parsed
+		metadata; "checkpoints" lists or dumps the on-disk pod spec checkpoints.`,
+	}
+
+	specDir := hks.Flags().String("spec-dir", "/var/lib/kubelet/hyper", "Directory holding the pod spec checkpoints.")
+
+	hks.Run = func(s *Server, args []string) error {
+		if len(args) == 0 {
+			return s.Usage()
+		}
+
+		switch args[0] {
+		case "translate":
+			if len(args) != 2 {
+				return fmt.Errorf("translate needs exactly one manifest file")
+			}
+			return hyperctlTranslate(args[1])
+		case "pods":
+			return hyperctlPods()
+		case "checkpoints":
+			if len(args) > 1 {
+				return hyperctlDumpCheckpoint(*specDir, args[1])
+			}
+			return hyperctlListCheckpoints(*specDir)
+		}
+
+		return fmt.Errorf("unknown hyperctl command %q", args[0])
+	}
+
+	return &hks
+}
+
+// hyperctlTranslate renders the hyperd spec of a pod manifest without side
+// effects and prints it as indented JSON.
+func hyperctlTranslate(manifestFile string) error {
+	data, err := ioutil.ReadFile(manifestFile)
+	if err != nil {
+		return err
+	}
+
+	jsonData, err := utilyaml.ToJSON(data)
+	if err != nil {
+		return err
+	}
+	obj, err := kuberuntime.Decode(api.Codecs.UniversalDecoder(), jsonData)
+	if err != nil {
+		return err
+	}
+	pod, ok := obj.(*api.Pod)
+	if !ok {
+		return fmt.Errorf("%s is not a pod manifest (got %T)", manifestFile, obj)
+	}
+	if pod.Namespace == "" {
+		pod.Namespace = api.NamespaceDefault
+	}
+
+	spec, err := translate.DryRun(pod)
+	if err != nil {
+		return err
+	}
+
+	var indented bytes.Buffer
+	if err := json.Indent(&indented, spec, "", "  "); err != nil {
+		return err
+	}
+	fmt.Println(indented.String())
+	return nil
+}
+
+// hyperctlPods lists the kube-managed hyper pods as the kubelet parses them,
+// which makes name-parsing problems visible directly.
+func hyperctlPods() error {
+	runtime, err := hyper.NewStandalone(hyper.StandaloneOptions{})
+	if err != nil {
+		return err
+	}
+
+	pods, err := runtime.GetPods(true)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "UID\tNAMESPACE\tNAME\tCONTAINER\tSTATE\tHASH")
+	for _, pod := range pods {
+		for _, container := range pod.Containers {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%x\n",
+				pod.ID, pod.Namespace, pod.Name, container.Name, container.State, container.Hash)
+		}
+	}
+	return w.Flush()
+}
+
+// hyperctlListCheckpoints lists the pod spec checkpoints on the node.
+func hyperctlListCheckpoints(specDir string) error {
+	files, err := ioutil.ReadDir(specDir)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "POD\tSIZE\tMODIFIED")
+	for _, file := range files {
+		if file.IsDir() {
+			continue
+		}
+		fmt.Fprintf(w, "%s\t%d\t%s\n", file.Name(), file.Size(), file.ModTime().Format("2006-01-02 15:04:05"))
+	}
+	return w.Flush()
+}
+
+// hyperctlDumpCheckpoint prints one spec checkpoint as indented JSON.
+func hyperctlDumpCheckpoint(specDir, podFullName string) error {
+	data, err := ioutil.ReadFile(path.Join(specDir, podFullName))
+	if err != nil {
+		return err
+	}
+
+	var indented bytes.Buffer
+	if err := json.Indent(&indented, data, "", "  "); err != nil {
+		// Older checkpoints are raw specs, newer ones are versioned
+		// envelopes; either way the file is JSON, so a failure here means
+		// the checkpoint is corrupt.
+		return fmt.Errorf("checkpoint %s is not valid JSON: %v", podFullName, err)
+	}
+	fmt.Println(indented.String())
+	return nil
+}
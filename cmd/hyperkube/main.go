@@ -37,6 +37,7 @@ func main() {
 	hk.AddServer(NewScheduler())
 	hk.AddServer(NewKubelet())
 	hk.AddServer(NewKubeProxy())
+	hk.AddServer(NewHyperctl())
 
 	//Federation servers
 	hk.AddServer(NewFederationAPIServer())
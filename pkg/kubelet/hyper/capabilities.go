@@ -0,0 +1,82 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyper
+
+import (
+	"github.com/golang/glog"
+)
+
+// Minimum hyperd versions shipping a guest agent with the given feature.
+// Pods booted by an older daemon degrade gracefully instead of failing the
+// whole exec/attach path.
+const (
+	execExitCodeMinVersion   = "0.6.0"
+	terminalResizeMinVersion = "0.8.0"
+)
+
+// agentCapabilities describes the optional exec/attach features supported by
+// the guest agent of the pods this daemon boots.
+type agentCapabilities struct {
+	// ExecExitCodes is true when the agent reports the exit status of exec
+	// sessions; without it exec results are treated as success.
+	ExecExitCodes bool
+
+	// TerminalResize is true when the agent honors terminal resize requests
+	// for interactive sessions.
+	TerminalResize bool
+}
+
+// agentCapabilities probes the hyperd version once and caches the derived
+// capability set. When the version cannot be determined (e.g. hyperd briefly
+// unreachable) all features are assumed and probing is retried on the next
+// call.
+func (r *runtime) agentCapabilities() agentCapabilities {
+	r.agentCapsLock.Lock()
+	defer r.agentCapsLock.Unlock()
+
+	if r.agentCaps != nil {
+		return *r.agentCaps
+	}
+
+	caps := agentCapabilities{ExecExitCodes: true, TerminalResize: true}
+	versionString, err := r.hyperClient.Version()
+	if err != nil {
+		glog.Warningf("Hyper: cannot determine hyperd version for capability detection: %v", err)
+		return caps
+	}
+
+	version, err := parseVersion(versionString)
+	if err != nil {
+		glog.Warningf("Hyper: cannot parse hyperd version %q: %v", versionString, err)
+		return caps
+	}
+
+	if result, err := version.Compare(execExitCodeMinVersion); err == nil && result < 0 {
+		caps.ExecExitCodes = false
+	}
+	if result, err := version.Compare(terminalResizeMinVersion); err == nil && result < 0 {
+		caps.TerminalResize = false
+	}
+
+	if !caps.ExecExitCodes || !caps.TerminalResize {
+		glog.Warningf("Hyper: guest agent of hyperd %s lacks features (exec exit codes: %v, terminal resize: %v), exec and attach will degrade gracefully",
+			versionString, caps.ExecExitCodes, caps.TerminalResize)
+	}
+
+	r.agentCaps = &caps
+	return caps
+}
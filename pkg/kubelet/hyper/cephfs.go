@@ -0,0 +1,72 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyper
+
+import (
+	"github.com/golang/glog"
+)
+
+// CephFS volumes are mounted by the guest's ceph client rather than shared
+// from a host mount, like rbd. The cephfs volume plugin resolves monitors,
+// path, user and the secret (from its secretRef) and hands them over as
+// metadata; the runtime only translates them into a hyperd volume.
+
+const VOLUME_TYPE_CEPHFS = "cephfs"
+
+// cephfsMonitors normalizes the monitor list out of volume metadata.
+func cephfsMonitors(metadata map[string]interface{}) []string {
+	switch value := metadata["monitors"].(type) {
+	case []string:
+		return value
+	case []interface{}:
+		monitors := make([]string, 0, len(value))
+		for _, monitor := range value {
+			if s, ok := monitor.(string); ok {
+				monitors = append(monitors, s)
+			}
+		}
+		return monitors
+	}
+	return nil
+}
+
+// buildCephFSVolume fills in a hyperd volume mounted by the guest's ceph
+// client. It reports false — leaving the volume to the vfs fallback — when
+// the metadata carries no monitors.
+func buildCephFSVolume(v map[string]interface{}, metadata map[string]interface{}) bool {
+	monitors := cephfsMonitors(metadata)
+	if len(monitors) == 0 {
+		glog.Warningf("Hyper: CephFS volume %v has no monitors, falling back to vfs", v[KEY_NAME])
+		return false
+	}
+
+	path, _ := metadata["path"].(string)
+	if path == "" {
+		path = "/"
+	}
+	readonly, _ := metadata["readonly"].(bool)
+
+	v[KEY_VOLUME_DRIVE] = VOLUME_TYPE_CEPHFS
+	v[KEY_VOLUME_SOURCE] = "cephfs:" + path
+	v["option"] = map[string]interface{}{
+		"monitors": monitors,
+		"user":     metadata["user"],
+		"secret":   metadata["secret"],
+		"readOnly": readonly,
+	}
+	return true
+}
@@ -0,0 +1,143 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyper
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path"
+	"strconv"
+
+	"github.com/golang/glog"
+)
+
+const (
+	// At most this many hyper CLI subprocesses run at once; further callers
+	// block. A storm of CLI invocations must not starve the kubelet.
+	maxConcurrentCLIProcesses = 4
+
+	// Resource caps of the cgroup the CLI subprocesses are placed in.
+	cliCgroupName     = "hyper-cli"
+	cliCPUShares      = 256
+	cliMemoryLimit    = 256 * 1024 * 1024
+	cgroupMountPrefix = "/sys/fs/cgroup"
+)
+
+// cliRunner runs the hyper CLI binary with a concurrent-process limit and,
+// when the host cgroup hierarchy is writable, inside a dedicated cgroup with
+// CPU and memory caps.
+type cliRunner struct {
+	binPath string
+	sem     chan struct{}
+
+	// Whether the CLI binary was found. All API-based operations work
+	// without it; only the few CLI-backed features are disabled.
+	binFound bool
+
+	// Cgroup directories the subprocesses are attached to; empty when cgroup
+	// setup failed and processes run unconfined.
+	cgroupDirs []string
+}
+
+// newCLIRunner prepares the CLI cgroup; failures only cost the isolation, not
+// the CLI functionality. A missing CLI binary is not an error either: minimal
+// nodes run API-only, and CLI-backed features report themselves unavailable.
+func newCLIRunner(binPath string) *cliRunner {
+	c := &cliRunner{
+		binPath: binPath,
+		sem:     make(chan struct{}, maxConcurrentCLIProcesses),
+	}
+
+	if _, err := exec.LookPath(binPath); err != nil {
+		glog.V(2).Infof("Hyper: CLI binary %s not found, CLI-backed features are disabled: %v", binPath, err)
+		return c
+	}
+	c.binFound = true
+
+	limits := map[string]map[string]string{
+		"cpu":    {"cpu.shares": strconv.Itoa(cliCPUShares)},
+		"memory": {"memory.limit_in_bytes": strconv.Itoa(cliMemoryLimit)},
+	}
+	for subsystem, files := range limits {
+		dir := path.Join(cgroupMountPrefix, subsystem, cliCgroupName)
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			glog.V(2).Infof("Hyper: cannot create CLI cgroup %s, subprocesses run unconfined: %v", dir, err)
+			continue
+		}
+		for file, value := range files {
+			if err := ioutil.WriteFile(path.Join(dir, file), []byte(value), 0644); err != nil {
+				glog.Warningf("Hyper: cannot set %s in CLI cgroup %s: %v", file, dir, err)
+			}
+		}
+		c.cgroupDirs = append(c.cgroupDirs, dir)
+	}
+
+	return c
+}
+
+// available reports whether the CLI binary is present on the node.
+func (c *cliRunner) available() bool {
+	return c.binFound
+}
+
+// Run executes the hyper CLI with the given arguments and returns its
+// combined output, blocking while the concurrency limit is exhausted.
+func (c *cliRunner) Run(args ...string) ([]byte, error) {
+	if !c.binFound {
+		return nil, fmt.Errorf("the hyper CLI binary %s is not installed on this node", c.binPath)
+	}
+
+	c.sem <- struct{}{}
+	defer func() { <-c.sem }()
+
+	cmd := exec.Command(c.binPath, args...)
+	output, err := c.runInCgroup(cmd)
+	if err != nil {
+		return output, fmt.Errorf("hyper %v: %v", args, err)
+	}
+	return output, nil
+}
+
+// runInCgroup starts the command, moves it into the CLI cgroup and collects
+// its combined output.
+func (c *cliRunner) runInCgroup(cmd *exec.Cmd) ([]byte, error) {
+	if len(c.cgroupDirs) == 0 {
+		return cmd.CombinedOutput()
+	}
+
+	// With Stdout and Stderr set to the same writer os/exec shares one pipe,
+	// like CombinedOutput does.
+	var buf bytes.Buffer
+	cmd.Stdout = &buf
+	cmd.Stderr = &buf
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	pid := strconv.Itoa(cmd.Process.Pid)
+	for _, dir := range c.cgroupDirs {
+		if err := ioutil.WriteFile(path.Join(dir, "cgroup.procs"), []byte(pid), 0644); err != nil {
+			glog.V(4).Infof("Hyper: cannot move CLI process %s into cgroup %s: %v", pid, dir, err)
+		}
+	}
+
+	err := cmd.Wait()
+	return buf.Bytes(), err
+}
@@ -0,0 +1,391 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyper
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/ghodss/yaml"
+	"github.com/golang/glog"
+)
+
+const (
+	// Default location of the structured runtime configuration. The file is
+	// optional; built-in defaults are used when it is absent. Both YAML and
+	// JSON are accepted.
+	hyperRuntimeConfigFile = "/var/lib/kubelet/hyper-config.yaml"
+
+	// The configuration schema version this runtime understands.
+	hyperConfigVersion = "v1alpha1"
+)
+
+// Config is the versioned, structured configuration of the hyper runtime.
+// It replaces scattered kubelet flags and hard-coded constants so operators
+// can tune the runtime from a single file.
+type Config struct {
+	// Version of the configuration schema, currently "v1alpha1".
+	Version string `json:"version"`
+
+	// Endpoint is the hyperd gRPC address, e.g. "127.0.0.1:22318".
+	Endpoint string `json:"endpoint,omitempty"`
+
+	// StandbyEndpoint is a second hyperd address the client fails over to
+	// when the primary stays unreachable through a whole retry cycle;
+	// empty disables failover. Like Endpoint, it requires a restart.
+	StandbyEndpoint string `json:"standbyEndpoint,omitempty"`
+
+	// TLS configures a mutually authenticated connection to a remote
+	// hyperd; nil keeps the historical insecure local connection. The
+	// standby endpoint uses the same TLS configuration.
+	TLS *TLSConfig `json:"tls,omitempty"`
+
+	// HyperdQPS caps the client-side rate of hyperd calls, like the
+	// kubelet's API server QPS flags; zero leaves calls unthrottled.
+	// HyperdBurst is the token bucket depth. The limiter is installed at
+	// client construction, so both require a restart.
+	HyperdQPS   float64 `json:"hyperdQPS,omitempty"`
+	HyperdBurst int     `json:"hyperdBurst,omitempty"`
+
+	// PodSpecDir is the directory for pod spec checkpoints.
+	PodSpecDir string `json:"podSpecDir,omitempty"`
+
+	// BinaryPath is the path of the hyper CLI used for the few operations
+	// without an API equivalent (e.g. image tarball loading).
+	BinaryPath string `json:"binaryPath,omitempty"`
+
+	// ProxyImage is the image used for the in-pod service proxy.
+	ProxyImage string `json:"proxyImage,omitempty"`
+
+	// DefaultVCPU and DefaultMemoryMB size containers without resource
+	// limits.
+	DefaultVCPU     int `json:"defaultVCPU,omitempty"`
+	DefaultMemoryMB int `json:"defaultMemoryMB,omitempty"`
+
+	// MaxPods caps the number of VM pods on the node; zero means no cap.
+	MaxPods int `json:"maxPods,omitempty"`
+
+	// TenantVCPULimit and TenantMemoryMBLimit cap the VM resources one
+	// Keystone tenant may have allocated on this node; pods pushing their
+	// tenant past a cap are refused. Zero disables the respective cap.
+	TenantVCPULimit     int `json:"tenantVCPULimit,omitempty"`
+	TenantMemoryMBLimit int `json:"tenantMemoryMBLimit,omitempty"`
+
+	// MaxConcurrentVMBoots caps how many VMs may boot at the same time,
+	// preventing boot storms from exhausting the node before cgroup
+	// limits apply; zero means unlimited.
+	MaxConcurrentVMBoots int `json:"maxConcurrentVMBoots,omitempty"`
+
+	// VMPoolSize is the number of standby template VMs kept pre-booted
+	// for faster pod startup; zero keeps the pool empty.
+	VMPoolSize int `json:"vmPoolSize,omitempty"`
+
+	// GuestKernelDir is the directory holding guest kernel and initrd
+	// variants; identical blobs in it are deduplicated into a
+	// content-addressed cache. Empty disables the cache.
+	GuestKernelDir string `json:"guestKernelDir,omitempty"`
+
+	// AllowedGuestImages lists the guest image bundles — subdirectories of
+	// GuestKernelDir holding an alternative kernel and initrd — that pods
+	// may select via annotation. Empty refuses all selections.
+	AllowedGuestImages []string `json:"allowedGuestImages,omitempty"`
+
+	// AllowedKernelParameters lists the kernel cmdline parameter names
+	// pods may append to their VM's boot cmdline via annotation. Empty
+	// refuses all parameters.
+	AllowedKernelParameters []string `json:"allowedKernelParameters,omitempty"`
+
+	// ClockSyncMaxDriftSeconds makes the clock drift monitor actively
+	// correct guests drifting further than this from the host clock,
+	// switching them to kvm-clock and stepping their time. Zero keeps the
+	// monitor measuring only.
+	ClockSyncMaxDriftSeconds int `json:"clockSyncMaxDriftSeconds,omitempty"`
+
+	// ExecTimeoutSeconds bounds interactive exec sessions; zero leaves
+	// them unbounded. Non-interactive execs (probes) always have a
+	// built-in timeout.
+	ExecTimeoutSeconds int `json:"execTimeoutSeconds,omitempty"`
+
+	// AllowPrivileged accepts privileged containers with in-guest
+	// semantics instead of rejecting them.
+	AllowPrivileged bool `json:"allowPrivileged,omitempty"`
+
+	// MaxVMRestartsPerWindow caps how often a pod may recreate its VM
+	// within VMRestartWindowSeconds before being quarantined for one
+	// window; zero disables the cap.
+	MaxVMRestartsPerWindow int `json:"maxVMRestartsPerWindow,omitempty"`
+	VMRestartWindowSeconds int `json:"vmRestartWindowSeconds,omitempty"`
+
+	// ImagePreloadDir is a directory of image tarballs imported into
+	// hyperd at kubelet startup; empty disables preloading.
+	ImagePreloadDir string `json:"imagePreloadDir,omitempty"`
+
+	// GuestCABundles lists PEM files (cluster CA, custom trust bundles)
+	// projected into the trust store of every pod VM.
+	GuestCABundles []string `json:"guestCABundles,omitempty"`
+
+	// PropagateHostLocaltime projects the node's /etc/localtime and locale
+	// configuration into every pod VM, for legacy workloads that expect
+	// node-local time. Pods can override the default via annotation.
+	PropagateHostLocaltime bool `json:"propagateHostLocaltime,omitempty"`
+
+	// StrictFieldValidation fails pods that use spec fields the runtime
+	// would silently ignore (host namespaces, SELinux, subpaths, ...)
+	// instead of running them with a warning event.
+	StrictFieldValidation bool `json:"strictFieldValidation,omitempty"`
+
+	// RestartOnAgentFailure injects a liveness failure for pods whose
+	// guest agent stops answering heartbeats, so the sync loop applies
+	// the pod's restart policy instead of only marking it NotReady.
+	RestartOnAgentFailure bool `json:"restartOnAgentFailure,omitempty"`
+
+	// VMConsoleLogDir is the directory where hyperd mirrors the serial
+	// console of each VM into a log file; when set, the debug endpoint
+	// serves console output for stuck pods. Empty disables console access.
+	VMConsoleLogDir string `json:"vmConsoleLogDir,omitempty"`
+
+	// ImageAllowlist and ImageDenylist are registry/repository patterns
+	// evaluated against every image before it is run or pulled; the
+	// denylist wins, and an empty allowlist allows everything not denied.
+	ImageAllowlist []string `json:"imageAllowlist,omitempty"`
+	ImageDenylist  []string `json:"imageDenylist,omitempty"`
+
+	// ImageVerifierPath is an external command verifying image signatures;
+	// images it rejects are not pulled. ImageTrustDir is passed to it as
+	// the trust root directory. An empty path disables verification.
+	ImageVerifierPath string `json:"imageVerifierPath,omitempty"`
+	ImageTrustDir     string `json:"imageTrustDir,omitempty"`
+
+	// PreStartHooks lists external commands run between image pull and
+	// pod start; each receives the pod identity, image digests and the
+	// generated hyperd spec on stdin and can veto the start by exiting
+	// nonzero.
+	PreStartHooks []string `json:"preStartHooks,omitempty"`
+
+	// ExecAuditLogFile, when set, appends a structured audit record for
+	// every exec, attach and run-in-container call to this file. Empty
+	// disables exec auditing.
+	ExecAuditLogFile string `json:"execAuditLogFile,omitempty"`
+
+	// DebugAddress, when set, serves the sanitized runtime state snapshot
+	// over HTTP for support bundles. The endpoints are unauthenticated, so
+	// only loopback addresses are accepted; empty disables the endpoint.
+	DebugAddress string `json:"debugAddress,omitempty"`
+
+	// FeatureGates toggles optional runtime subsystems by name.
+	FeatureGates map[string]bool `json:"featureGates,omitempty"`
+
+	// GCDryRun makes GarbageCollect report what it would remove — VMs,
+	// spec checkpoints and unreferenced images — instead of removing it,
+	// so a GC policy can be judged before it is enabled.
+	GCDryRun bool `json:"gcDryRun,omitempty"`
+
+	// ReadOnly puts the runtime into forensic mode: status, logs and exec
+	// keep working but pod, container and image mutations are refused, so
+	// an incident can be investigated without the kubelet healing the
+	// evidence away. The setting is hot-reloadable.
+	ReadOnly bool `json:"readOnly,omitempty"`
+}
+
+// TLSConfig holds the client certificate, key and CA used for a mutually
+// authenticated hyperd connection.
+type TLSConfig struct {
+	CertFile string `json:"certFile"`
+	KeyFile  string `json:"keyFile"`
+	CAFile   string `json:"caFile"`
+}
+
+// applyReloadable copies the hot-reloadable fields of updated into c.
+// Identity settings such as the hyperd endpoint or the spec directory require
+// a kubelet restart, while tuning knobs can be applied to a running node.
+func (c *Config) applyReloadable(updated *Config) {
+	c.ProxyImage = updated.ProxyImage
+	c.DefaultVCPU = updated.DefaultVCPU
+	c.DefaultMemoryMB = updated.DefaultMemoryMB
+	c.MaxPods = updated.MaxPods
+	c.TenantVCPULimit = updated.TenantVCPULimit
+	c.TenantMemoryMBLimit = updated.TenantMemoryMBLimit
+	c.MaxConcurrentVMBoots = updated.MaxConcurrentVMBoots
+	c.VMPoolSize = updated.VMPoolSize
+	c.GuestKernelDir = updated.GuestKernelDir
+	c.AllowedGuestImages = updated.AllowedGuestImages
+	c.AllowedKernelParameters = updated.AllowedKernelParameters
+	c.ClockSyncMaxDriftSeconds = updated.ClockSyncMaxDriftSeconds
+	c.ExecTimeoutSeconds = updated.ExecTimeoutSeconds
+	c.AllowPrivileged = updated.AllowPrivileged
+	c.MaxVMRestartsPerWindow = updated.MaxVMRestartsPerWindow
+	c.VMRestartWindowSeconds = updated.VMRestartWindowSeconds
+	c.PropagateHostLocaltime = updated.PropagateHostLocaltime
+	c.StrictFieldValidation = updated.StrictFieldValidation
+	c.RestartOnAgentFailure = updated.RestartOnAgentFailure
+	c.VMConsoleLogDir = updated.VMConsoleLogDir
+	c.ImageAllowlist = updated.ImageAllowlist
+	c.ImageDenylist = updated.ImageDenylist
+	c.ImageVerifierPath = updated.ImageVerifierPath
+	c.ImageTrustDir = updated.ImageTrustDir
+	c.PreStartHooks = updated.PreStartHooks
+	c.ExecAuditLogFile = updated.ExecAuditLogFile
+	c.FeatureGates = updated.FeatureGates
+	c.GCDryRun = updated.GCDryRun
+	c.ReadOnly = updated.ReadOnly
+}
+
+// defaultConfig returns the built-in configuration matching the historical
+// behavior of the runtime.
+func defaultConfig() *Config {
+	return &Config{
+		Version:         hyperConfigVersion,
+		Endpoint:        HYPER_SERVER,
+		PodSpecDir:      hyperPodSpecDir,
+		BinaryPath:      hyperBinName,
+		ProxyImage:      "haproxy:1.5",
+		DefaultVCPU:     hyperDefaultContainerCPU,
+		DefaultMemoryMB: hyperDefaultContainerMem,
+		// The VM recreation budget is off unless MaxVMRestartsPerWindow is
+		// configured; the window default only spares operators the second
+		// knob.
+		VMRestartWindowSeconds: 600,
+	}
+}
+
+// validateConfig rejects configurations the runtime cannot safely run with.
+func validateConfig(config *Config) error {
+	if config.Version != hyperConfigVersion {
+		return fmt.Errorf("unsupported hyper config version %q, expected %q", config.Version, hyperConfigVersion)
+	}
+	if config.DefaultVCPU < 0 || config.DefaultMemoryMB < 0 || config.MaxPods < 0 ||
+		config.TenantVCPULimit < 0 || config.TenantMemoryMBLimit < 0 ||
+		config.ClockSyncMaxDriftSeconds < 0 ||
+		config.HyperdQPS < 0 || config.HyperdBurst < 0 {
+		return fmt.Errorf("hyper config defaults and limits must not be negative")
+	}
+	if config.DebugAddress != "" && !isLoopbackAddress(config.DebugAddress) {
+		return fmt.Errorf("debugAddress %q is not a loopback address; the debug endpoints are unauthenticated and must not be reachable remotely", config.DebugAddress)
+	}
+	return nil
+}
+
+// isLoopbackAddress reports whether a host:port listen address binds only to
+// the loopback interface. An empty host binds every interface and is not
+// loopback.
+func isLoopbackAddress(address string) bool {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// configManager loads the runtime configuration and serves it to the rest of
+// the runtime, re-reading the file when it changes so that the reloadable
+// subset of settings can be tuned without a kubelet restart.
+type configManager struct {
+	sync.RWMutex
+	configFile string
+	config     *Config
+	modTime    time.Time
+}
+
+// newConfigManager reads the config file (if any), validates it and returns
+// a manager seeded with the result.
+func newConfigManager(configFile string) (*configManager, error) {
+	m := &configManager{
+		configFile: configFile,
+		config:     defaultConfig(),
+	}
+
+	config, modTime, err := m.read()
+	if err != nil {
+		return nil, err
+	}
+	if config != nil {
+		m.config = config
+		m.modTime = modTime
+	}
+
+	return m, nil
+}
+
+// read parses the config file, returning (nil, zero, nil) when it does not
+// exist.
+func (m *configManager) read() (*Config, time.Time, error) {
+	info, err := os.Stat(m.configFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, time.Time{}, nil
+		}
+		return nil, time.Time{}, err
+	}
+
+	data, err := ioutil.ReadFile(m.configFile)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+
+	config := defaultConfig()
+	if err := yaml.Unmarshal(data, config); err != nil {
+		return nil, time.Time{}, fmt.Errorf("failed to parse hyper config %s: %v", m.configFile, err)
+	}
+	if err := validateConfig(config); err != nil {
+		return nil, time.Time{}, err
+	}
+
+	return config, info.ModTime(), nil
+}
+
+// getConfig returns the current configuration. Callers must not mutate the
+// result.
+func (m *configManager) getConfig() *Config {
+	m.RLock()
+	defer m.RUnlock()
+	return m.config
+}
+
+// reloadIfChanged re-reads the config file when its modification time moved
+// and applies the hot-reloadable subset of settings. Invalid updates are
+// logged and ignored, keeping the last good configuration.
+func (m *configManager) reloadIfChanged() {
+	config, modTime, err := m.read()
+	if err != nil {
+		glog.Warningf("Hyper: ignoring config reload: %v", err)
+		return
+	}
+	if config == nil {
+		return
+	}
+
+	m.Lock()
+	defer m.Unlock()
+	if !modTime.After(m.modTime) {
+		return
+	}
+
+	// Copy-on-write so concurrent readers keep a consistent snapshot.
+	updated := *m.config
+	updated.applyReloadable(config)
+	m.config = &updated
+	m.modTime = modTime
+	glog.V(2).Infof("Hyper: reloaded runtime configuration from %s", m.configFile)
+}
@@ -0,0 +1,98 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyper
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestValidateConfig(t *testing.T) {
+	if err := validateConfig(defaultConfig()); err != nil {
+		t.Errorf("default config should validate: %v", err)
+	}
+
+	badVersion := defaultConfig()
+	badVersion.Version = "v0"
+	if err := validateConfig(badVersion); err == nil {
+		t.Errorf("expected version mismatch to be rejected")
+	}
+
+	badLimit := defaultConfig()
+	badLimit.MaxPods = -1
+	if err := validateConfig(badLimit); err == nil {
+		t.Errorf("expected negative limit to be rejected")
+	}
+
+	for _, address := range []string{"0.0.0.0:9124", ":9124", "10.0.0.5:9124", "localhost"} {
+		badDebug := defaultConfig()
+		badDebug.DebugAddress = address
+		if err := validateConfig(badDebug); err == nil {
+			t.Errorf("expected non-loopback debug address %q to be rejected", address)
+		}
+	}
+	for _, address := range []string{"127.0.0.1:9124", "localhost:9124", "[::1]:9124"} {
+		goodDebug := defaultConfig()
+		goodDebug.DebugAddress = address
+		if err := validateConfig(goodDebug); err != nil {
+			t.Errorf("expected loopback debug address %q to validate: %v", address, err)
+		}
+	}
+}
+
+func TestConfigManagerLoadsFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hyper-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	configFile := path.Join(dir, "config.yaml")
+	data := []byte("version: v1alpha1\nendpoint: 127.0.0.1:12345\nmaxPods: 10\n")
+	if err := ioutil.WriteFile(configFile, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := newConfigManager(configFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config := m.getConfig()
+	if config.Endpoint != "127.0.0.1:12345" {
+		t.Errorf("unexpected endpoint %q", config.Endpoint)
+	}
+	if config.MaxPods != 10 {
+		t.Errorf("unexpected maxPods %d", config.MaxPods)
+	}
+	// Unset fields keep their defaults.
+	if config.ProxyImage != defaultConfig().ProxyImage {
+		t.Errorf("unexpected proxy image %q", config.ProxyImage)
+	}
+}
+
+func TestConfigManagerMissingFile(t *testing.T) {
+	m, err := newConfigManager("/nonexistent/hyper-config.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.getConfig().Endpoint != HYPER_SERVER {
+		t.Errorf("expected built-in defaults for a missing config file")
+	}
+}
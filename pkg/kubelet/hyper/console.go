@@ -0,0 +1,120 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyper
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"time"
+)
+
+// Serial console access for pod VMs. The hyperd gRPC API has no console
+// stream, but hyperd can be configured to mirror each VM's serial port into
+// a log file (qemu -serial file:...). When the operator points
+// vmConsoleLogDir at that directory, the debug endpoint serves the console
+// output — guest kernel messages and early boot logs — of pods that are
+// stuck before the guest agent comes up.
+
+// How often a followed console file is polled for new output.
+const consoleFollowInterval = time.Second
+
+// vmConsolePath locates the console log file of a pod's VM. Both flat
+// ("<vm>.log") and per-VM directory ("<vm>/console.log") layouts are
+// accepted.
+func (r *runtime) vmConsolePath(podFullName string) (string, error) {
+	logDir := r.configManager.getConfig().VMConsoleLogDir
+	if logDir == "" {
+		return "", fmt.Errorf("serial console access is disabled, set vmConsoleLogDir in the runtime configuration")
+	}
+
+	podInfos, err := r.hyperClient.ListPods()
+	if err != nil {
+		return "", err
+	}
+
+	var vm string
+	for _, podInfo := range podInfos {
+		if podInfo.PodName == podFullName {
+			vm = podInfo.PodInfo.Vm
+			break
+		}
+	}
+	if vm == "" {
+		return "", fmt.Errorf("no VM found for pod %s", podFullName)
+	}
+
+	for _, candidate := range []string{path.Join(logDir, vm+".log"), path.Join(logDir, vm, "console.log")} {
+		if _, err := os.Stat(candidate); err == nil {
+			return candidate, nil
+		}
+	}
+	return "", fmt.Errorf("no console log for VM %s under %s", vm, logDir)
+}
+
+// serveConsole writes the console log of a pod's VM to the response,
+// optionally following it until the client goes away.
+func (r *runtime) serveConsole(w http.ResponseWriter, req *http.Request) {
+	podFullName := req.URL.Query().Get("pod")
+	if podFullName == "" {
+		http.Error(w, "pod parameter is required", http.StatusBadRequest)
+		return
+	}
+
+	consolePath, err := r.vmConsolePath(podFullName)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	file, err := os.Open(consolePath)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer file.Close()
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	if _, err := io.Copy(w, file); err != nil {
+		return
+	}
+
+	if req.URL.Query().Get("follow") != "true" {
+		return
+	}
+
+	flusher, _ := w.(http.Flusher)
+	var closed <-chan bool
+	if notifier, ok := w.(http.CloseNotifier); ok {
+		closed = notifier.CloseNotify()
+	}
+	for {
+		if flusher != nil {
+			flusher.Flush()
+		}
+		select {
+		case <-closed:
+			return
+		case <-time.After(consoleFollowInterval):
+		}
+		if _, err := io.Copy(w, file); err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,81 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyper
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+
+	"github.com/golang/glog"
+
+	kubecontainer "k8s.io/kubernetes/pkg/kubelet/container"
+)
+
+// Filesystem copy in and out of containers, for `kubectl cp`. hyperd has no
+// filesystem API, so both directions stream a tar archive through an exec
+// session with the in-guest tar, the same mechanism kubectl uses against the
+// docker runtime.
+
+// CopyToContainer extracts the tar stream into destDir inside the container.
+// destDir must be absolute; it is created when missing.
+func (r *runtime) CopyToContainer(containerID kubecontainer.ContainerID, destDir string, tarStream io.Reader) error {
+	if !path.IsAbs(destDir) {
+		return fmt.Errorf("destination %q must be an absolute path", destDir)
+	}
+	glog.V(4).Infof("Hyper: copying archive into %s of container %s", destDir, containerID.ID)
+
+	stderr := bytes.NewBuffer(nil)
+	cmd := []string{"sh", "-c", fmt.Sprintf("mkdir -p %s && tar -xmf - -C %s", shellQuote(destDir), shellQuote(destDir))}
+	if err := r.ExecInContainer(containerID, cmd, tarStream, nil, nopCloser{stderr}, false); err != nil {
+		return copyError("to", containerID.ID, err, stderr)
+	}
+	return nil
+}
+
+// CopyFromContainer writes srcPath from the container as a tar stream. The
+// archive entries are relative to the parent of srcPath, matching what
+// kubectl expects when unpacking.
+func (r *runtime) CopyFromContainer(containerID kubecontainer.ContainerID, srcPath string, out io.Writer) error {
+	if !path.IsAbs(srcPath) {
+		return fmt.Errorf("source %q must be an absolute path", srcPath)
+	}
+	glog.V(4).Infof("Hyper: copying %s out of container %s", srcPath, containerID.ID)
+
+	stderr := bytes.NewBuffer(nil)
+	cmd := []string{"tar", "-cf", "-", "-C", path.Dir(srcPath), path.Base(srcPath)}
+	if err := r.ExecInContainer(containerID, cmd, nil, nopCloser{out}, nopCloser{stderr}, false); err != nil {
+		return copyError("from", containerID.ID, err, stderr)
+	}
+	return nil
+}
+
+// copyError attaches whatever the in-guest tar printed to the exec failure,
+// which is usually the actually useful part ("No such file or directory").
+func copyError(direction, containerID string, err error, stderr *bytes.Buffer) error {
+	if message := strings.TrimSpace(stderr.String()); message != "" {
+		return fmt.Errorf("copy %s container %s failed: %v: %s", direction, containerID, err, message)
+	}
+	return fmt.Errorf("copy %s container %s failed: %v", direction, containerID, err)
+}
+
+// shellQuote makes a path safe to splice into the sh command line above.
+func shellQuote(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
@@ -0,0 +1,87 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyper
+
+import (
+	"github.com/golang/glog"
+
+	"k8s.io/kubernetes/pkg/api"
+	kubecontainer "k8s.io/kubernetes/pkg/kubelet/container"
+	"k8s.io/kubernetes/pkg/types"
+)
+
+const (
+	// Container status reasons for abnormal terminations.
+	reasonOOMKilled = "OOMKilled"
+	reasonVMCrashed = "VMCrashed"
+
+	// 128 + SIGKILL; the guest kernel kills OOM victims with SIGKILL and
+	// hyperd does not forward the OOM flag, so the exit code is the best
+	// signal available.
+	oomExitCode = 137
+)
+
+// noteAbnormalTermination emits a dedicated warning event the first time a
+// container is seen OOM-killed or taken down by a VM crash, so the pod does
+// not just appear Failed with no explanation. Status polling repeats, hence
+// the per-container deduplication.
+func (r *runtime) noteAbnormalTermination(podInfo HyperPod, status *kubecontainer.ContainerStatus) {
+	if status.State != kubecontainer.ContainerStateExited {
+		return
+	}
+	if status.Reason != reasonOOMKilled && status.Reason != reasonVMCrashed {
+		return
+	}
+
+	r.crashLock.Lock()
+	if r.crashNoted == nil {
+		r.crashNoted = make(map[string]string)
+	}
+	if r.crashNoted[status.ID.ID] == status.Reason {
+		r.crashLock.Unlock()
+		return
+	}
+	r.crashNoted[status.ID.ID] = status.Reason
+	r.crashLock.Unlock()
+
+	podName, podNamespace, err := kubecontainer.ParsePodFullName(podInfo.PodName)
+	if err != nil {
+		return
+	}
+	pod := &api.Pod{ObjectMeta: api.ObjectMeta{
+		Name:      podName,
+		Namespace: podNamespace,
+		UID:       types.UID(podInfo.PodInfo.Spec.Labels[KEY_API_POD_UID]),
+	}}
+
+	switch status.Reason {
+	case reasonOOMKilled:
+		r.recorder.Eventf(pod, api.EventTypeWarning, reasonOOMKilled,
+			"Container %s was killed by the guest kernel OOM killer", status.Name)
+	case reasonVMCrashed:
+		r.recorder.Eventf(pod, api.EventTypeWarning, reasonVMCrashed,
+			"VM of pod %s crashed, container %s was lost", podInfo.PodName, status.Name)
+
+		// Preserve the VM-level evidence before the pod is cleaned up.
+		if dumpDir, err := r.collectVMCrashDump(podInfo); err == nil {
+			r.recorder.Eventf(pod, api.EventTypeWarning, reasonCrashDumpSaved,
+				"Crash dump of pod %s saved to %s on the node", podInfo.PodName, dumpDir)
+		} else {
+			glog.Warningf("Hyper: cannot collect crash dump of pod %s: %v", podInfo.PodName, err)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyper
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+const (
+	// Crash dumps — the guest console output and the qemu log of a crashed
+	// VM — are collected here, one directory per hyperd pod ID.
+	crashDumpDir = "/var/lib/kubelet/hyper-crash-dumps"
+
+	// Dumps older than this are removed when a new one is collected.
+	crashDumpRetention = 7 * 24 * time.Hour
+
+	reasonCrashDumpSaved = "CrashDumpSaved"
+)
+
+// crashDumpMetadata is written next to the collected files, so a dump can be
+// attributed without the pod around anymore.
+type crashDumpMetadata struct {
+	Time    time.Time `json:"time"`
+	PodName string    `json:"podName"`
+	PodID   string    `json:"podID"`
+	VM      string    `json:"vm"`
+}
+
+// collectVMCrashDump copies the console and qemu logs of a crashed VM into a
+// per-pod directory under crashDumpDir and returns its path. The sources
+// only exist when the operator configured vmConsoleLogDir; without it only
+// the metadata is written, which still records that the VM crashed and when.
+// An existing dump for the same hyperd pod ID is left untouched.
+func (r *runtime) collectVMCrashDump(podInfo HyperPod) (string, error) {
+	dumpDir := path.Join(crashDumpDir, podInfo.PodID)
+	if _, err := os.Stat(dumpDir); err == nil {
+		return dumpDir, nil
+	}
+	if err := os.MkdirAll(dumpDir, 0700); err != nil {
+		return "", err
+	}
+
+	vm := podInfo.PodInfo.Vm
+	if logDir := r.configManager.getConfig().VMConsoleLogDir; logDir != "" && vm != "" {
+		sources := map[string][]string{
+			"console.log": {path.Join(logDir, vm+".log"), path.Join(logDir, vm, "console.log")},
+			"qemu.log":    {path.Join(logDir, vm+"-qemu.log"), path.Join(logDir, vm, "qemu.log")},
+		}
+		for name, candidates := range sources {
+			for _, candidate := range candidates {
+				if err := copyFile(candidate, path.Join(dumpDir, name)); err == nil {
+					break
+				}
+			}
+		}
+	}
+
+	metadata := crashDumpMetadata{
+		Time:    time.Now(),
+		PodName: podInfo.PodName,
+		PodID:   podInfo.PodID,
+		VM:      vm,
+	}
+	if data, err := json.Marshal(&metadata); err == nil {
+		if err := ioutil.WriteFile(path.Join(dumpDir, "metadata.json"), data, 0600); err != nil {
+			glog.Warningf("Hyper: cannot write crash dump metadata for pod %s: %v", podInfo.PodName, err)
+		}
+	}
+
+	r.cleanupCrashDumps()
+	return dumpDir, nil
+}
+
+// copyFile copies src to dst, failing when src does not exist.
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	_, err = io.Copy(out, in)
+	return err
+}
+
+// cleanupCrashDumps removes dumps past the retention period.
+func (r *runtime) cleanupCrashDumps() {
+	entries, err := ioutil.ReadDir(crashDumpDir)
+	if err != nil {
+		return
+	}
+	for _, entry := range entries {
+		if time.Since(entry.ModTime()) > crashDumpRetention {
+			os.RemoveAll(path.Join(crashDumpDir, entry.Name()))
+		}
+	}
+}
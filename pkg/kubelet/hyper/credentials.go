@@ -0,0 +1,100 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyper
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"github.com/golang/glog"
+	"k8s.io/kubernetes/pkg/api"
+	"k8s.io/kubernetes/pkg/credentialprovider"
+)
+
+// credentialHelperOutput is the JSON a docker-style credential helper writes
+// on stdout for the "get" action.
+type credentialHelperOutput struct {
+	Username string `json:"Username"`
+	Secret   string `json:"Secret"`
+}
+
+// credentialHelperFor returns the configured exec credential helper for the
+// registry, or the empty string if there is none.
+func (c *RegistryConfig) credentialHelperFor(registry string) string {
+	if c == nil {
+		return ""
+	}
+	return c.CredentialHelpers[registry]
+}
+
+// execCredentialHelper invokes a docker-style credential helper binary
+// ("<helper> get" with the registry on stdin) and returns the credentials it
+// provides. Helpers typically wrap cloud credential endpoints (ECR, GCR,
+// ACR) issuing short-lived tokens, so the result must not be cached.
+func execCredentialHelper(helper, registry string) (credentialprovider.LazyAuthConfiguration, error) {
+	var creds credentialprovider.LazyAuthConfiguration
+
+	cmd := exec.Command(helper, "get")
+	cmd.Stdin = strings.NewReader(registry)
+	var out bytes.Buffer
+	cmd.Stdout = &out
+
+	if err := cmd.Run(); err != nil {
+		return creds, fmt.Errorf("credential helper %s failed for registry %s: %v", helper, registry, err)
+	}
+
+	var output credentialHelperOutput
+	if err := json.Unmarshal(out.Bytes(), &output); err != nil {
+		return creds, fmt.Errorf("failed to parse output of credential helper %s: %v", helper, err)
+	}
+
+	return credentialprovider.DockerConfigEntryToLazyAuthConfiguration(credentialprovider.DockerConfigEntry{
+		Username: output.Username,
+		Password: output.Secret,
+	}), nil
+}
+
+// lookupPullCredentials resolves the credentials for pulling the given
+// repository. Exec credential helpers take precedence; otherwise the keyring
+// built from the pull secrets and the node's credential providers is
+// consulted. The keyring is rebuilt on every call so that providers issuing
+// short-lived tokens are always re-queried.
+func (r *runtime) lookupPullCredentials(repoToPull string, pullSecrets []api.Secret) ([]credentialprovider.LazyAuthConfiguration, error) {
+	registry := imageRegistry(repoToPull)
+	if helper := r.registryConfig.credentialHelperFor(registry); helper != "" {
+		creds, err := execCredentialHelper(helper, registry)
+		if err != nil {
+			glog.Warningf("Hyper: %v, falling back to the docker keyring", err)
+		} else {
+			return []credentialprovider.LazyAuthConfiguration{creds}, nil
+		}
+	}
+
+	keyring, err := credentialprovider.MakeDockerKeyring(pullSecrets, credentialprovider.NewDockerKeyring())
+	if err != nil {
+		return nil, err
+	}
+
+	creds, ok := keyring.Lookup(repoToPull)
+	if !ok || len(creds) == 0 {
+		glog.V(4).Infof("Hyper: pulling image %s without credentials", repoToPull)
+	}
+	return creds, nil
+}
@@ -0,0 +1,119 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyper
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/golang/glog"
+
+	"k8s.io/kubernetes/pkg/api"
+	kubecontainer "k8s.io/kubernetes/pkg/kubelet/container"
+	"k8s.io/kubernetes/pkg/types"
+	"k8s.io/kubernetes/pkg/util/wait"
+)
+
+const (
+	// Label carrying the pod's activeDeadlineSeconds, written at creation
+	// time so the deadline survives kubelet restarts.
+	activeDeadlineLabel = "sh.hyper.active-deadline-seconds"
+
+	// How often running pods are checked against their deadline.
+	deadlineCheckInterval = 30 * time.Second
+
+	reasonDeadlineExceeded = "DeadlineExceeded"
+)
+
+// startDeadlineEnforcer enforces pod.Spec.ActiveDeadlineSeconds at the
+// runtime level. The kubelet enforces the deadline as well, but its view can
+// lag for VM pods (e.g. while the node was down), so the runtime double-checks
+// against the VM start time recorded by hyperd.
+func (r *runtime) startDeadlineEnforcer() {
+	go wait.Until(r.enforceActiveDeadlines, deadlineCheckInterval, wait.NeverStop)
+}
+
+// enforceActiveDeadlines kills running pods whose deadline has passed and
+// remembers them so their container statuses report DeadlineExceeded.
+func (r *runtime) enforceActiveDeadlines() {
+	podInfos, err := r.hyperClient.ListPods()
+	if err != nil {
+		glog.Warningf("Hyper: deadline enforcer: ListPods failed: %v", err)
+		return
+	}
+
+	for _, podInfo := range podInfos {
+		if podInfo.Status != StatusRunning {
+			continue
+		}
+
+		seconds, err := strconv.ParseInt(podInfo.PodInfo.Spec.Labels[activeDeadlineLabel], 10, 64)
+		if err != nil || seconds <= 0 {
+			continue
+		}
+
+		start, err := parseTimeString(podInfo.PodInfo.Status.StartTime)
+		if err != nil || start.IsZero() {
+			start = time.Unix(podInfo.PodInfo.CreatedAt, 0)
+		}
+		if time.Since(start) <= time.Duration(seconds)*time.Second {
+			continue
+		}
+
+		podName, podNamespace, err := kubecontainer.ParsePodFullName(podInfo.PodName)
+		if err != nil {
+			continue
+		}
+		uid := types.UID(podInfo.PodInfo.Spec.Labels[KEY_API_POD_UID])
+
+		glog.V(2).Infof("Hyper: pod %s exceeded its active deadline of %ds, killing it", podInfo.PodName, seconds)
+		r.markDeadlineExceeded(podInfo.PodID)
+
+		pod := &api.Pod{ObjectMeta: api.ObjectMeta{Name: podName, Namespace: podNamespace, UID: uid}}
+		r.recorder.Eventf(pod, api.EventTypeWarning, reasonDeadlineExceeded,
+			"Pod was active on the node longer than the specified deadline of %ds", seconds)
+
+		runningPod := kubecontainer.Pod{ID: uid, Name: podName, Namespace: podNamespace}
+		if err := r.KillPod(pod, runningPod, nil); err != nil {
+			glog.Warningf("Hyper: deadline enforcer: kill pod %s failed: %v", podInfo.PodName, err)
+		}
+	}
+}
+
+// markDeadlineExceeded remembers that a pod was killed for exceeding its
+// deadline, so the termination reason of its containers is reported
+// accordingly.
+func (r *runtime) markDeadlineExceeded(podID string) {
+	r.deadlineLock.Lock()
+	defer r.deadlineLock.Unlock()
+	if r.deadlineExceeded == nil {
+		r.deadlineExceeded = make(map[string]bool)
+	}
+	r.deadlineExceeded[podID] = true
+}
+
+// applyDeadlineReason rewrites the generic termination reason of containers
+// belonging to a pod that was killed for exceeding its deadline.
+func (r *runtime) applyDeadlineReason(podID string, status *kubecontainer.ContainerStatus) {
+	r.deadlineLock.Lock()
+	exceeded := r.deadlineExceeded[podID]
+	r.deadlineLock.Unlock()
+
+	if exceeded && status.State == kubecontainer.ContainerStateExited {
+		status.Reason = reasonDeadlineExceeded
+	}
+}
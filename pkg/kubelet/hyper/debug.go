@@ -0,0 +1,86 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyper
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/golang/glog"
+
+	grpctypes "k8s.io/kubernetes/pkg/kubelet/hyper/types"
+	"k8s.io/kubernetes/pkg/util"
+)
+
+const (
+	// Label marking an injected debug container, so tooling can tell it
+	// apart from the pod's own containers.
+	debugContainerLabel = "sh.hyper.debug-container"
+
+	// Name prefix of injected debug containers; the sync loop uses it to
+	// leave them alone.
+	debugContainerNamePrefix = "kube-debug-"
+)
+
+// isDebugContainerName reports whether a container name belongs to an
+// injected debug container.
+func isDebugContainerName(name string) bool {
+	return strings.HasPrefix(name, debugContainerNamePrefix)
+}
+
+// injectDebugContainer adds a troubleshooting container with the given image
+// to an already-running pod VM and boots it without touching the other
+// containers. It shares the VM kernel and network namespace of the pod, so a
+// shell in it can inspect processes and sockets of minimal images that ship
+// no tools of their own. The container is removed with the pod; it is never
+// restarted by the sync loop.
+func (r *runtime) injectDebugContainer(podFullName, image string, command []string) (string, error) {
+	podID, err := r.hyperClient.GetPodIDByName(podFullName)
+	if err != nil {
+		return "", err
+	}
+
+	repo, tag := parseImageName(image)
+	if present, _ := r.hyperClient.IsImagePresent(repo, tag); !present {
+		if err := r.hyperClient.PullImage(image, ""); err != nil {
+			return "", fmt.Errorf("cannot pull debug image %s: %v", image, err)
+		}
+	}
+
+	name := debugContainerNamePrefix + strings.Split(string(util.NewUUID()), "-")[0]
+	spec := &grpctypes.UserContainer{
+		Name:    name,
+		Image:   image,
+		Command: command,
+		Tty:     true,
+		Labels:  map[string]string{debugContainerLabel: "true"},
+	}
+
+	containerID, err := r.hyperClient.CreateContainer(podID, spec)
+	if err != nil {
+		return "", err
+	}
+
+	// StartPod boots only the containers that are not running; the VM and
+	// the pod's own containers stay untouched.
+	if err := r.hyperClient.StartPod(podID); err != nil {
+		return "", fmt.Errorf("debug container %s created but not started: %v", containerID, err)
+	}
+
+	glog.V(2).Infof("Hyper: injected debug container %s (%s) into pod %s", name, image, podFullName)
+	return containerID, nil
+}
@@ -0,0 +1,80 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyper
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/golang/glog"
+
+	kubecontainer "k8s.io/kubernetes/pkg/kubelet/container"
+)
+
+// DeleteContainer releases a single exited container of a running pod. The
+// hyperd gRPC API has no per-container remove, so the in-VM record itself is
+// only freed when the pod's VM goes away; what the kubelet owns — the log
+// symlink and, after the retention period, the archived previous logs — is
+// cleaned up here. The current logs are archived first so
+// `kubectl logs --previous` keeps working.
+func (r *runtime) DeleteContainer(containerID kubecontainer.ContainerID) error {
+	if err := r.checkReadOnly("delete container"); err != nil {
+		return err
+	}
+
+	podInfos, err := r.hyperClient.ListPods()
+	if err != nil {
+		return err
+	}
+
+	for _, podInfo := range podInfos {
+		for _, c := range podInfo.PodInfo.Status.ContainerStatus {
+			if c.ContainerID != containerID.ID {
+				continue
+			}
+
+			if c.Phase == StatusRunning {
+				return fmt.Errorf("cannot delete running container %s of pod %s", containerID.ID, podInfo.PodName)
+			}
+
+			// Serialize with syncs and deletes of the same pod.
+			r.podLocks.lock(podInfo.PodName)
+			defer r.podLocks.unlock(podInfo.PodName)
+
+			containerName, _, _, err := r.containerMetadata(c.Name, containerSpecLabels(podInfo.PodInfo.Spec, c.ContainerID))
+			if err != nil {
+				return err
+			}
+
+			if err := r.archiveOneContainerLog(podInfo.PodName, containerName, c.ContainerID); err != nil {
+				glog.Warningf("Hyper: %v", err)
+			}
+
+			symlinkFile := LogSymlink(r.containerLogsDir, podInfo.PodName, containerName, c.ContainerID)
+			if err := os.Remove(symlinkFile); err != nil && !os.IsNotExist(err) {
+				glog.Warningf("Failed to remove container log symlink %q: %v", symlinkFile, err)
+			}
+
+			r.prunePreviousLogs()
+			return nil
+		}
+	}
+
+	// Idempotence: the record may already be gone with its pod.
+	glog.V(4).Infof("Hyper: container %s is already gone from hyperd", containerID.ID)
+	return nil
+}
@@ -0,0 +1,79 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyper
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"k8s.io/kubernetes/pkg/api"
+)
+
+const (
+	// Annotation overriding the resolver options line of the generated
+	// resolv.conf, as space-separated options, e.g. "ndots:2 timeout:1".
+	resolverOptionsAnnotation = "hyper.sh/resolver-options"
+
+	// Default ndots of cluster-first DNS; service names like
+	// "svc.namespace" must hit the search path before the root servers.
+	defaultResolverOptions = "ndots:5"
+
+	// Name of the generated resolv.conf file in the pod spec.
+	guestResolvConfName = "k8s-managed-resolv-conf"
+)
+
+// guestResolvConf renders the pod's full resolver configuration — servers,
+// search domains and options — as a guest file mounted over /etc/resolv.conf.
+// The plain dns list of the pod spec only carries nameservers; search domains
+// and ndots would be dropped without this file. The servers and searches
+// already honor the pod's dnsPolicy: with Default they are the node's own
+// resolver settings. Nil is returned when there is nothing to configure.
+func guestResolvConf(pod *api.Pod, dnsServers, dnsSearches []string) (map[string]interface{}, map[string]interface{}) {
+	if len(dnsServers) == 0 && len(dnsSearches) == 0 {
+		return nil, nil
+	}
+
+	var content bytes.Buffer
+	for _, server := range dnsServers {
+		fmt.Fprintf(&content, "nameserver %s\n", server)
+	}
+	if len(dnsSearches) > 0 {
+		fmt.Fprintf(&content, "search %s\n", strings.Join(dnsSearches, " "))
+	}
+
+	options := pod.Annotations[resolverOptionsAnnotation]
+	if options == "" && len(dnsSearches) > 0 {
+		options = defaultResolverOptions
+	}
+	if options != "" {
+		fmt.Fprintf(&content, "options %s\n", options)
+	}
+
+	podFile := map[string]interface{}{
+		KEY_NAME:     guestResolvConfName,
+		KEY_ENCODING: "base64",
+		KEY_CONTENT:  base64.StdEncoding.EncodeToString(content.Bytes()),
+	}
+	containerFile := map[string]interface{}{
+		KEY_FILENAME:  guestResolvConfName,
+		KEY_MOUNTPATH: "/etc/resolv.conf",
+		KEY_PERM:      "0644",
+	}
+	return podFile, containerFile
+}
@@ -0,0 +1,106 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyper
+
+import (
+	"fmt"
+
+	"k8s.io/kubernetes/pkg/api"
+	clientset "k8s.io/kubernetes/pkg/client/clientset_generated/internalclientset"
+	"k8s.io/kubernetes/pkg/fieldpath"
+	kubecontainer "k8s.io/kubernetes/pkg/kubelet/container"
+	"k8s.io/kubernetes/third_party/golang/expansion"
+)
+
+// resolveContainerEnv computes the environment of a container the way the
+// kubelet does — literal values with $(VAR) expansion, downward-API field
+// refs, and ConfigMap/Secret key refs fetched through the kubeClient — for
+// runtimes built without a kubelet around them. Service environment
+// variables are not synthesized; standalone consumers have no service view.
+// A nil kubeClient resolves everything except the key refs, which fail
+// rather than silently producing empty values.
+func resolveContainerEnv(kubeClient clientset.Interface, pod *api.Pod, container *api.Container) ([]kubecontainer.EnvVar, error) {
+	var result []kubecontainer.EnvVar
+
+	var (
+		tmpEnv      = make(map[string]string)
+		configMaps  = make(map[string]*api.ConfigMap)
+		secrets     = make(map[string]*api.Secret)
+		mappingFunc = expansion.MappingFuncFor(tmpEnv)
+	)
+	for _, envVar := range container.Env {
+		runtimeVal := envVar.Value
+		if runtimeVal != "" {
+			runtimeVal = expansion.Expand(runtimeVal, mappingFunc)
+		} else if envVar.ValueFrom != nil {
+			var err error
+			switch {
+			case envVar.ValueFrom.FieldRef != nil:
+				internalFieldPath, _, err := api.Scheme.ConvertFieldLabel(envVar.ValueFrom.FieldRef.APIVersion, "Pod", envVar.ValueFrom.FieldRef.FieldPath, "")
+				if err != nil {
+					return result, err
+				}
+				runtimeVal, err = fieldpath.ExtractFieldPathAsString(pod, internalFieldPath)
+				if err != nil {
+					return result, err
+				}
+			case envVar.ValueFrom.ConfigMapKeyRef != nil:
+				name := envVar.ValueFrom.ConfigMapKeyRef.Name
+				key := envVar.ValueFrom.ConfigMapKeyRef.Key
+				if kubeClient == nil {
+					return result, fmt.Errorf("env var %s references ConfigMap %s but no kubeClient is configured", envVar.Name, name)
+				}
+				configMap, ok := configMaps[name]
+				if !ok {
+					configMap, err = kubeClient.Core().ConfigMaps(pod.Namespace).Get(name)
+					if err != nil {
+						return result, err
+					}
+					configMaps[name] = configMap
+				}
+				runtimeVal, ok = configMap.Data[key]
+				if !ok {
+					return result, fmt.Errorf("couldn't find key %v in ConfigMap %v/%v", key, pod.Namespace, name)
+				}
+			case envVar.ValueFrom.SecretKeyRef != nil:
+				name := envVar.ValueFrom.SecretKeyRef.Name
+				key := envVar.ValueFrom.SecretKeyRef.Key
+				if kubeClient == nil {
+					return result, fmt.Errorf("env var %s references Secret %s but no kubeClient is configured", envVar.Name, name)
+				}
+				secret, ok := secrets[name]
+				if !ok {
+					secret, err = kubeClient.Core().Secrets(pod.Namespace).Get(name)
+					if err != nil {
+						return result, err
+					}
+					secrets[name] = secret
+				}
+				runtimeValBytes, ok := secret.Data[key]
+				if !ok {
+					return result, fmt.Errorf("couldn't find key %v in Secret %v/%v", key, pod.Namespace, name)
+				}
+				runtimeVal = string(runtimeValBytes)
+			}
+		}
+
+		tmpEnv[envVar.Name] = runtimeVal
+		result = append(result, kubecontainer.EnvVar{Name: envVar.Name, Value: runtimeVal})
+	}
+
+	return result, nil
+}
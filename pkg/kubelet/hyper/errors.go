@@ -0,0 +1,144 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyper
+
+import (
+	"errors"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+)
+
+// hyperd reports most failures as opaque strings, so callers used to be
+// unable to tell a missing image from a crashed daemon. The client classifies
+// errors into a small taxonomy at the RPC boundary; callers test with the
+// Is* predicates and keep the original message for logging.
+
+var (
+	// ErrImageNotFound marks a reference to an image hyperd does not have.
+	ErrImageNotFound = errors.New("image not found")
+
+	// ErrPodNotFound marks a reference to a pod hyperd does not know.
+	ErrPodNotFound = errors.New("pod not found")
+
+	// ErrConflict marks an attempt to create something that already exists.
+	ErrConflict = errors.New("already exists")
+
+	// ErrDaemonUnavailable marks failures to reach hyperd at all.
+	ErrDaemonUnavailable = errors.New("hyperd unavailable")
+)
+
+// Event reasons for classified failures.
+const (
+	reasonImageNotFound      = "ImageNotFound"
+	reasonRuntimeUnavailable = "RuntimeUnavailable"
+)
+
+// hyperError pairs a taxonomy kind with the original error from hyperd.
+type hyperError struct {
+	kind  error
+	cause error
+}
+
+func (e *hyperError) Error() string {
+	return e.cause.Error()
+}
+
+// classifyError wraps an error from hyperd with its taxonomy kind, judged
+// from the gRPC status code when hyperd sets one and from the message
+// otherwise. Unclassifiable errors pass through unchanged.
+func classifyError(err error) error {
+	if err == nil {
+		return nil
+	}
+	if _, ok := err.(*hyperError); ok {
+		return err
+	}
+
+	switch grpc.Code(err) {
+	case codes.AlreadyExists:
+		return &hyperError{kind: ErrConflict, cause: err}
+	case codes.Unavailable, codes.DeadlineExceeded:
+		return &hyperError{kind: ErrDaemonUnavailable, cause: err}
+	}
+
+	// Older hyperd versions return everything as codes.Unknown; fall back
+	// to the message.
+	msg := strings.ToLower(err.Error())
+	switch {
+	case strings.Contains(msg, "connection refused"),
+		strings.Contains(msg, "connection error"),
+		strings.Contains(msg, "transport is closing"):
+		return &hyperError{kind: ErrDaemonUnavailable, cause: err}
+	case strings.Contains(msg, "no such image"),
+		strings.Contains(msg, "image") && strings.Contains(msg, "not found"):
+		return &hyperError{kind: ErrImageNotFound, cause: err}
+	case strings.Contains(msg, "pod") && (strings.Contains(msg, "not found") || strings.Contains(msg, "can not find") || strings.Contains(msg, "cannot find")):
+		return &hyperError{kind: ErrPodNotFound, cause: err}
+	case strings.Contains(msg, "already exist"):
+		return &hyperError{kind: ErrConflict, cause: err}
+	}
+
+	return err
+}
+
+// errorKind returns the taxonomy kind of an error, or nil for unclassified
+// errors.
+func errorKind(err error) error {
+	if hErr, ok := err.(*hyperError); ok {
+		return hErr.kind
+	}
+	for _, kind := range []error{ErrImageNotFound, ErrPodNotFound, ErrConflict, ErrDaemonUnavailable} {
+		if err == kind {
+			return kind
+		}
+	}
+	return nil
+}
+
+// IsImageNotFound reports whether the error means hyperd lacks the image.
+func IsImageNotFound(err error) bool {
+	return errorKind(err) == ErrImageNotFound
+}
+
+// IsPodNotFound reports whether the error means hyperd lacks the pod.
+func IsPodNotFound(err error) bool {
+	return errorKind(err) == ErrPodNotFound
+}
+
+// IsConflict reports whether the error means the resource already exists.
+func IsConflict(err error) bool {
+	return errorKind(err) == ErrConflict
+}
+
+// IsDaemonUnavailable reports whether the error means hyperd is unreachable.
+func IsDaemonUnavailable(err error) bool {
+	return errorKind(err) == ErrDaemonUnavailable
+}
+
+// errorEventReason maps a classified error to the event reason shown to
+// users, falling back to the caller's generic reason.
+func errorEventReason(err error, fallback string) string {
+	switch errorKind(err) {
+	case ErrImageNotFound:
+		return reasonImageNotFound
+	case ErrDaemonUnavailable:
+		return reasonRuntimeUnavailable
+	}
+	return fallback
+}
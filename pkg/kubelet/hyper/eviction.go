@@ -0,0 +1,178 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyper
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"k8s.io/kubernetes/pkg/util/wait"
+)
+
+// Per-pod resource usage for the kubelet eviction manager. Hyper pods run in
+// VMs, so cadvisor sees one opaque qemu process per pod and the eviction
+// manager would be blind to them; this collector fills the gap with hyperd's
+// own stats plus the node-side log footprint.
+
+// How often per-pod eviction stats are collected.
+const evictionStatsInterval = time.Minute
+
+// podEvictionStats is the usage of one pod as ranked under node pressure.
+type podEvictionStats struct {
+	Pod                   string `json:"pod"`
+	MemoryUsageBytes      uint64 `json:"memoryUsageBytes"`
+	MemoryWorkingSetBytes uint64 `json:"memoryWorkingSetBytes"`
+	RootfsBytes           int64  `json:"rootfsBytes"`
+	LogsBytes             int64  `json:"logsBytes"`
+}
+
+var (
+	podMemoryWorkingSet = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Subsystem: "hyper",
+			Name:      "pod_memory_working_set_bytes",
+			Help:      "Working set of the pod VM in bytes, as reported by hyperd.",
+		},
+		[]string{"pod"},
+	)
+	podDiskUsage = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Subsystem: "hyper",
+			Name:      "pod_disk_usage_bytes",
+			Help:      "Disk usage of the pod in bytes: guest rootfs plus node-side container logs.",
+		},
+		[]string{"pod"},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(podMemoryWorkingSet)
+	prometheus.MustRegister(podDiskUsage)
+}
+
+// evictionStatsCache is the last collected usage per pod, kept for the debug
+// endpoint.
+type evictionStatsCache struct {
+	sync.Mutex
+	stats map[string]*podEvictionStats
+}
+
+// startEvictionStatsCollector periodically collects per-pod memory and disk
+// usage for eviction decisions.
+func (r *runtime) startEvictionStatsCollector() {
+	go wait.Until(r.collectEvictionStats, evictionStatsInterval, wait.NeverStop)
+}
+
+// collectEvictionStats gathers memory usage from hyperd's pod stats, rootfs
+// usage from the storage monitor and log usage from the node-side log files,
+// then exports all of it as per-pod metrics.
+func (r *runtime) collectEvictionStats() {
+	podInfos, err := r.hyperClient.ListPods()
+	if err != nil {
+		glog.Warningf("Hyper: eviction stats: ListPods failed: %v", err)
+		return
+	}
+
+	r.storageLock.Lock()
+	rootfsUsage := make(map[string]int64, len(r.storageUsage))
+	for podName, usedBytes := range r.storageUsage {
+		rootfsUsage[podName] = usedBytes
+	}
+	r.storageLock.Unlock()
+
+	logUsage := r.containerLogUsage()
+
+	stats := make(map[string]*podEvictionStats)
+	for _, podInfo := range podInfos {
+		if podInfo.Status != StatusRunning {
+			continue
+		}
+
+		usage := &podEvictionStats{
+			Pod:         podInfo.PodName,
+			RootfsBytes: rootfsUsage[podInfo.PodName],
+			LogsBytes:   logUsage[podInfo.PodName],
+		}
+		if podStats, err := r.hyperClient.GetPodStats(podInfo.PodID); err == nil {
+			if podStats != nil && podStats.Memory != nil {
+				usage.MemoryUsageBytes = podStats.Memory.Usage
+				usage.MemoryWorkingSetBytes = podStats.Memory.WorkingSet
+			}
+		} else {
+			glog.V(4).Infof("Hyper: eviction stats: PodStats of pod %s failed: %v", podInfo.PodName, err)
+		}
+
+		podMemoryWorkingSet.WithLabelValues(podInfo.PodName).Set(float64(usage.MemoryWorkingSetBytes))
+		podDiskUsage.WithLabelValues(podInfo.PodName).Set(float64(usage.RootfsBytes + usage.LogsBytes))
+		stats[podInfo.PodName] = usage
+	}
+
+	r.evictionStats.Lock()
+	for podName := range r.evictionStats.stats {
+		if _, ok := stats[podName]; !ok {
+			podMemoryWorkingSet.DeleteLabelValues(podName)
+			podDiskUsage.DeleteLabelValues(podName)
+		}
+	}
+	r.evictionStats.stats = stats
+	r.evictionStats.Unlock()
+}
+
+// containerLogUsage sums the sizes of the node-side container log files per
+// pod. Log file names start with the pod full name, see LogSymlink.
+func (r *runtime) containerLogUsage() map[string]int64 {
+	usage := make(map[string]int64)
+	files, err := ioutil.ReadDir(r.containerLogsDir)
+	if err != nil {
+		return usage
+	}
+
+	for _, file := range files {
+		sep := strings.Index(file.Name(), "_")
+		if sep <= 0 {
+			continue
+		}
+		podFullName := file.Name()[:sep] + "_" + strings.SplitN(file.Name()[sep+1:], "_", 2)[0]
+		// The log files are symlinks into hyperd's log directory; count
+		// the target size.
+		size := file.Size()
+		if info, err := os.Stat(path.Join(r.containerLogsDir, file.Name())); err == nil {
+			size = info.Size()
+		}
+		usage[podFullName] += size
+	}
+	return usage
+}
+
+// getEvictionStats returns the last collected per-pod usage.
+func (r *runtime) getEvictionStats() []*podEvictionStats {
+	r.evictionStats.Lock()
+	defer r.evictionStats.Unlock()
+
+	result := make([]*podEvictionStats, 0, len(r.evictionStats.stats))
+	for _, usage := range r.evictionStats.stats {
+		result = append(result, usage)
+	}
+	return result
+}
@@ -0,0 +1,100 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyper
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/golang/glog"
+	"google.golang.org/grpc"
+
+	grpctypes "k8s.io/kubernetes/pkg/kubelet/hyper/types"
+)
+
+// Endpoint failover. A node can run a standby hyperd — a second daemon or
+// one on a peer in a shared-storage setup — and the client switches to it
+// when the primary stays unreachable through a whole retry cycle, instead
+// of failing a sync loop's worth of pods. The retry machinery in retry.go
+// replays idempotent calls against the new endpoint; switching back is
+// symmetric when the standby fails in turn.
+
+// hyperEndpoint is one dialed hyperd endpoint.
+type hyperEndpoint struct {
+	server string
+	client grpctypes.PublicAPIClient
+}
+
+// api returns the currently active gRPC client.
+func (c *HyperClient) api() grpctypes.PublicAPIClient {
+	c.failoverLock.RLock()
+	defer c.failoverLock.RUnlock()
+	return c.client
+}
+
+// addStandby dials a standby hyperd endpoint for failover. The standby uses
+// the same TLS configuration as the primary.
+func (c *HyperClient) addStandby(server string, tlsConfig *TLSConfig) error {
+	if server == "" {
+		return nil
+	}
+
+	dialOption := grpc.WithInsecure()
+	if tlsConfig != nil {
+		creds, err := newTransportCredentials(tlsConfig)
+		if err != nil {
+			return err
+		}
+		dialOption = grpc.WithTransportCredentials(creds)
+	}
+	conn, err := grpc.Dial(server, dialOption)
+	if err != nil {
+		return fmt.Errorf("cannot dial standby hyperd %s: %v", server, err)
+	}
+
+	c.failoverLock.Lock()
+	defer c.failoverLock.Unlock()
+	c.endpoints = []hyperEndpoint{
+		{server: c.server, client: c.client},
+		{server: server, client: grpctypes.NewPublicAPIClient(conn)},
+	}
+	c.active = 0
+	return nil
+}
+
+// failover switches the client to the other endpoint, reporting whether a
+// switch happened. The breaker state is reset: the new endpoint deserves a
+// fresh verdict.
+func (c *HyperClient) failover() bool {
+	c.failoverLock.Lock()
+	defer c.failoverLock.Unlock()
+	if len(c.endpoints) < 2 {
+		return false
+	}
+
+	c.active = 1 - c.active
+	c.client = c.endpoints[c.active].client
+	c.server = c.endpoints[c.active].server
+	glog.Warningf("Hyper: failing over to hyperd endpoint %s", c.server)
+
+	c.breaker.Lock()
+	c.breaker.failures = 0
+	c.breaker.openUntil = time.Time{}
+	c.breaker.Unlock()
+
+	return true
+}
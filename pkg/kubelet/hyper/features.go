@@ -0,0 +1,122 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyper
+
+// Feature gates of the optional runtime subsystems. Operators flip them via
+// the featureGates map of the runtime configuration file, e.g.
+// {"featureGates": {"ClockDriftMonitor": false}}; the map is hot-reloadable,
+// but gates are consulted at kubelet startup, so changing one requires a
+// kubelet restart to take effect.
+const (
+	// FeatureOrphanReconciler removes VMs whose API pods are gone.
+	FeatureOrphanReconciler = "OrphanReconciler"
+
+	// FeatureClockDriftMonitor measures guest clock drift and exports it.
+	FeatureClockDriftMonitor = "ClockDriftMonitor"
+
+	// FeatureDeadlineEnforcer enforces activeDeadlineSeconds at the
+	// runtime level.
+	FeatureDeadlineEnforcer = "DeadlineEnforcer"
+
+	// FeatureLogDriver mirrors container output into node-side JSON log
+	// files.
+	FeatureLogDriver = "LogDriver"
+
+	// FeatureJobReaper releases the VMs of succeeded run-to-completion
+	// pods early.
+	FeatureJobReaper = "JobReaper"
+
+	// FeatureImagePrefetch accepts image pre-seeding hints on the debug
+	// endpoint.
+	FeatureImagePrefetch = "ImagePrefetch"
+
+	// FeatureStorageMonitor measures guest rootfs usage and enforces
+	// ephemeral-storage caps.
+	FeatureStorageMonitor = "StorageMonitor"
+
+	// FeatureDebugContainers accepts debug container injection on the
+	// debug endpoint.
+	FeatureDebugContainers = "DebugContainers"
+
+	// FeatureAgentHeartbeat pings the guest agent of running pods and
+	// marks pods with an unresponsive agent NotReady.
+	FeatureAgentHeartbeat = "AgentHeartbeat"
+
+	// FeatureEvictionStats collects per-pod memory and disk usage for the
+	// kubelet eviction manager.
+	FeatureEvictionStats = "EvictionStats"
+
+	// FeatureVMTemplatePool keeps standby VMs pre-booted for faster pod
+	// startup.
+	FeatureVMTemplatePool = "VMTemplatePool"
+
+	// FeatureKernelCache deduplicates identical guest kernel and initrd
+	// files into a content-addressed store.
+	FeatureKernelCache = "KernelCache"
+
+	// FeatureTenantAccounting aggregates allocated VM resources per
+	// Keystone tenant and enforces configured node-level tenant caps.
+	FeatureTenantAccounting = "TenantAccounting"
+
+	// FeatureVolumeResize grows the filesystem of resized PVCs from
+	// inside the guest without restarting the pod.
+	FeatureVolumeResize = "VolumeResize"
+
+	// FeatureVolumeStats measures per-volume filesystem usage inside the
+	// guest for the volume stats metrics.
+	FeatureVolumeStats = "VolumeStats"
+
+	// FeatureSnapshotHooks accepts fsfreeze and thaw requests on the debug
+	// endpoint for crash-consistent volume snapshots.
+	FeatureSnapshotHooks = "SnapshotHooks"
+)
+
+// defaultFeatureGates is the state of each gate when the configuration does
+// not mention it. Established subsystems default to on; gates default to off
+// only while their subsystem is still maturing.
+var defaultFeatureGates = map[string]bool{
+	FeatureOrphanReconciler:  true,
+	FeatureClockDriftMonitor: true,
+	FeatureDeadlineEnforcer:  true,
+	FeatureLogDriver:         true,
+	FeatureJobReaper:         true,
+	FeatureImagePrefetch:     true,
+	FeatureStorageMonitor:    true,
+	// Injecting containers into running VMs is invasive; opt in explicitly.
+	FeatureDebugContainers: false,
+	FeatureAgentHeartbeat:  true,
+	FeatureEvictionStats:   true,
+	// Standby VMs hold node memory; opt in explicitly and size the pool
+	// via vmPoolSize.
+	FeatureVMTemplatePool:   false,
+	FeatureKernelCache:      true,
+	FeatureTenantAccounting: true,
+	// Executes commands in guests automatically; opt in explicitly.
+	FeatureVolumeResize: false,
+	FeatureVolumeStats:  true,
+	// Freezing filesystems blocks every writer in the pod; opt in explicitly.
+	FeatureSnapshotHooks: false,
+}
+
+// featureEnabled reports whether a runtime subsystem is enabled, considering
+// the configured gates first and the defaults second. Unknown names are off.
+func (r *runtime) featureEnabled(feature string) bool {
+	if enabled, ok := r.configManager.getConfig().FeatureGates[feature]; ok {
+		return enabled
+	}
+	return defaultFeatureGates[feature]
+}
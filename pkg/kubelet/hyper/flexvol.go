@@ -0,0 +1,49 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyper
+
+import (
+	"os"
+
+	"github.com/golang/glog"
+)
+
+// FlexVolume drivers come in two shapes: some only materialize a host mount
+// — those go through the vfs path like any other directory — and some attach
+// a block device first. For the latter the flexvolume plugin reports the
+// device path from the driver's attach call, and the runtime hands that
+// device to hyperd directly, the same way iSCSI LUNs are attached.
+
+// buildFlexVolume fills in a hyperd volume attaching the driver-reported
+// block device to the VM. It reports false — leaving the volume to the vfs
+// fallback — when the device is missing from the metadata or not present on
+// the host.
+func (r *runtime) buildFlexVolume(v map[string]interface{}, metadata map[string]interface{}) bool {
+	device, _ := metadata["device"].(string)
+	if device == "" {
+		return false
+	}
+
+	if _, err := os.Stat(device); err != nil {
+		glog.Warningf("Hyper: FlexVolume device %s of volume %v not present on host, falling back to vfs: %v", device, v[KEY_NAME], err)
+		return false
+	}
+
+	v[KEY_VOLUME_DRIVE] = VOLUME_TYPE_RAW
+	v[KEY_VOLUME_SOURCE] = device
+	return true
+}
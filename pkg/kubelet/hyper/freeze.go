@@ -0,0 +1,182 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyper
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/golang/glog"
+
+	kubecontainer "k8s.io/kubernetes/pkg/kubelet/container"
+)
+
+// Volume snapshot hooks. Cinder and Ceph snapshot attached volumes on the
+// storage backend, underneath a guest that keeps writing — without
+// quiescing, the snapshot is merely crash-consistent at best. The hooks
+// below fsfreeze the volume filesystems from inside the guest before the
+// backend takes the snapshot and thaw them afterwards, driven by the
+// backup tooling through the debug endpoint.
+
+// A freeze that is never thawed wedges every writer in the pod; thaw
+// happens automatically after this long.
+const freezeMaxDuration = 2 * time.Minute
+
+// frozenMount is one frozen volume filesystem inside a guest.
+type frozenMount struct {
+	containerID string
+	path        string
+}
+
+// frozenPod is the frozen state of one pod, kept so thaw releases exactly
+// the filesystems freeze took.
+type frozenPod struct {
+	mounts   []frozenMount
+	frozenAt time.Time
+}
+
+// freezePodVolumes freezes the volume filesystems of a running pod for a
+// backend snapshot. Either every volume freezes or none stays frozen: a
+// partial freeze is thawed again and reported as failure.
+func (r *runtime) freezePodVolumes(podFullName string) error {
+	r.freezeLock.Lock()
+	defer r.freezeLock.Unlock()
+
+	if _, frozen := r.frozenPods[podFullName]; frozen {
+		return fmt.Errorf("volumes of pod %s are already frozen", podFullName)
+	}
+
+	mounts, err := r.podVolumeMounts(podFullName)
+	if err != nil {
+		return err
+	}
+	if len(mounts) == 0 {
+		return fmt.Errorf("pod %s has no volume mounts to freeze", podFullName)
+	}
+
+	var frozen []frozenMount
+	for _, mount := range mounts {
+		if output, err := r.RunInContainer(kubecontainer.ContainerID{Type: typeHyper, ID: mount.containerID},
+			[]string{"fsfreeze", "-f", mount.path}); err != nil {
+			r.thawMounts(frozen)
+			return fmt.Errorf("freezing %s failed: %v: %s", mount.path, err, string(output))
+		}
+		frozen = append(frozen, mount)
+	}
+
+	if r.frozenPods == nil {
+		r.frozenPods = make(map[string]*frozenPod)
+	}
+	state := &frozenPod{mounts: frozen, frozenAt: time.Now()}
+	r.frozenPods[podFullName] = state
+	glog.V(2).Infof("Hyper: froze %d volume filesystems of pod %s for snapshot", len(frozen), podFullName)
+
+	// Safety net against backup tooling that freezes and dies.
+	time.AfterFunc(freezeMaxDuration, func() {
+		r.freezeLock.Lock()
+		defer r.freezeLock.Unlock()
+		if r.frozenPods[podFullName] != state {
+			return
+		}
+		glog.Warningf("Hyper: volumes of pod %s were frozen for over %v without a thaw, thawing", podFullName, freezeMaxDuration)
+		r.thawMounts(state.mounts)
+		delete(r.frozenPods, podFullName)
+	})
+
+	return nil
+}
+
+// thawPodVolumes thaws the volume filesystems a previous freeze took.
+func (r *runtime) thawPodVolumes(podFullName string) error {
+	r.freezeLock.Lock()
+	defer r.freezeLock.Unlock()
+
+	state, frozen := r.frozenPods[podFullName]
+	if !frozen {
+		return fmt.Errorf("volumes of pod %s are not frozen", podFullName)
+	}
+	delete(r.frozenPods, podFullName)
+
+	if err := r.thawMounts(state.mounts); err != nil {
+		return err
+	}
+	glog.V(2).Infof("Hyper: thawed volume filesystems of pod %s after %v", podFullName, time.Since(state.frozenAt))
+	return nil
+}
+
+// thawMounts unfreezes a set of frozen filesystems, continuing past
+// individual failures so one stuck volume cannot keep the others frozen.
+func (r *runtime) thawMounts(mounts []frozenMount) error {
+	var lastErr error
+	for _, mount := range mounts {
+		if output, err := r.RunInContainer(kubecontainer.ContainerID{Type: typeHyper, ID: mount.containerID},
+			[]string{"fsfreeze", "-u", mount.path}); err != nil {
+			glog.Warningf("Hyper: thawing %s failed: %v: %s", mount.path, err, string(output))
+			lastErr = fmt.Errorf("thawing %s failed: %v", mount.path, err)
+		}
+	}
+	return lastErr
+}
+
+// podVolumeMounts resolves the volume mount paths of a running pod together
+// with a running container to execute in for each, deduplicated by path.
+func (r *runtime) podVolumeMounts(podFullName string) ([]frozenMount, error) {
+	if r.kubeClient == nil {
+		return nil, fmt.Errorf("no API client available")
+	}
+	name, namespace, err := kubecontainer.ParsePodFullName(podFullName)
+	if err != nil {
+		return nil, err
+	}
+	pod, err := r.kubeClient.Core().Pods(namespace).Get(name)
+	if err != nil {
+		return nil, err
+	}
+
+	podInfos, err := r.hyperClient.ListPodsByNames([]string{podFullName})
+	if err != nil {
+		return nil, err
+	}
+	if len(podInfos) == 0 || podInfos[0].Status != StatusRunning {
+		return nil, fmt.Errorf("pod %s is not running", podFullName)
+	}
+	podInfo := &podInfos[0]
+
+	var mounts []frozenMount
+	seen := make(map[string]bool)
+	for _, container := range pod.Spec.Containers {
+		var containerID string
+		for _, c := range podInfo.PodInfo.Status.ContainerStatus {
+			parsedName, _, _, err := r.containerMetadata(c.Name, containerSpecLabels(podInfo.PodInfo.Spec, c.ContainerID))
+			if err == nil && parsedName == container.Name && c.Phase == StatusRunning {
+				containerID = c.ContainerID
+				break
+			}
+		}
+		if containerID == "" {
+			continue
+		}
+		for _, mount := range container.VolumeMounts {
+			if seen[mount.MountPath] {
+				continue
+			}
+			seen[mount.MountPath] = true
+			mounts = append(mounts, frozenMount{containerID: containerID, path: mount.MountPath})
+		}
+	}
+	return mounts, nil
+}
@@ -0,0 +1,131 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyper
+
+import (
+	"io/ioutil"
+	"time"
+
+	"github.com/golang/glog"
+
+	kubecontainer "k8s.io/kubernetes/pkg/kubelet/container"
+)
+
+// gcPodReport describes one pod the garbage collector would remove.
+type gcPodReport struct {
+	Name       string `json:"name"`
+	ID         string `json:"id"`
+	Status     string `json:"status"`
+	FinishedAt string `json:"finishedAt"`
+	AgeSeconds int64  `json:"ageSeconds"`
+}
+
+// gcImageReport describes one image no pod references anymore.
+type gcImageReport struct {
+	Repository string `json:"repository"`
+	Tag        string `json:"tag"`
+	SizeBytes  int64  `json:"sizeBytes"`
+}
+
+// gcReport is what a GarbageCollect run would remove, without removing it.
+type gcReport struct {
+	Time               time.Time       `json:"time"`
+	MinAge             string          `json:"minAge"`
+	Pods               []gcPodReport   `json:"pods"`
+	SpecFiles          []specFileInfo  `json:"specFiles"`
+	UnreferencedImages []gcImageReport `json:"unreferencedImages"`
+	TotalImageBytes    int64           `json:"totalImageBytes"`
+}
+
+// gcDryRun reports which VMs and which unreferenced images a GarbageCollect
+// run with the given minimum age would remove. Nothing is deleted; operators
+// use the report to judge a GC policy before enabling it.
+func (r *runtime) gcDryRun(minAge time.Duration) (*gcReport, error) {
+	report := &gcReport{Time: time.Now(), MinAge: minAge.String()}
+
+	podInfos, err := r.hyperClient.ListPods()
+	if err != nil {
+		return nil, err
+	}
+
+	referenced := make(map[string]bool)
+	knownPods := make(map[string]bool)
+	for _, pod := range podInfos {
+		knownPods[pod.PodName] = true
+		for _, c := range pod.PodInfo.Spec.Containers {
+			repo, tag := parseImageName(c.Image)
+			referenced[repo+":"+tag] = true
+		}
+
+		if _, _, err := kubecontainer.ParsePodFullName(pod.PodName); err != nil {
+			continue
+		}
+		if pod.Status == StatusRunning {
+			continue
+		}
+		finishedAt, err := parseTimeString(pod.PodInfo.Status.FinishTime)
+		if err != nil {
+			continue
+		}
+		if !finishedAt.Before(time.Now().Add(-minAge)) {
+			continue
+		}
+
+		report.Pods = append(report.Pods, gcPodReport{
+			Name:       pod.PodName,
+			ID:         pod.PodID,
+			Status:     pod.Status,
+			FinishedAt: pod.PodInfo.Status.FinishTime,
+			AgeSeconds: int64(time.Since(finishedAt).Seconds()),
+		})
+		delete(knownPods, pod.PodName)
+	}
+
+	// Spec checkpoints of the pods above, plus checkpoints of pods hyperd
+	// no longer knows about.
+	if files, err := ioutil.ReadDir(r.specDir); err == nil {
+		for _, file := range files {
+			if knownPods[file.Name()] {
+				continue
+			}
+			report.SpecFiles = append(report.SpecFiles, specFileInfo{
+				Name:    file.Name(),
+				Size:    file.Size(),
+				ModTime: file.ModTime(),
+			})
+		}
+	}
+
+	if images, err := r.hyperClient.ListImages(); err == nil {
+		for _, image := range images {
+			if referenced[image.repository+":"+image.tag] {
+				continue
+			}
+			report.UnreferencedImages = append(report.UnreferencedImages, gcImageReport{
+				Repository: image.repository,
+				Tag:        image.tag,
+				SizeBytes:  image.virtualSize,
+			})
+			report.TotalImageBytes += image.virtualSize
+		}
+	}
+
+	glog.V(2).Infof("Hyper: GC dry run (minAge %v): %d pods, %d spec files and %d unreferenced images (%d bytes) would be removed",
+		minAge, len(report.Pods), len(report.SpecFiles), len(report.UnreferencedImages), report.TotalImageBytes)
+
+	return report, nil
+}
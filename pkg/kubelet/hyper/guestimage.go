@@ -0,0 +1,82 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyper
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"k8s.io/kubernetes/pkg/api"
+)
+
+// Selectable guest OS images. The default guest kernel is minimal; pods
+// needing extra modules — NFS or iSCSI clients, GPU drivers — can select an
+// alternative bundle by name. A bundle is a subdirectory of GuestKernelDir
+// holding a kernel and initrd.img, and only bundles on the operator's
+// allowlist may be selected: the guest kernel is the pod's security
+// boundary, so the choice is an operator decision, not a user one.
+
+const (
+	// Annotation naming the guest image bundle a pod boots with.
+	guestImageAnnotation = "hyper.sh/guest-image"
+
+	// Runtime-internal labels carrying the resolved boot file paths to
+	// hyperd.
+	guestKernelLabel = "sh.hyper.kernel"
+	guestInitrdLabel = "sh.hyper.initrd"
+)
+
+// guestImagePaths resolves the guest image annotation of a pod to kernel and
+// initrd paths, validated against the configured allowlist. Pods without the
+// annotation get ("", "", nil) and boot the default guest image.
+func (r *runtime) guestImagePaths(pod *api.Pod) (string, string, error) {
+	bundle, ok := pod.Annotations[guestImageAnnotation]
+	if !ok || bundle == "" {
+		return "", "", nil
+	}
+	if strings.ContainsAny(bundle, "/\\") || bundle == "." || bundle == ".." {
+		return "", "", fmt.Errorf("invalid guest image name %q in annotation %s", bundle, guestImageAnnotation)
+	}
+
+	config := r.configManager.getConfig()
+	allowed := false
+	for _, name := range config.AllowedGuestImages {
+		if name == bundle {
+			allowed = true
+			break
+		}
+	}
+	if !allowed {
+		return "", "", fmt.Errorf("guest image %q is not in the configured allowlist", bundle)
+	}
+	if config.GuestKernelDir == "" {
+		return "", "", fmt.Errorf("guest image %q selected but no guestKernelDir is configured", bundle)
+	}
+
+	kernel := filepath.Join(config.GuestKernelDir, bundle, "kernel")
+	initrd := filepath.Join(config.GuestKernelDir, bundle, "initrd.img")
+	if _, err := os.Stat(kernel); err != nil {
+		return "", "", fmt.Errorf("guest image %q has no kernel: %v", bundle, err)
+	}
+	if _, err := os.Stat(initrd); err != nil {
+		return "", "", fmt.Errorf("guest image %q has no initrd.img: %v", bundle, err)
+	}
+
+	return kernel, initrd, nil
+}
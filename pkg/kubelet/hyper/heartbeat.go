@@ -0,0 +1,151 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyper
+
+import (
+	"time"
+
+	"github.com/golang/glog"
+
+	"k8s.io/kubernetes/pkg/api"
+	kubecontainer "k8s.io/kubernetes/pkg/kubelet/container"
+	proberesults "k8s.io/kubernetes/pkg/kubelet/prober/results"
+	"k8s.io/kubernetes/pkg/types"
+	"k8s.io/kubernetes/pkg/util/wait"
+)
+
+const (
+	// How often the guest agent of each running pod is pinged.
+	agentHeartbeatInterval = 30 * time.Second
+
+	// How long a single heartbeat exec may take before it counts as a
+	// miss.
+	agentHeartbeatTimeout = 10 * time.Second
+
+	// Consecutive misses before the pod is marked NotReady. A wedged VM
+	// looks Running to hyperd forever; the misses are the only signal.
+	agentHeartbeatFailureThreshold = 3
+
+	reasonGuestAgentUnresponsive = "GuestAgentUnresponsive"
+)
+
+// startAgentHeartbeat periodically verifies that the guest agent of every
+// running pod VM still answers exec requests.
+func (r *runtime) startAgentHeartbeat() {
+	go wait.Until(r.checkAgentHeartbeats, agentHeartbeatInterval, wait.NeverStop)
+}
+
+// checkAgentHeartbeats runs a trivial command in one container of each
+// running pod. After agentHeartbeatFailureThreshold consecutive misses the
+// pod's containers are marked NotReady through the readiness manager and an
+// event is emitted; with restartOnAgentFailure set, a liveness failure is
+// injected as well, so the sync loop applies the pod's restart policy. A
+// successful heartbeat clears any override this monitor installed.
+func (r *runtime) checkAgentHeartbeats() {
+	podInfos, err := r.hyperClient.ListPods()
+	if err != nil {
+		glog.Warningf("Hyper: agent heartbeat: ListPods failed: %v", err)
+		return
+	}
+	restartOnFailure := r.configManager.getConfig().RestartOnAgentFailure
+
+	seen := make(map[string]bool, len(podInfos))
+	for _, podInfo := range podInfos {
+		if podInfo.Status != StatusRunning {
+			continue
+		}
+
+		var containerIDs []kubecontainer.ContainerID
+		for _, c := range podInfo.PodInfo.Status.ContainerStatus {
+			if c.Phase == StatusRunning {
+				containerIDs = append(containerIDs, kubecontainer.ContainerID{Type: typeHyper, ID: c.ContainerID})
+			}
+		}
+		if len(containerIDs) == 0 {
+			continue
+		}
+		seen[podInfo.PodName] = true
+
+		_, _, _, err := r.hyperClient.ExecSync(containerIDs[0].ID, []string{"true"}, agentHeartbeatTimeout)
+		if err == nil {
+			r.clearHeartbeatFailure(podInfo.PodName, containerIDs)
+			continue
+		}
+		glog.V(4).Infof("Hyper: agent heartbeat of pod %s missed: %v", podInfo.PodName, err)
+
+		r.heartbeatLock.Lock()
+		r.heartbeatMisses[podInfo.PodName]++
+		misses := r.heartbeatMisses[podInfo.PodName]
+		alreadyFailed := r.heartbeatFailed[podInfo.PodName]
+		if misses >= agentHeartbeatFailureThreshold {
+			r.heartbeatFailed[podInfo.PodName] = true
+		}
+		r.heartbeatLock.Unlock()
+
+		if misses < agentHeartbeatFailureThreshold || alreadyFailed {
+			continue
+		}
+
+		podName, podNamespace, err := kubecontainer.ParsePodFullName(podInfo.PodName)
+		if err != nil {
+			continue
+		}
+		pod := &api.Pod{ObjectMeta: api.ObjectMeta{
+			Name:      podName,
+			Namespace: podNamespace,
+			UID:       types.UID(podInfo.PodInfo.Spec.Labels[KEY_API_POD_UID]),
+		}}
+
+		for _, containerID := range containerIDs {
+			r.readinessManager.Set(containerID, proberesults.Failure, pod)
+			if restartOnFailure {
+				r.livenessManager.Set(containerID, proberesults.Failure, pod)
+			}
+		}
+		r.recorder.Eventf(pod, api.EventTypeWarning, reasonGuestAgentUnresponsive,
+			"Guest agent of pod %s missed %d consecutive heartbeats", podInfo.PodName, misses)
+	}
+
+	// Forget pods that no longer run.
+	r.heartbeatLock.Lock()
+	for podName := range r.heartbeatMisses {
+		if !seen[podName] {
+			delete(r.heartbeatMisses, podName)
+			delete(r.heartbeatFailed, podName)
+		}
+	}
+	r.heartbeatLock.Unlock()
+}
+
+// clearHeartbeatFailure resets the miss counter of a pod and removes the
+// NotReady override if this monitor installed one.
+func (r *runtime) clearHeartbeatFailure(podFullName string, containerIDs []kubecontainer.ContainerID) {
+	r.heartbeatLock.Lock()
+	failed := r.heartbeatFailed[podFullName]
+	delete(r.heartbeatMisses, podFullName)
+	delete(r.heartbeatFailed, podFullName)
+	r.heartbeatLock.Unlock()
+
+	if !failed {
+		return
+	}
+	for _, containerID := range containerIDs {
+		r.readinessManager.Remove(containerID)
+		r.livenessManager.Remove(containerID)
+	}
+	glog.V(2).Infof("Hyper: guest agent of pod %s answers heartbeats again", podFullName)
+}
@@ -0,0 +1,82 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyper
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"strings"
+
+	"k8s.io/kubernetes/pkg/api"
+)
+
+// Annotation with additional /etc/hosts entries for the guest, formatted as
+// semicolon-separated hosts lines, e.g.
+// "10.0.0.5 db master-db;10.0.0.6 cache".
+const hostAliasesAnnotation = "hyper.sh/host-aliases"
+
+// Name of the generated hosts file in the pod spec.
+const guestHostsFileName = "k8s-managed-hosts"
+
+// guestHostsFile renders a managed /etc/hosts for the guest: loopback
+// entries, the pod's own name (qualified with the headless-service domain
+// when one is set) and the annotated aliases. Whatever hosts file the image
+// ships is shadowed, so name resolution does not depend on the image. The
+// returns are the pod-level file definition and the per-container reference
+// mounting it, nil when the pod needs neither a domain nor aliases.
+func guestHostsFile(pod *api.Pod, podHostname, podDomain string) (map[string]interface{}, map[string]interface{}, error) {
+	value, ok := pod.Annotations[hostAliasesAnnotation]
+	if !ok && podDomain == "" {
+		return nil, nil, nil
+	}
+
+	var content bytes.Buffer
+	content.WriteString("# Kubernetes-managed hosts file\n")
+	content.WriteString("127.0.0.1\tlocalhost\n")
+	content.WriteString("::1\tlocalhost ip6-localhost ip6-loopback\n")
+	if podDomain != "" {
+		fmt.Fprintf(&content, "127.0.1.1\t%s.%s %s\n", podHostname, podDomain, podHostname)
+	} else {
+		fmt.Fprintf(&content, "127.0.1.1\t%s\n", podHostname)
+	}
+
+	for _, entry := range strings.Split(value, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		fields := strings.Fields(entry)
+		if len(fields) < 2 || net.ParseIP(fields[0]) == nil {
+			return nil, nil, fmt.Errorf("malformed host alias %q in annotation %s, expected \"ip hostname...\"", entry, hostAliasesAnnotation)
+		}
+		fmt.Fprintf(&content, "%s\t%s\n", fields[0], strings.Join(fields[1:], " "))
+	}
+
+	podFile := map[string]interface{}{
+		KEY_NAME:     guestHostsFileName,
+		KEY_ENCODING: "base64",
+		KEY_CONTENT:  base64.StdEncoding.EncodeToString(content.Bytes()),
+	}
+	containerFile := map[string]interface{}{
+		KEY_FILENAME:  guestHostsFileName,
+		KEY_MOUNTPATH: "/etc/hosts",
+		KEY_PERM:      "0644",
+	}
+	return podFile, containerFile, nil
+}
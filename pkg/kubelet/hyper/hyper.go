@@ -20,6 +20,7 @@ import (
 	"bytes"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -30,6 +31,7 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"syscall"
 	"time"
 
@@ -38,7 +40,6 @@ import (
 	"k8s.io/kubernetes/pkg/api/unversioned"
 	clientset "k8s.io/kubernetes/pkg/client/clientset_generated/internalclientset"
 	"k8s.io/kubernetes/pkg/client/record"
-	"k8s.io/kubernetes/pkg/credentialprovider"
 	kubecontainer "k8s.io/kubernetes/pkg/kubelet/container"
 	grpctypes "k8s.io/kubernetes/pkg/kubelet/hyper/types"
 	"k8s.io/kubernetes/pkg/kubelet/lifecycle"
@@ -56,22 +57,32 @@ const (
 	hyperMinimumVersion = "0.6.0"
 
 	typeHyper                   = "hyper"
+	hyperBinName                = "hyper"
 	hyperContainerNamePrefix    = "kube"
 	hyperDefaultContainerCPU    = 1
 	hyperDefaultContainerMem    = 128
 	hyperPodSpecDir             = "/var/lib/kubelet/hyper"
 	hyperLogsDir                = "/var/run/hyper/Pods"
 	minimumGracePeriodInSeconds = 2
+
+	// Upper bound on non-interactive execs (probes and lifecycle hooks);
+	// without it a hung probe command leaks a hyper exec process forever.
+	defaultProbeExecTimeout = time.Minute
+
+	// Pod lifecycle operations slower than this log a step-by-step trace,
+	// so a slow pod start can be attributed to image pull, VM boot or
+	// network setup without extra instrumentation.
+	podLifecycleTraceThreshold = 2 * time.Second
 )
 
 // runtime implements the container runtime for hyper
 type runtime struct {
-	dockerKeyring       credentialprovider.DockerKeyring
 	containerLogsDir    string
 	containerRefManager *kubecontainer.RefManager
 	runtimeHelper       kubecontainer.RuntimeHelper
 	recorder            record.EventRecorder
 	livenessManager     proberesults.Manager
+	readinessManager    proberesults.Manager
 	networkPlugin       network.NetworkPlugin
 	hyperClient         *HyperClient
 	kubeClient          clientset.Interface
@@ -82,6 +93,106 @@ type runtime struct {
 	// Disable the internal haproxy service in Hyper pods
 	disableHyperInternalService bool
 
+	// Node-level registry configuration (mirrors, insecure registries,
+	// per-registry CA bundles) applied to image pulls.
+	registryConfig *RegistryConfig
+
+	// Structured runtime configuration with hot-reload support.
+	configManager *configManager
+
+	// Host NUMA node assignment for VM co-location hints.
+	numaAllocator *numaAllocator
+
+	// Directory holding pod spec checkpoints.
+	specDir string
+
+	// Path of the hyper CLI binary.
+	hyperBinPath string
+
+	// Rate-limited, cgroup-confined runner for CLI invocations.
+	cliRunner *cliRunner
+
+	// Cached guest agent capability set, probed lazily from hyperd.
+	agentCapsLock sync.Mutex
+	agentCaps     *agentCapabilities
+
+	// Recent runtime failures, exported in the state snapshot.
+	errorsLock sync.Mutex
+	lastErrors []errorRecord
+
+	// Pods with an exported clock drift metric.
+	driftLock sync.Mutex
+	driftPods map[string]bool
+
+	// Last measured writable rootfs usage per pod, in bytes.
+	storageLock  sync.Mutex
+	storageUsage map[string]int64
+
+	// Consecutive guest agent heartbeat misses per pod, and the pods this
+	// monitor marked NotReady.
+	heartbeatLock   sync.Mutex
+	heartbeatMisses map[string]int
+	heartbeatFailed map[string]bool
+
+	// Last collected per-pod usage for eviction decisions.
+	evictionStats evictionStatsCache
+
+	// Per-pod mutexes serializing create, sync, delete and GC.
+	podLocks podLockSet
+
+	// Limits concurrent VM boots, with kills prioritized over boots.
+	bootGate vmBootGate
+
+	// Standby VMs of the template pool known to be idle.
+	vmPool vmPoolState
+
+	// Resolved namespace-to-Keystone-tenant bindings.
+	tenants tenantCache
+
+	// Tenants with exported allocation metric series.
+	quotaLock       sync.Mutex
+	exportedTenants map[string]bool
+
+	// Last observed PVC capacities, keyed by pod full name and claim.
+	resizeLock         sync.Mutex
+	observedCapacities map[string]int64
+
+	// Volumes with exported usage metric series, per pod full name.
+	volStatsLock     sync.Mutex
+	exportedVolStats map[string]map[string]bool
+
+	// Pods whose volume filesystems are currently frozen for a snapshot.
+	freezeLock sync.Mutex
+	frozenPods map[string]*frozenPod
+
+	// Serializes appends to the exec audit log.
+	auditLock sync.Mutex
+
+	// Virtualization support probed at startup.
+	hypervisorCaps hypervisorCapabilities
+
+	// Containers whose abnormal termination was already reported.
+	crashLock  sync.Mutex
+	crashNoted map[string]string
+
+	// Pods killed for exceeding their active deadline.
+	deadlineLock     sync.Mutex
+	deadlineExceeded map[string]bool
+
+	// Containers with a running log pump.
+	pumpLock    sync.Mutex
+	activePumps map[string]bool
+
+	// Hinted images with a background pull in flight.
+	prefetchLock sync.Mutex
+	prefetching  map[string]bool
+	prefetchSem  chan struct{}
+
+	// VM recreation budget accounting, keyed by pod UID.
+	restartLock      sync.Mutex
+	restartHistory   map[string][]time.Time
+	quarantinedUntil map[string]time.Time
+
 	// Runner of lifecycle events.
 	runner kubecontainer.HandlerRunner
 }
@@ -94,6 +205,7 @@ func New(runtimeHelper kubecontainer.RuntimeHelper,
 	networkPlugin network.NetworkPlugin,
 	containerRefManager *kubecontainer.RefManager,
 	livenessManager proberesults.Manager,
+	readinessManager proberesults.Manager,
 	kubeClient clientset.Interface,
 	imageBackOff *flowcontrol.Backoff,
 	serializeImagePulls bool,
@@ -102,23 +214,49 @@ func New(runtimeHelper kubecontainer.RuntimeHelper,
 	containerLogsDir string,
 	os kubecontainer.OSInterface,
 ) (kubecontainer.Runtime, error) {
-	hyperClient, err := NewHyperClient()
+	configManager, err := newConfigManager(hyperRuntimeConfigFile)
+	if err != nil {
+		return nil, err
+	}
+	config := configManager.getConfig()
+
+	hyperClient, err := NewHyperClientWithTLS(config.Endpoint, config.TLS)
+	if err != nil {
+		return nil, err
+	}
+	if err := hyperClient.addStandby(config.StandbyEndpoint, config.TLS); err != nil {
+		return nil, err
+	}
+	hyperClient.setRateLimit(config.HyperdQPS, config.HyperdBurst)
+
+	registryConfig, err := readRegistryConfig(hyperRegistryConfigFile)
 	if err != nil {
 		return nil, err
 	}
+	if err := registryConfig.installRegistryCertificates(hyperRegistryCertsDir); err != nil {
+		glog.Warningf("Hyper: failed to install registry CA bundles: %v", err)
+	}
 
 	hyper := &runtime{
-		dockerKeyring:               credentialprovider.NewDockerKeyring(),
 		containerLogsDir:            containerLogsDir,
 		containerRefManager:         containerRefManager,
 		runtimeHelper:               runtimeHelper,
 		livenessManager:             livenessManager,
+		readinessManager:            readinessManager,
 		os:                          os,
 		recorder:                    recorder,
 		networkPlugin:               networkPlugin,
 		hyperClient:                 hyperClient,
 		kubeClient:                  kubeClient,
 		disableHyperInternalService: disableHyperInternalService,
+		registryConfig:              registryConfig,
+		configManager:               configManager,
+		numaAllocator:               newNUMAAllocator(),
+		specDir:                     config.PodSpecDir,
+		hyperBinPath:                config.BinaryPath,
+		cliRunner:                   newCLIRunner(config.BinaryPath),
+		heartbeatMisses:             make(map[string]int),
+		heartbeatFailed:             make(map[string]bool),
 	}
 
 	if serializeImagePulls {
@@ -141,6 +279,89 @@ func New(runtimeHelper kubecontainer.RuntimeHelper,
 
 	hyper.runner = lifecycle.NewHandlerRunner(httpClient, hyper, hyper)
 
+	// Seed hyperd with local image tarballs without delaying kubelet
+	// startup.
+	go hyper.preloadImages(configManager.getConfig().ImagePreloadDir)
+
+	// Clean up VMs whose API pods were deleted while the node was down.
+	if hyper.featureEnabled(FeatureOrphanReconciler) {
+		hyper.startOrphanReconciler()
+	}
+
+	// Sweep volume artifacts of pods deleted while the node was down.
+	go hyper.sweepOrphanedVolumeArtifacts()
+
+	// Serve the sanitized state snapshot for support bundles, if configured.
+	hyper.startDebugServer(configManager.getConfig().DebugAddress)
+
+	// Watch for guest clocks drifting away from the host clock.
+	if hyper.featureEnabled(FeatureClockDriftMonitor) {
+		hyper.startClockDriftMonitor()
+	}
+
+	// Enforce pod active deadlines at the runtime level.
+	if hyper.featureEnabled(FeatureDeadlineEnforcer) {
+		hyper.startDeadlineEnforcer()
+	}
+
+	// Mirror container stdout/stderr into node-side JSON log files for the
+	// cluster logging agents.
+	if hyper.featureEnabled(FeatureLogDriver) {
+		hyper.startLogDriver()
+	}
+
+	// Release the VMs of run-to-completion pods as soon as they succeed.
+	if hyper.featureEnabled(FeatureJobReaper) {
+		hyper.startJobReaper()
+	}
+
+	// Measure guest rootfs usage and enforce ephemeral-storage caps.
+	if hyper.featureEnabled(FeatureStorageMonitor) {
+		hyper.startStorageMonitor()
+	}
+
+	// Catch wedged VMs that look Running to hyperd.
+	if hyper.featureEnabled(FeatureAgentHeartbeat) {
+		hyper.startAgentHeartbeat()
+	}
+
+	// Collect per-pod memory and disk usage for eviction decisions.
+	if hyper.featureEnabled(FeatureEvictionStats) {
+		hyper.startEvictionStatsCollector()
+	}
+
+	// Keep template VMs pre-booted for sub-second pod startup.
+	if hyper.featureEnabled(FeatureVMTemplatePool) {
+		hyper.startVMPool()
+	}
+
+	// Deduplicate identical guest kernel and initrd blobs.
+	if hyper.featureEnabled(FeatureKernelCache) {
+		hyper.startKernelCache()
+	}
+
+	// Export allocated VM resources per Keystone tenant.
+	if hyper.featureEnabled(FeatureTenantAccounting) {
+		hyper.startTenantAccountingMonitor()
+	}
+
+	// Grow the filesystems of resized PVCs inside the guest.
+	if hyper.featureEnabled(FeatureVolumeResize) {
+		hyper.startVolumeResizeMonitor()
+	}
+
+	// Measure per-volume filesystem usage inside the guest.
+	if hyper.featureEnabled(FeatureVolumeStats) {
+		hyper.startVolumeStatsMonitor()
+	}
+
+	// Probe what the node's hypervisor can actually run; a node without
+	// KVM fails the health check instead of collecting unbootable pods.
+	hyper.hypervisorCaps = detectHypervisorCapabilities(hyper.configManager.getConfig().DefaultMemoryMB)
+	if !hyper.hypervisorCaps.KVMAvailable {
+		glog.Warningf("Hyper: /dev/kvm is not available, the node cannot run VM pods")
+	}
+
 	return hyper, nil
 }
 
@@ -161,6 +382,16 @@ func (r *runtime) GetPodContainerID(pod *kubecontainer.Pod) (kubecontainer.Conta
 }
 
 func (r *runtime) Status() error {
+	// The runtime health check runs periodically, which makes it a natural
+	// point to pick up configuration changes.
+	r.configManager.reloadIfChanged()
+
+	// Without KVM the node cannot boot VMs; staying unhealthy keeps the
+	// scheduler from placing hyper pods here.
+	if !r.hypervisorCaps.KVMAvailable {
+		return fmt.Errorf("node cannot run VM pods: /dev/kvm is not available")
+	}
+
 	version, err := r.hyperClient.Version()
 	if err != nil {
 		return fmt.Errorf("cannot get hyper version: %v", err)
@@ -187,38 +418,64 @@ func (r *runtime) ImageStats() (*kubecontainer.ImageStats, error) {
 	return &kubecontainer.ImageStats{TotalStorageBytes: 1024 * 1024 * 1024}, nil
 }
 
+// parseTimeString parses a timestamp reported by hyperd. hyperd emits
+// RFC3339 with or without sub-second precision and with either "Z" or a
+// numeric zone offset, depending on the code path; the result is normalized
+// to UTC so status comparisons do not depend on the node's local zone.
 func parseTimeString(str string) (time.Time, error) {
 	t := time.Date(0, 0, 0, 0, 0, 0, 0, time.Local)
 	if str == "" {
 		return t, nil
 	}
 
-	layout := time.RFC3339
-	t, err := time.Parse(layout, str)
-	if err != nil {
-		return t, err
+	// The fractional second of RFC3339Nano is optional when parsing, so it
+	// also covers plain RFC3339; the last layout accepts zone offsets
+	// without a colon.
+	for _, layout := range []string{time.RFC3339Nano, "2006-01-02T15:04:05.999999999Z0700"} {
+		if parsed, err := time.Parse(layout, str); err == nil {
+			return parsed.UTC(), nil
+		}
 	}
 
-	return t, nil
+	return t, fmt.Errorf("timestamp %q is not RFC3339", str)
 }
 
-func (r *runtime) getContainerStatus(container *grpctypes.ContainerStatus, image, imageID, startTime string, podLabels map[string]string) *kubecontainer.ContainerStatus {
+func (r *runtime) getContainerStatus(container *grpctypes.ContainerStatus, containerLabels map[string]string, image, imageID string, createdAt int64, startTime, finishTime, podPhase string, podLabels map[string]string) *kubecontainer.ContainerStatus {
 	status := &kubecontainer.ContainerStatus{}
 
-	_, _, _, containerName, restartCount, _, err := r.parseHyperContainerFullName(container.Name)
+	containerName, restartCount, containerHash, err := r.containerMetadata(container.Name, containerLabels)
 	if err != nil {
 		return status
 	}
 
 	status.Name = containerName
+	// Recover the spec hash recorded at creation time, so that SyncPod can
+	// make correct restart decisions for containers created before a kubelet
+	// restart instead of recreating them.
+	if hash, err := strconv.ParseUint(containerHash, 16, 64); err == nil {
+		status.Hash = hash
+	}
 	status.ID = kubecontainer.ContainerID{
 		Type: typeHyper,
 		ID:   container.ContainerID,
 	}
 	status.Image = image
 	status.ImageID = imageID
+	// If the image was referenced by digest, the digest is the authoritative
+	// immutable identifier, so surface it as the image ID instead of the
+	// local one reported by hyperd.
+	if _, tag := parseImageName(image); isImageDigest(tag) {
+		status.ImageID = fmt.Sprintf("%s@%s", strings.Split(image, "@")[0], tag)
+	}
 	status.RestartCount = restartCount
 
+	// hyperd creates all containers of a pod together with its VM, so the
+	// pod's creation time is the container's creation time. Without it the
+	// kubelet's pod-ordering and age checks see a zero timestamp.
+	if createdAt > 0 {
+		status.CreatedAt = time.Unix(createdAt, 0)
+	}
+
 	switch container.Phase {
 	case StatusRunning:
 		runningStartedAt, err := parseTimeString(container.Running.StartedAt)
@@ -227,54 +484,83 @@ func (r *runtime) getContainerStatus(container *grpctypes.ContainerStatus, image
 			return status
 		}
 
-		// TDOO(harryz) no CreatedAt?
 		status.State = kubecontainer.ContainerStateRunning
 		status.StartedAt = runningStartedAt
 	case StatusFailed, StatusSuccess:
-		// TODO: ensure container.Terminated.StartedAt
-		if container.Terminated.StartedAt == "" {
-			status.StartedAt = time.Now().Add(-2 * time.Second)
-		} else {
+		// hyperd does not always fill the container-level timestamps (e.g.
+		// when the VM died before the agent reported them); fall back to the
+		// pod-level ones before fabricating anything.
+		switch {
+		case container.Terminated.StartedAt != "":
 			terminatedStartedAt, err := parseTimeString(container.Terminated.StartedAt)
 			if err != nil {
 				glog.Errorf("Hyper: can't parse terminatedStartedAt %s", container.Terminated.StartedAt)
 				return status
 			}
 			status.StartedAt = terminatedStartedAt
+		case startTime != "":
+			if podStartedAt, err := parseTimeString(startTime); err == nil {
+				status.StartedAt = podStartedAt
+			}
+		default:
+			status.StartedAt = status.CreatedAt
 		}
 
-		// TODO: ensure container.Terminated.FinishedAt
-		if container.Terminated.FinishedAt == "" {
-			status.FinishedAt = time.Now()
-		} else {
+		switch {
+		case container.Terminated.FinishedAt != "":
 			terminatedFinishedAt, err := parseTimeString(container.Terminated.FinishedAt)
 			if err != nil {
 				glog.Errorf("Hyper: can't parse terminatedFinishedAt %s", container.Terminated.FinishedAt)
 				return status
 			}
-
 			status.FinishedAt = terminatedFinishedAt
+		case finishTime != "":
+			if podFinishedAt, err := parseTimeString(finishTime); err == nil {
+				status.FinishedAt = podFinishedAt
+			}
+		default:
+			// The guest agent never reported the end of the container; the
+			// best available estimate is when we noticed.
+			status.FinishedAt = time.Now()
 		}
 
 		var message string
-		path := podLabels[containerName]
-		if data, err := ioutil.ReadFile(path); err != nil {
-			message = fmt.Sprintf("Error on reading termination-log %s: %v", path, err)
-		} else {
-			message = string(data)
+		if path := podLabels[containerName]; path != "" {
+			if data, err := ioutil.ReadFile(path); err != nil {
+				message = fmt.Sprintf("Error on reading termination-log %s: %v", path, err)
+			} else {
+				message = string(data)
+			}
 		}
 
 		status.Message = message
 		status.State = kubecontainer.ContainerStateExited
 		status.Reason = container.Terminated.Reason
 		status.ExitCode = int(container.Terminated.ExitCode)
+		// hyperd does not always fill the termination reason; derive it from
+		// the exit code so `kubectl describe` never shows an empty reason.
+		if status.Reason == "" {
+			switch {
+			case status.ExitCode == oomExitCode:
+				status.Reason = reasonOOMKilled
+			case status.ExitCode == 0:
+				status.Reason = "Completed"
+			default:
+				status.Reason = "Error"
+			}
+		}
+		// A failed pod whose guest agent never reported the container's end
+		// means the VM itself died (QEMU crash, guest kernel panic).
+		if container.Terminated.FinishedAt == "" && podPhase == StatusFailed {
+			status.Reason = reasonVMCrashed
+		}
 	default:
 		if startTime == "" {
-			status.StartedAt = time.Now().Add(-2 * time.Second)
+			status.StartedAt = status.CreatedAt
 		} else {
 			startedAt, err := parseTimeString(startTime)
 			if err != nil {
-				glog.Errorf("Hyper: can't parse startTime %s", container.Terminated.StartedAt)
+				glog.Errorf("Hyper: can't parse startTime %s", startTime)
 				return status
 			}
 
@@ -290,6 +576,13 @@ func (r *runtime) getContainerStatus(container *grpctypes.ContainerStatus, image
 	return status
 }
 
+// isStaticPod returns whether the pod comes from a non-apiserver source
+// (kubelet manifest file or HTTP source).
+func isStaticPod(pod *api.Pod) bool {
+	source, err := kubetypes.GetPodSource(pod)
+	return err == nil && source != kubetypes.ApiserverSource
+}
+
 func (r *runtime) buildHyperContainerFullName(uid, podName, namespace, containerName string, restartCount int, container api.Container) string {
 	return fmt.Sprintf("%s_%s_%s_%s_%s_%d_%s",
 		hyperContainerNamePrefix,
@@ -301,6 +594,31 @@ func (r *runtime) buildHyperContainerFullName(uid, podName, namespace, container
 		strconv.FormatUint(kubecontainer.HashContainer(&container), 16))
 }
 
+// containerMetadata resolves the kubelet container name, restart count and
+// spec hash of a hyper container. The labels attached at creation time are
+// authoritative, because the underscore-delimited full name cannot encode pod
+// names or namespaces containing underscores; parsing the full name is kept
+// only as a fallback for containers created by older kubelets.
+func (r *runtime) containerMetadata(fullName string, labels map[string]string) (string, int, string, error) {
+	if name, restartCount, hash, ok := containerMetadataFromLabels(labels); ok {
+		return name, restartCount, hash, nil
+	}
+
+	_, _, _, name, restartCount, hash, err := r.parseHyperContainerFullName(fullName)
+	return name, restartCount, hash, err
+}
+
+// containerSpecLabels returns the labels of the spec container with the given
+// ID, or nil when hyperd has no labels for it.
+func containerSpecLabels(spec *grpctypes.PodSpec, containerID string) map[string]string {
+	for _, c := range spec.Containers {
+		if c.ContainerID == containerID {
+			return c.Labels
+		}
+	}
+	return nil
+}
+
 func (r *runtime) parseHyperContainerFullName(containerName string) (string, string, string, string, int, string, error) {
 	parts := strings.Split(containerName, "_")
 	if len(parts) != 7 {
@@ -365,7 +683,7 @@ func (r *runtime) GetPods(all bool) ([]*kubecontainer.Pod, error) {
 				}
 			}
 
-			_, _, _, containerName, _, containerHash, err := r.parseHyperContainerFullName(cinfo.Name)
+			containerName, _, containerHash, err := r.containerMetadata(cinfo.Name, cinfo.Labels)
 			if err != nil {
 				glog.V(5).Infof("Hyper: container %s is not managed by kubelet", cinfo.Name)
 				continue
@@ -388,10 +706,20 @@ func (r *runtime) GetPods(all bool) ([]*kubecontainer.Pod, error) {
 }
 
 func (r *runtime) buildHyperPodServices(pod *api.Pod) []grpctypes.UserService {
+	if r.kubeClient == nil {
+		// The runtime may run without an API server connection (e.g. a
+		// standalone kubelet serving static pods), there are no cluster
+		// services to discover then.
+		return nil
+	}
+
 	items, err := r.kubeClient.Core().Services(pod.Namespace).List(api.ListOptions{})
 	if err != nil {
-		glog.Warningf("Get services failed: %v", err)
-		return nil
+		// Seed the proxy from the last-known snapshot so service
+		// connectivity survives an API server outage; the service
+		// updater refreshes the list once the API server is back.
+		glog.Warningf("Get services failed: %v, seeding the pod from the last-known snapshot", err)
+		return loadServiceSnapshot(pod.Namespace)
 	}
 
 	var services []grpctypes.UserService
@@ -399,7 +727,11 @@ func (r *runtime) buildHyperPodServices(pod *api.Pod) []grpctypes.UserService {
 		hyperService := grpctypes.UserService{
 			ServiceIP: svc.Spec.ClusterIP,
 		}
-		endpoints, _ := r.kubeClient.Core().Endpoints(pod.Namespace).Get(svc.Name)
+		endpoints, err := r.kubeClient.Core().Endpoints(pod.Namespace).Get(svc.Name)
+		if err != nil {
+			glog.Warningf("Get endpoints for service %s failed: %v", svc.Name, err)
+			continue
+		}
 		for _, svcPort := range svc.Spec.Ports {
 			hyperService.ServicePort = svcPort.Port
 			for _, ep := range endpoints.Subsets {
@@ -418,21 +750,79 @@ func (r *runtime) buildHyperPodServices(pod *api.Pod) []grpctypes.UserService {
 		}
 	}
 
+	saveServiceSnapshot(pod.Namespace, services)
+
 	return services
 }
 
+const (
+	// Pod-level annotations defining the VM resource envelope directly,
+	// instead of deriving it from per-container limits.
+	podVCPUAnnotation     = "hyper.sh/vm-vcpu"
+	podMemoryMBAnnotation = "hyper.sh/vm-memory-mb"
+)
+
+// podResourceAnnotation returns the value of a pod-level resource annotation,
+// or found=false when the pod does not carry it.
+func podResourceAnnotation(pod *api.Pod, annotation string) (int64, bool, error) {
+	value, found := pod.Annotations[annotation]
+	if !found {
+		return 0, false, nil
+	}
+
+	parsed, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || parsed <= 0 {
+		return 0, false, fmt.Errorf("annotation %s=%q must be a positive integer", annotation, value)
+	}
+	return parsed, true, nil
+}
+
 func (r *runtime) buildHyperPod(pod *api.Pod, restartCount int, pullSecrets []api.Secret) ([]byte, error) {
+	// Check presence of all container images with one round-trip; containers
+	// whose image is already local and whose pull policy would not pull again
+	// skip the per-container puller, so many-container pods do not pay one
+	// image list per container.
+	var imageNames []string
+	for _, c := range pod.Spec.Containers {
+		imageNames = append(imageNames, c.Image)
+	}
+	present, err := r.hyperClient.IsImagesPresent(imageNames)
+	if err != nil {
+		glog.Warningf("Hyper: batch image presence check failed, falling back to per-container checks: %v", err)
+		present = nil
+	}
+
+	// the node image policy holds even when admission control was bypassed
+	for _, c := range pod.Spec.Containers {
+		if err := r.checkImagePolicy(c.Image); err != nil {
+			return nil, err
+		}
+	}
+
 	// check and pull image
 	for _, c := range pod.Spec.Containers {
+		if present[c.Image] && c.ImagePullPolicy != api.PullAlways {
+			glog.V(4).Infof("Hyper: image %s for container %s already present, skipping pull", c.Image, c.Name)
+			continue
+		}
 		if err, _ := r.imagePuller.PullImage(pod, &c, pullSecrets); err != nil {
 			return nil, err
 		}
 	}
 
+	return r.buildHyperPodSpec(pod, restartCount, false)
+}
+
+// buildHyperPodSpec renders the hyperd spec of an API pod. With dryRun the
+// rendering has no side effects: no termination-log files are created, no
+// image pins or service snapshots are written and no events are emitted, so
+// tooling can preview the translation of a pod (see the translate package).
+func (r *runtime) buildHyperPodSpec(pod *api.Pod, restartCount int, dryRun bool) ([]byte, error) {
 	// build hyper volume spec
 	specMap := make(map[string]interface{})
 	volumes := make([]map[string]interface{}, 0, 1)
 
+	tmpfsVolumes := podTmpfsVolumes(pod)
 	volumeMap, found := r.runtimeHelper.ListVolumesForPod(pod.UID)
 	if found {
 		// process rbd volume globally
@@ -441,6 +831,16 @@ func (r *runtime) buildHyperPod(pod *api.Pod, restartCount int, pullSecrets []ap
 			v := make(map[string]interface{})
 			v[KEY_NAME] = name
 
+			// Memory-backed emptyDir volumes are created as tmpfs inside the
+			// guest instead of being shared from the host, so scratch writes
+			// never touch the VM disks.
+			if size, isTmpfs := tmpfsVolumes[name]; isTmpfs {
+				v[KEY_VOLUME_DRIVE] = VOLUME_TYPE_TMPFS
+				v[KEY_VOLUME_SOURCE] = fmt.Sprintf("size=%s", size)
+				volumes = append(volumes, v)
+				continue
+			}
+
 			// Process rbd volume
 			metadata := mounter.GetMetaData()
 			if metadata != nil && metadata["volume_type"].(string) == "rbd" {
@@ -457,11 +857,32 @@ func (r *runtime) buildHyperPod(pod *api.Pod, restartCount int, pullSecrets []ap
 					"keyring":  metadata["keyring"],
 					"monitors": monitors,
 				}
+			} else if metadata != nil && metadata["volume_type"].(string) == "cephfs" && buildCephFSVolume(v, metadata) {
+				// Mounted by the guest's ceph client, so tenants get shared
+				// POSIX storage without a host mount crossing the VM boundary.
+				glog.V(4).Infof("Hyper: volume %s mounted as CephFS by the guest", name)
+			} else if metadata != nil && metadata["volume_type"].(string) == "flexvolume" && r.buildFlexVolume(v, metadata) {
+				// Block-device FlexVolumes are attached to the VM directly;
+				// mount-only drivers fall through to the vfs path below.
+				glog.V(4).Infof("Hyper: volume %s attached as FlexVolume block device %v", name, v[KEY_VOLUME_SOURCE])
+			} else if metadata != nil && metadata["volume_type"].(string) == "iscsi" && r.buildISCSIVolume(v, metadata) {
+				// The LUN's block device is attached to the VM directly,
+				// bypassing the vfs/9p shared-folder path for block storage.
+				glog.V(4).Infof("Hyper: volume %s attached as iSCSI block device %v", name, v[KEY_VOLUME_SOURCE])
 			} else {
 				glog.V(4).Infof("Hyper: volume %s %s", name, mounter.GetPath())
 
 				v[KEY_VOLUME_DRIVE] = VOLUME_TYPE_VFS
-				v[KEY_VOLUME_SOURCE] = mounter.GetPath()
+				source := mounter.GetPath()
+				// Enforce read-only and per-volume mount options on the
+				// share itself, not just inside the guest; skipped in dry
+				// runs, which must not create mounts.
+				if !dryRun {
+					if hardened := r.hardenVFSSource(pod, name, source); hardened != "" {
+						source = hardened
+					}
+				}
+				v[KEY_VOLUME_SOURCE] = source
 			}
 
 			volumes = append(volumes, v)
@@ -470,8 +891,23 @@ func (r *runtime) buildHyperPod(pod *api.Pod, restartCount int, pullSecrets []ap
 		glog.V(4).Infof("Hyper volumes: %v", volumes)
 	}
 
-	if !r.disableHyperInternalService {
-		services := r.buildHyperPodServices(pod)
+	// Run-to-completion pods are short-lived batch workloads; skip the
+	// in-pod service proxy to keep their VM footprint minimal.
+	if !r.disableHyperInternalService && !isRunToCompletionPod(pod) {
+		var services []grpctypes.UserService
+		// Static pods must be able to start while the API server is
+		// unreachable (e.g. self-hosted control plane components), so never
+		// block them on service discovery; their service list is refreshed
+		// by the kubelet once the API server is up.
+		if !isStaticPod(pod) {
+			if dryRun {
+				// Preview from the last-known snapshot instead of querying
+				// the API server and rewriting the snapshot.
+				services = loadServiceSnapshot(pod.Namespace)
+			} else {
+				services = r.buildHyperPodServices(pod)
+			}
+		}
 		if services == nil {
 			// services can't be null for kubernetes, so fake one if it is null
 			services = []grpctypes.UserService{
@@ -484,6 +920,65 @@ func (r *runtime) buildHyperPod(pod *api.Pod, restartCount int, pullSecrets []ap
 		specMap["services"] = services
 	}
 
+	// The guest hostname honors spec.hostname (or its annotation); the
+	// domain carries the headless-service subdomain when set.
+	podHostname, podDomain, err := r.runtimeHelper.GeneratePodHostNameAndDomain(pod)
+	if err != nil {
+		return nil, err
+	}
+	// Cap hostname at 63 chars (specification is 64bytes which is 63 chars and the null terminating char).
+	const hostnameMaxLen = 63
+	if len(podHostname) > hostnameMaxLen {
+		podHostname = podHostname[:hostnameMaxLen]
+	}
+
+	// trust bundles projected into the guest trust store
+	podFiles, containerFileRefs := r.guestTrustFiles()
+
+	// the node's time zone and locale, for workloads expecting local time
+	if localeFiles, localeRefs := r.guestLocaltimeFiles(pod); len(localeFiles) > 0 {
+		podFiles = append(podFiles, localeFiles...)
+		containerFileRefs = append(containerFileRefs, localeRefs...)
+	}
+
+	// managed /etc/hosts including the pod's DNS name and annotated aliases
+	hostsFile, hostsFileRef, err := guestHostsFile(pod, podHostname, podDomain)
+	if err != nil {
+		return nil, err
+	}
+	if hostsFile != nil {
+		podFiles = append(podFiles, hostsFile)
+		containerFileRefs = append(containerFileRefs, hostsFileRef)
+	}
+
+	// full resolver configuration (servers, searches, options) honoring
+	// the pod's dnsPolicy
+	dnsServersList, dnsSearchList, err := r.runtimeHelper.GetClusterDNS(pod)
+	if err != nil {
+		return nil, err
+	}
+	if resolvFile, resolvFileRef := guestResolvConf(pod, dnsServersList, dnsSearchList); resolvFile != nil {
+		podFiles = append(podFiles, resolvFile)
+		containerFileRefs = append(containerFileRefs, resolvFileRef)
+	}
+
+	if len(podFiles) > 0 {
+		specMap[KEY_FILES] = podFiles
+	}
+
+	// kernel parameters applied inside the guest at boot
+	sysctls, err := podSysctls(pod)
+	if err != nil {
+		return nil, err
+	}
+
+	// Pinned digests from the initial creation; a VM recreation boots the
+	// same bits even if the image tag moved since.
+	var imagePins map[string]string
+	if restartCount > 0 && !latestAtRestart(pod) {
+		imagePins = r.loadImagePins(string(pod.UID))
+	}
+
 	// build hyper containers spec
 	var containers []map[string]interface{}
 	var k8sHostNeeded = true
@@ -499,12 +994,27 @@ func (r *runtime) buildHyperPod(pod *api.Pod, restartCount int, pullSecrets []ap
 			restartCount,
 			container)
 		c[KEY_IMAGE] = container.Image
+		if pinned, ok := imagePins[container.Name]; ok {
+			c[KEY_IMAGE] = pinned
+		}
 		c[KEY_TTY] = container.TTY
+		// The labels are the authoritative source of the container's kubelet
+		// metadata; the full name above only survives for compatibility with
+		// pods created by older kubelets.
+		c[KEY_LABELS] = newLabels(&container, pod, restartCount, false)
 
 		if container.WorkingDir != "" {
 			c[KEY_WORKDIR] = container.WorkingDir
 		}
 
+		if len(sysctls) > 0 {
+			c[KEY_SYSCTL] = sysctls
+		}
+
+		if len(containerFileRefs) > 0 {
+			c[KEY_FILES] = containerFileRefs
+		}
+
 		opts, err := r.runtimeHelper.GenerateRunContainerOptions(pod, &container, "")
 		if err != nil {
 			return nil, err
@@ -536,12 +1046,23 @@ func (r *runtime) buildHyperPod(pod *api.Pod, restartCount int, pullSecrets []ap
 		// port-mappings
 		var ports []map[string]interface{}
 		for _, mapping := range opts.PortMappings {
+			protocol, err := normalizePortProtocol(mapping.Protocol)
+			if err != nil {
+				// Fail here rather than letting hyperd reject the whole
+				// spec at start time with a less helpful error.
+				err = fmt.Errorf("container %s port %d: %v", container.Name, mapping.ContainerPort, err)
+				if !dryRun {
+					r.recorder.Eventf(pod, api.EventTypeWarning, "InvalidPortMapping", "%v", err)
+				}
+				return nil, err
+			}
+
 			p := make(map[string]interface{})
 			p[KEY_CONTAINER_PORT] = mapping.ContainerPort
 			if mapping.HostPort != 0 {
 				p[KEY_HOST_PORT] = mapping.HostPort
 			}
-			p[KEY_PROTOCOL] = mapping.Protocol
+			p[KEY_PROTOCOL] = protocol
 			ports = append(ports, p)
 		}
 		c[KEY_PORTS] = ports
@@ -555,13 +1076,15 @@ func (r *runtime) buildHyperPod(pod *api.Pod, restartCount int, pullSecrets []ap
 			// on the disk.
 			randomUID := util.NewUUID()
 			containerLogPath := path.Join(opts.PodContainerDir, string(randomUID))
-			fs, err := os.Create(containerLogPath)
-			if err != nil {
-				return nil, err
-			}
+			if !dryRun {
+				fs, err := os.Create(containerLogPath)
+				if err != nil {
+					return nil, err
+				}
 
-			if err := fs.Close(); err != nil {
-				return nil, err
+				if err := fs.Close(); err != nil {
+					return nil, err
+				}
 			}
 			mnt := &kubecontainer.Mount{
 				// Use a random name for the termination message mount, so that
@@ -579,8 +1102,8 @@ func (r *runtime) buildHyperPod(pod *api.Pod, restartCount int, pullSecrets []ap
 		}
 
 		// volumes
+		var containerVolumes []map[string]interface{}
 		if len(opts.Mounts) > 0 {
-			var containerVolumes []map[string]interface{}
 			for _, volume := range opts.Mounts {
 				v := make(map[string]interface{})
 				v[KEY_MOUNTPATH] = volume.ContainerPath
@@ -611,12 +1134,33 @@ func (r *runtime) buildHyperPod(pod *api.Pod, restartCount int, pullSecrets []ap
 					}
 				}
 			}
+		}
+
+		// resized /dev/shm, mounted into every container of the pod
+		if podShmSize(pod) != "" {
+			containerVolumes = append(containerVolumes, map[string]interface{}{
+				KEY_MOUNTPATH: "/dev/shm",
+				KEY_VOLUME:    shmVolumeName,
+				KEY_READONLY:  false,
+			})
+		}
+
+		if len(containerVolumes) > 0 {
 			c[KEY_VOLUMES] = containerVolumes
 		}
 
 		containers = append(containers, c)
 	}
 	specMap[KEY_CONTAINERS] = containers
+
+	if shmSize := podShmSize(pod); shmSize != "" {
+		volumes = append(volumes, map[string]interface{}{
+			KEY_NAME:          shmVolumeName,
+			KEY_VOLUME_DRIVE:  VOLUME_TYPE_TMPFS,
+			KEY_VOLUME_SOURCE: fmt.Sprintf("size=%s", shmSize),
+		})
+	}
+
 	specMap[KEY_VOLUMES] = volumes
 
 	// dns
@@ -631,6 +1175,7 @@ func (r *runtime) buildHyperPod(pod *api.Pod, restartCount int, pullSecrets []ap
 	// build hyper pod resources spec
 	var podCPULimit, podMemLimit int64
 	var labels map[string]string
+	runtimeConfig := r.configManager.getConfig()
 	podResource := make(map[string]int64)
 	for _, container := range pod.Spec.Containers {
 		resource := container.Resources.Limits
@@ -644,10 +1189,10 @@ func (r *runtime) buildHyperPod(pod *api.Pod, restartCount int, pullSecrets []ap
 			}
 		}
 		if containerCPULimit == 0 {
-			containerCPULimit = hyperDefaultContainerCPU
+			containerCPULimit = int64(runtimeConfig.DefaultVCPU)
 		}
 		if containerMemLimit == 0 {
-			containerMemLimit = hyperDefaultContainerMem * 1024 * 1024 * 1000
+			containerMemLimit = int64(runtimeConfig.DefaultMemoryMB) * 1024 * 1024 * 1000
 		}
 		podCPULimit += containerCPULimit
 		podMemLimit += containerMemLimit
@@ -659,6 +1204,22 @@ func (r *runtime) buildHyperPod(pod *api.Pod, restartCount int, pullSecrets []ap
 
 	podResource[KEY_VCPU] = (podCPULimit + 999) / 1000
 	podResource[KEY_MEMORY] = ((podMemLimit) / 1000 / 1024) / 1024
+
+	// Pod-level annotations size the VM envelope directly, overriding the
+	// per-container summation. With uneven or missing container limits the
+	// summation over-provisions mixed sidecar pods, so operators can pin the
+	// envelope explicitly.
+	if vcpu, found, err := podResourceAnnotation(pod, podVCPUAnnotation); err != nil {
+		glog.Warningf("Hyper: ignoring %s for pod %s: %v", podVCPUAnnotation, pod.Name, err)
+	} else if found {
+		podResource[KEY_VCPU] = vcpu
+	}
+	if memoryMB, found, err := podResourceAnnotation(pod, podMemoryMBAnnotation); err != nil {
+		glog.Warningf("Hyper: ignoring %s for pod %s: %v", podMemoryMBAnnotation, pod.Name, err)
+	} else if found {
+		podResource[KEY_MEMORY] = memoryMB
+	}
+
 	specMap[KEY_RESOURCE] = podResource
 	glog.V(5).Infof("Hyper: pod limit vcpu=%v mem=%vMiB", podResource[KEY_VCPU], podResource[KEY_MEMORY])
 
@@ -678,19 +1239,75 @@ func (r *runtime) buildHyperPod(pod *api.Pod, restartCount int, pullSecrets []ap
 		podLabels[k] = v
 	}
 
+	// append NUMA co-location hint; skipped in dry runs so previews do not
+	// consume co-location group assignments
+	if !dryRun {
+		for k, v := range r.numaAllocator.numaLabelsForPod(pod) {
+			podLabels[k] = v
+		}
+	}
+
+	// stamp the namespace's Keystone tenant so per-tenant network and
+	// storage backends can be selected from the pod alone; skipped in dry
+	// runs, which have no API server to resolve the binding against
+	if !dryRun {
+		if tenantID := r.tenantIDForNamespace(pod.Namespace); tenantID != "" {
+			podLabels[tenantIDLabel] = tenantID
+		}
+	}
+
+	// record the active deadline so the runtime can enforce it even across
+	// kubelet restarts
+	if pod.Spec.ActiveDeadlineSeconds != nil {
+		podLabels[activeDeadlineLabel] = strconv.FormatInt(*pod.Spec.ActiveDeadlineSeconds, 10)
+	}
+
+	// mark run-to-completion pods so the reaper can release their VM
+	if isRunToCompletionPod(pod) {
+		podLabels[runToCompletionLabel] = "true"
+	}
+
+	// resolve the selected guest image, if any; an unknown or disallowed
+	// selection fails the pod instead of silently booting the default
+	guestKernel, guestInitrd, err := r.guestImagePaths(pod)
+	if err != nil {
+		return nil, err
+	}
+	if guestKernel != "" {
+		podLabels[guestKernelLabel] = guestKernel
+		podLabels[guestInitrdLabel] = guestInitrd
+	}
+
+	// extra kernel cmdline parameters, validated against the allowlist
+	kernelCmdline, err := r.podKernelCmdline(pod)
+	if err != nil {
+		return nil, err
+	}
+	if kernelCmdline != "" {
+		podLabels[kernelCmdlineLabel] = kernelCmdline
+	}
+
+	// record the ephemeral-storage cap for the storage monitor
+	storageLimit, err := podEphemeralStorageLimit(pod)
+	if err != nil {
+		return nil, err
+	}
+	if storageLimit > 0 {
+		podLabels[storageLimitLabel] = strconv.FormatInt(storageLimit, 10)
+	}
+
 	specMap[KEY_LABELS] = podLabels
 
 	// other params required
 	specMap[KEY_ID] = kubecontainer.BuildPodFullName(pod.Name, pod.Namespace)
 
-	// Cap hostname at 63 chars (specification is 64bytes which is 63 chars and the null terminating char).
-	const hostnameMaxLen = 63
-	podHostname := pod.Name
-	if len(podHostname) > hostnameMaxLen {
-		podHostname = podHostname[:hostnameMaxLen]
-	}
 	specMap[KEY_HOSTNAME] = podHostname
 
+	// Pin the digests booted at initial creation for later recreations.
+	if !dryRun && restartCount == 0 && !latestAtRestart(pod) {
+		r.saveImagePins(pod)
+	}
+
 	podData, err := json.Marshal(specMap)
 	if err != nil {
 		return nil, err
@@ -699,64 +1316,252 @@ func (r *runtime) buildHyperPod(pod *api.Pod, restartCount int, pullSecrets []ap
 	return podData, nil
 }
 
+// credentialVolumeOptionKeys are the volume option keys that carry secret
+// material: the CephFS secret and the RBD keyring, both resolved from API
+// Secrets when the spec is built.
+var credentialVolumeOptionKeys = []string{"secret", "keyring"}
+
+// redactPodSpec replaces environment variable values and credential-bearing
+// volume options in a generated pod spec with a placeholder. Both may carry
+// secret material, which must not end up in the on-disk checkpoint.
+func redactPodSpec(spec []byte) ([]byte, error) {
+	var specMap map[string]interface{}
+	if err := json.Unmarshal(spec, &specMap); err != nil {
+		return nil, err
+	}
+
+	if containers, ok := specMap[KEY_CONTAINERS].([]interface{}); ok {
+		for _, c := range containers {
+			container, ok := c.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			envs, ok := container[KEY_ENVS].([]interface{})
+			if !ok {
+				continue
+			}
+			for _, e := range envs {
+				if env, ok := e.(map[string]interface{}); ok {
+					env[KEY_VALUE] = "[redacted]"
+				}
+			}
+		}
+	}
+
+	if volumes, ok := specMap[KEY_VOLUMES].([]interface{}); ok {
+		for _, v := range volumes {
+			volume, ok := v.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			option, ok := volume["option"].(map[string]interface{})
+			if !ok {
+				continue
+			}
+			for _, key := range credentialVolumeOptionKeys {
+				if _, present := option[key]; present {
+					option[key] = "[redacted]"
+				}
+			}
+		}
+	}
+
+	return json.Marshal(specMap)
+}
+
+// specCheckpoint is the on-disk format of a pod spec checkpoint. The schema
+// version guards against kubelet up/downgrades reading incompatible files.
+type specCheckpoint struct {
+	Version string          `json:"version"`
+	Spec    json.RawMessage `json:"spec"`
+}
+
+const specCheckpointVersion = "v1"
+
+// savePodSpec checkpoints a redacted copy of the generated pod spec. The
+// spec itself is handed to hyperd over the API; the checkpoint only exists
+// for debugging and recovery, carries no secret env values and is not
+// readable by other users. The file is written atomically (temp file, fsync,
+// rename) so a crashed kubelet never leaves a truncated checkpoint behind.
 func (r *runtime) savePodSpec(spec, podFullName string) error {
-	// ensure hyperPodSpecDir is created
-	_, err := os.Stat(hyperPodSpecDir)
+	// ensure the spec checkpoint directory is created
+	_, err := os.Stat(r.specDir)
 	if err != nil && os.IsNotExist(err) {
-		e := os.MkdirAll(hyperPodSpecDir, 0755)
+		e := os.MkdirAll(r.specDir, 0700)
 		if e != nil {
 			return e
 		}
 	}
 
-	// save spec to file
-	specFileName := path.Join(hyperPodSpecDir, podFullName)
-	err = ioutil.WriteFile(specFileName, []byte(spec), 0664)
+	redacted, err := redactPodSpec([]byte(spec))
 	if err != nil {
 		return err
 	}
 
-	return nil
+	data, err := json.Marshal(specCheckpoint{Version: specCheckpointVersion, Spec: redacted})
+	if err != nil {
+		return err
+	}
+
+	specFileName := path.Join(r.specDir, podFullName)
+	tmpFile, err := ioutil.TempFile(r.specDir, podFullName+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmpFile.Name())
+
+	if _, err := tmpFile.Write(data); err != nil {
+		tmpFile.Close()
+		return err
+	}
+	if err := tmpFile.Chmod(0600); err != nil {
+		tmpFile.Close()
+		return err
+	}
+	if err := tmpFile.Sync(); err != nil {
+		tmpFile.Close()
+		return err
+	}
+	if err := tmpFile.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmpFile.Name(), specFileName)
 }
 
 func (r *runtime) getPodSpec(podFullName string) (string, error) {
-	specFileName := path.Join(hyperPodSpecDir, podFullName)
+	specFileName := path.Join(r.specDir, podFullName)
 	_, err := os.Stat(specFileName)
 	if err != nil {
 		return "", err
 	}
 
-	spec, err := ioutil.ReadFile(specFileName)
-	if err != nil {
-		return "", err
+	data, err := ioutil.ReadFile(specFileName)
+	if err != nil {
+		return "", err
+	}
+
+	var checkpoint specCheckpoint
+	if err := json.Unmarshal(data, &checkpoint); err != nil || checkpoint.Version == "" {
+		// Not a versioned checkpoint; treat the file as a legacy raw spec.
+		return string(data), nil
+	}
+	if checkpoint.Version != specCheckpointVersion {
+		return "", fmt.Errorf("unsupported pod spec checkpoint version %q for %s", checkpoint.Version, podFullName)
+	}
+
+	return string(checkpoint.Spec), nil
+}
+
+// cleanupOrphanedSpecFiles removes spec checkpoints (including leftover
+// temp files) for pods hyperd no longer knows about, so kubelet restarts do
+// not accumulate stale state.
+func (r *runtime) cleanupOrphanedSpecFiles(podInfos []HyperPod) {
+	known := make(map[string]bool, len(podInfos))
+	for _, podInfo := range podInfos {
+		known[podInfo.PodName] = true
+	}
+
+	files, err := ioutil.ReadDir(r.specDir)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			glog.Warningf("Hyper: cannot read pod spec dir %s: %v", r.specDir, err)
+		}
+		return
+	}
+
+	for _, f := range files {
+		if f.IsDir() {
+			continue
+		}
+		name := f.Name()
+		if known[name] && !strings.Contains(name, ".tmp") {
+			continue
+		}
+		specFileName := path.Join(r.specDir, name)
+		if err := os.Remove(specFileName); err != nil {
+			glog.Warningf("Hyper: failed to remove orphaned spec file %s: %v", specFileName, err)
+		} else {
+			glog.V(4).Infof("Hyper: removed orphaned spec file %s", specFileName)
+		}
+	}
+}
+
+// checkReadOnly refuses mutating operations while the runtime is in
+// forensic read-only mode.
+func (r *runtime) checkReadOnly(operation string) error {
+	if r.configManager.getConfig().ReadOnly {
+		return fmt.Errorf("Hyper: runtime is in read-only mode, refusing to %s", operation)
 	}
-
-	return string(spec), nil
+	return nil
 }
 
 func (r *runtime) GetPodRestartCount(podID string) (int, error) {
-	containers, err := r.hyperClient.ListContainers()
+	podInfos, err := r.hyperClient.ListPods()
 	if err != nil {
 		return 0, err
 	}
 
-	for _, c := range containers {
-		if c.podID != podID {
+	for _, podInfo := range podInfos {
+		if podInfo.PodID != podID {
 			continue
 		}
 
-		_, _, _, _, restartCount, _, err := r.parseHyperContainerFullName(c.name)
-		if err != nil {
-			continue
-		}
+		for _, c := range podInfo.PodInfo.Spec.Containers {
+			_, restartCount, _, err := r.containerMetadata(c.Name, c.Labels)
+			if err != nil {
+				continue
+			}
 
-		return restartCount, nil
+			return restartCount, nil
+		}
 	}
 
 	return 0, nil
 }
 
+// rollbackPod reverts whatever a partially failed RunPod left behind: the
+// created (but possibly never started) hyper pod, the pod's network
+// configuration and the spec checkpoint. Each step is attempted regardless
+// of the others failing, so no resource is leaked because an earlier one
+// could not be cleaned up.
+func (r *runtime) rollbackPod(pod *api.Pod, podFullName, podID string) {
+	if podID != "" {
+		if destroyErr := r.hyperClient.RemovePod(podID); destroyErr != nil {
+			glog.Errorf("Hyper: rollback: destroy pod %s (ID:%s) failed: %v", pod.Name, podID, destroyErr)
+		}
+	}
+
+	if tearDownErr := r.networkPlugin.TearDownPod(pod.Namespace, pod.Name, kubecontainer.ContainerID{}, "hyper"); tearDownErr != nil {
+		glog.Warningf("Hyper: rollback: networkPlugin.TearDownPod failed: %v, kubelet will continue to rm pod %s", tearDownErr, pod.Name)
+	}
+
+	specFileName := path.Join(r.specDir, podFullName)
+	if _, statErr := os.Stat(specFileName); statErr == nil {
+		if removeErr := os.Remove(specFileName); removeErr != nil {
+			glog.Warningf("Hyper: rollback: delete spec file for %s failed, error: %v", podFullName, removeErr)
+		}
+	}
+}
+
+// RunPod creates and boots the VM of a pod, holding its per-pod lock.
 func (r *runtime) RunPod(pod *api.Pod, restartCount int, pullSecrets []api.Secret) error {
+	podFullName := kubecontainer.BuildPodFullName(pod.Name, pod.Namespace)
+	r.podLocks.lock(podFullName)
+	defer r.podLocks.unlock(podFullName)
+
+	return r.runPod(pod, restartCount, pullSecrets)
+}
+
+// runPod is RunPod without the per-pod lock, for callers already holding it.
+func (r *runtime) runPod(pod *api.Pod, restartCount int, pullSecrets []api.Secret) error {
+	if err := r.checkReadOnly("run pod " + pod.Name); err != nil {
+		return err
+	}
+
+	trace := util.NewTrace(fmt.Sprintf("Hyper RunPod %s/%s (UID %s)", pod.Namespace, pod.Name, pod.UID))
+	defer trace.LogIfLong(podLifecycleTraceThreshold)
+
 	var (
 		err         error
 		podData     []byte
@@ -765,13 +1570,38 @@ func (r *runtime) RunPod(pod *api.Pod, restartCount int, pullSecrets []api.Secre
 		podStatus   *kubecontainer.PodStatus
 	)
 
+	if err := r.validatePodSecurityContext(pod); err != nil {
+		r.recorder.Eventf(pod, api.EventTypeWarning, reasonUnsupportedSecurityContext, "Pod rejected: %v", err)
+		return err
+	}
+
+	if err := r.validateUnsupportedFields(pod); err != nil {
+		r.recorder.Eventf(pod, api.EventTypeWarning, reasonUnsupportedPodFields, "Pod rejected: %v", err)
+		return err
+	}
+
+	if max := r.effectiveMaxPods(); max > 0 {
+		if podInfos, e := r.hyperClient.ListPods(); e == nil && len(podInfos) >= max {
+			return fmt.Errorf("Hyper: node VM pod limit (%d) reached, refusing to start pod %s", max, pod.Name)
+		}
+	}
+
 	podData, err = r.buildHyperPod(pod, restartCount, pullSecrets)
 	if err != nil {
 		glog.Errorf("Hyper: buildHyperPod failed, error: %v", err)
 		return err
 	}
+	trace.Step("Images pulled and hyperd pod spec built")
 
 	podFullName = kubecontainer.BuildPodFullName(pod.Name, pod.Namespace)
+
+	// Idempotence: a previous, partially observed attempt may already have
+	// created this pod in hyperd. Creating it again would leak a VM.
+	if existingID, e := r.hyperClient.GetPodIDByName(podFullName); e == nil && len(existingID) > 0 {
+		glog.V(2).Infof("Hyper: pod %s already exists as %s, skipping create", podFullName, existingID)
+		return r.hyperClient.StartPod(existingID)
+	}
+
 	err = r.savePodSpec(string(podData), podFullName)
 	if err != nil {
 		glog.Errorf("Hyper: savePodSpec failed, error: %v", err)
@@ -780,60 +1610,84 @@ func (r *runtime) RunPod(pod *api.Pod, restartCount int, pullSecrets []api.Secre
 
 	defer func() {
 		if err != nil {
-			specFileName := path.Join(hyperPodSpecDir, podFullName)
-			_, err = os.Stat(specFileName)
-			if err == nil {
-				e := os.Remove(specFileName)
-				if e != nil {
-					glog.Warningf("Hyper: delete spec file for %s failed, error: %v", podFullName, e)
-				}
-			}
-
-			if podID != "" {
-				destroyErr := r.hyperClient.RemovePod(podID)
-				if destroyErr != nil {
-					glog.Errorf("Hyper: destory pod %s (ID:%s) failed: %v", pod.Name, podID, destroyErr)
-				}
-			}
-
-			tearDownError := r.networkPlugin.TearDownPod(pod.Namespace, pod.Name, kubecontainer.ContainerID{}, "hyper")
-			if tearDownError != nil {
-				glog.Warningf("Hyper: networkPlugin.TearDownPod failed: %v, kubelet will continue to rm pod %s", tearDownError, pod.Name)
-			}
+			r.recordError("run pod "+podFullName, err)
+			r.rollbackPod(pod, podFullName, podID)
+			r.recorder.Eventf(pod, api.EventTypeWarning, errorEventReason(err, "FailedCreatePodSandbox"),
+				"Failed to create pod VM for %q: %v", podFullName, err)
 		}
 	}()
 
 	// Setup pod's network by network plugin
-	err = r.networkPlugin.SetUpPod(pod.Namespace, pod.Name, kubecontainer.ContainerID{}, "hyper")
+	err = r.setUpPodNetwork(pod)
 	if err != nil {
 		glog.Errorf("Hyper: networkPlugin.SetUpPod %s failed, error: %v", pod.Name, err)
 		return err
 	}
+	trace.Step("Network set up")
 
-	// Create and start hyper pod
-	specData, err := r.getPodSpec(podFullName)
+	// Create and start hyper pod. The spec is passed to hyperd directly;
+	// the file written above is only a redacted checkpoint.
+	var podSpec grpctypes.UserPod
+	err = json.Unmarshal(podData, &podSpec)
 	if err != nil {
-		glog.Errorf("Hyper: create pod %s failed, error: %v", podFullName, err)
+		glog.Errorf("Hyper: unmarshal pod %s from spec data error: %v", podFullName, err)
 		return err
 	}
 
-	var podSpec grpctypes.UserPod
-	err = json.Unmarshal([]byte(specData), &podSpec)
-	if err != nil {
-		glog.Errorf("Hyper: marshal pod %s from specData error: %v", podFullName, err)
+	// Refuse to boot a VM that would push its tenant past the node caps.
+	if r.featureEnabled(FeatureTenantAccounting) {
+		if err = r.checkTenantQuota(&podSpec); err != nil {
+			r.recorder.Eventf(pod, api.EventTypeWarning, "TenantQuotaExceeded", "Pod rejected: %v", err)
+			return err
+		}
 	}
 
+	// External scanners get a veto while nothing has booted yet.
+	if err = r.runPreStartHooks(pod, podData); err != nil {
+		r.recorder.Eventf(pod, api.EventTypeWarning, "PreStartHookVetoed", "Pod rejected: %v", err)
+		return err
+	}
+	trace.Step("Pre-start hooks passed")
+
+	// Throttle VM boot storms; kills in flight go first.
+	r.bootGate.enterBoot(r.configManager.getConfig().MaxConcurrentVMBoots)
+	trace.Step("Acquired VM boot slot")
+
+	r.notePoolMiss()
+
 	podID, err = r.hyperClient.CreatePod(&podSpec)
+	if err != nil && IsConflict(err) {
+		// A create that raced an earlier, partially observed attempt:
+		// adopt the existing pod instead of failing the sync.
+		if existingID, e := r.hyperClient.GetPodIDByName(podFullName); e == nil && len(existingID) > 0 {
+			glog.V(2).Infof("Hyper: pod %s already exists as %s, adopting it", podFullName, existingID)
+			podID, err = existingID, nil
+		}
+	}
 	if err != nil {
+		r.bootGate.exitBoot()
 		glog.Errorf("Hyper: create pod %s failed, error: %v", podData, err)
 		return err
 	}
+	trace.Step("Pod created in hyperd")
+	r.recorder.Eventf(pod, api.EventTypeNormal, kubecontainer.CreatedContainer, "Created pod VM with hyper id %v", podID)
 
 	err = r.hyperClient.StartPod(podID)
+	r.bootGate.exitBoot()
 	if err != nil {
 		glog.Errorf("Hyper: start pod %s (ID:%s) failed, error: %v", pod.Name, podID, err)
 		return err
 	}
+	trace.Step("Pod VM booted")
+	r.recorder.Eventf(pod, api.EventTypeNormal, kubecontainer.StartedContainer, "Started pod VM with hyper id %v", podID)
+
+	// Surface reduced exec/attach behavior of older guest agents on the pod,
+	// so degraded sessions are explainable from the pod's events.
+	if caps := r.agentCapabilities(); !caps.ExecExitCodes || !caps.TerminalResize {
+		r.recorder.Eventf(pod, api.EventTypeNormal, "DegradedGuestAgent",
+			"Guest agent lacks optional features (exec exit codes: %v, terminal resize: %v); exec and attach degrade gracefully",
+			caps.ExecExitCodes, caps.TerminalResize)
+	}
 
 	podStatus, err = r.GetPodStatus(pod.UID, pod.Name, pod.Namespace)
 	if err != nil {
@@ -856,6 +1710,8 @@ func (r *runtime) RunPod(pod *api.Pod, restartCount int, pullSecrets []api.Secre
 			glog.Errorf("Couldn't make a ref to pod %q, container %v: '%v'", pod.Name, container.Name, err)
 		} else {
 			r.containerRefManager.SetRef(containerID, ref)
+			r.recorder.Eventf(ref, api.EventTypeNormal, kubecontainer.CreatedContainer, "Created container with hyper id %v", containerID.ID)
+			r.recorder.Eventf(ref, api.EventTypeNormal, kubecontainer.StartedContainer, "Started container with hyper id %v", containerID.ID)
 		}
 
 		// Create a symbolic link to the Hyper container log file using a name
@@ -873,7 +1729,7 @@ func (r *runtime) RunPod(pod *api.Pod, restartCount int, pullSecrets []api.Secre
 			msg, handlerErr := r.runner.Run(containerID, pod, &container, container.Lifecycle.PostStart)
 			if handlerErr != nil {
 				err = fmt.Errorf("PostStart handler: %v, error msg is: %v", handlerErr, msg)
-				if e := r.KillPod(pod, runningPod, nil); e != nil {
+				if e := r.killPod(pod, runningPod, nil); e != nil {
 					glog.Errorf("KillPod %v failed: %v", podFullName, e)
 				}
 				return err
@@ -884,7 +1740,103 @@ func (r *runtime) RunPod(pod *api.Pod, restartCount int, pullSecrets []api.Secre
 	return nil
 }
 
+const (
+	// How many times RunPod retries network setup before failing the pod.
+	networkSetupRetries = 3
+
+	// Delay between network setup attempts.
+	networkSetupRetryDelay = 2 * time.Second
+)
+
+// setUpPodNetwork invokes the network plugin with bounded retries. A failed
+// attempt may leave partially configured state behind, so every retry is
+// preceded by a targeted TearDownPod of the previous attempt. Each outcome
+// is surfaced as a distinct pod event.
+func (r *runtime) setUpPodNetwork(pod *api.Pod) error {
+	var err error
+	for attempt := 0; attempt < networkSetupRetries; attempt++ {
+		if attempt > 0 {
+			// Clean up whatever the failed attempt left behind before
+			// trying again.
+			if tearDownErr := r.networkPlugin.TearDownPod(pod.Namespace, pod.Name, kubecontainer.ContainerID{}, "hyper"); tearDownErr != nil {
+				glog.Warningf("Hyper: cleanup of partial network state for pod %s failed: %v", pod.Name, tearDownErr)
+			}
+			r.recorder.Eventf(pod, api.EventTypeWarning, "NetworkSetupRetried",
+				"Retrying network setup for pod %q (attempt %d): %v", pod.Name, attempt+1, err)
+			time.Sleep(networkSetupRetryDelay)
+		}
+
+		err = r.networkPlugin.SetUpPod(pod.Namespace, pod.Name, kubecontainer.ContainerID{}, "hyper")
+		if err == nil {
+			if attempt > 0 {
+				r.recorder.Eventf(pod, api.EventTypeNormal, "NetworkSetupRecovered",
+					"Network setup for pod %q succeeded after %d retries", pod.Name, attempt)
+			}
+			return nil
+		}
+	}
+
+	r.recorder.Eventf(pod, api.EventTypeWarning, "NetworkSetupFailed",
+		"Network setup for pod %q failed after %d attempts: %v", pod.Name, networkSetupRetries, err)
+	return err
+}
+
+// doBackOff reports whether the pod restart should be delayed. The backoff is
+// keyed on the whole pod because hyper restarts the VM as a unit, and it is
+// computed from the finish time of the most recently exited container. While
+// the pod is in backoff a BackOff event is recorded and every container is
+// reported as CrashLoopBackOff so the reason surfaces in the API pod status.
+func (r *runtime) doBackOff(pod *api.Pod, podStatus *kubecontainer.PodStatus, backOff *flowcontrol.Backoff, result *kubecontainer.PodSyncResult) bool {
+	var ts time.Time
+	for _, c := range podStatus.ContainerStatuses {
+		if c.State == kubecontainer.ContainerStateExited && c.FinishedAt.After(ts) {
+			ts = c.FinishedAt
+		}
+	}
+	if ts.IsZero() {
+		return false
+	}
+
+	podFullName := kubecontainer.BuildPodFullName(pod.Name, pod.Namespace)
+	backOffKey := fmt.Sprintf("%s_%s", podFullName, pod.UID)
+	if backOff.IsInBackOffSince(backOffKey, ts) {
+		r.recorder.Eventf(pod, api.EventTypeWarning, kubecontainer.BackOffStartContainer, "Back-off restarting failed hyper pod")
+		msg := fmt.Sprintf("Back-off %s restarting failed pod %s", backOff.Get(backOffKey), podFullName)
+		glog.Infof("Hyper: %s", msg)
+		for _, container := range pod.Spec.Containers {
+			startResult := kubecontainer.NewSyncResult(kubecontainer.StartContainer, container.Name)
+			startResult.Fail(kubecontainer.ErrCrashLoopBackOff, msg)
+			result.AddSyncResult(startResult)
+		}
+		return true
+	}
+	backOff.Next(backOffKey, ts)
+	return false
+}
+
+// restartContainerInPod stops a single container and starts the pod again,
+// which boots only the containers that are not running. The VM and the other
+// containers stay untouched.
+func (r *runtime) restartContainerInPod(podFullName, containerID string) error {
+	podID, err := r.hyperClient.GetPodIDByName(podFullName)
+	if err != nil {
+		return err
+	}
+
+	if err := r.hyperClient.StopContainer(containerID); err != nil {
+		return err
+	}
+
+	return r.hyperClient.StartPod(podID)
+}
+
 // Syncs the running pod into the desired pod.
+//
+// SyncPod is idempotent with respect to kubelet restarts: every input to the
+// restart decision (container hash, restart count, liveness) is recovered
+// from hyperd or the probe managers rather than kept in kubelet memory, so a
+// kubelet binary upgrade adopts running VMs as-is and never restarts a
+// healthy, unchanged hyper pod.
 func (r *runtime) SyncPod(pod *api.Pod, podStatus api.PodStatus, internalPodStatus *kubecontainer.PodStatus, pullSecrets []api.Secret, backOff *flowcontrol.Backoff) (result kubecontainer.PodSyncResult) {
 	var err error
 	defer func() {
@@ -899,6 +1851,14 @@ func (r *runtime) SyncPod(pod *api.Pod, podStatus api.PodStatus, internalPodStat
 	runningPod := kubecontainer.ConvertPodStatusToRunningPod(internalPodStatus)
 	podFullName := kubecontainer.BuildPodFullName(pod.Name, pod.Namespace)
 
+	trace := util.NewTrace(fmt.Sprintf("Hyper SyncPod %s (UID %s)", podFullName, pod.UID))
+	defer trace.LogIfLong(podLifecycleTraceThreshold)
+
+	// Serialize against deletes and the garbage collector; the restart
+	// decision below must act on the state it observed.
+	r.podLocks.lock(podFullName)
+	defer r.podLocks.unlock(podFullName)
+
 	// Add references to all containers.
 	unidentifiedContainers := make(map[kubecontainer.ContainerID]*kubecontainer.Container)
 	for _, c := range runningPod.Containers {
@@ -929,20 +1889,49 @@ func (r *runtime) SyncPod(pod *api.Pod, podStatus api.PodStatus, internalPodStat
 
 		liveness, found := r.livenessManager.Get(c.ID)
 		if found && liveness != proberesults.Success && pod.Spec.RestartPolicy != api.RestartPolicyNever {
-			glog.Infof("Pod %q container %q is unhealthy, it will be killed and re-created.", podFullName, container.Name)
-			restartPod = true
-			break
+			// Restart only the unhealthy container; recreating the whole
+			// VM would take down its healthy neighbours.
+			glog.Infof("Pod %q container %q is unhealthy, restarting it in place.", podFullName, container.Name)
+			if err := r.restartContainerInPod(podFullName, c.ID.ID); err != nil {
+				glog.Warningf("Hyper: in-place restart of container %q of pod %q failed: %v, recreating the pod", container.Name, podFullName, err)
+				restartPod = true
+				break
+			}
 		}
 
 		delete(unidentifiedContainers, c.ID)
 	}
 
+	// Injected debug containers are not part of the pod spec and must not
+	// make the sync loop recreate the pod.
+	for id, c := range unidentifiedContainers {
+		if isDebugContainerName(c.Name) {
+			delete(unidentifiedContainers, id)
+		}
+	}
+
 	// If there is any unidentified containers, restart the pod.
 	if len(unidentifiedContainers) > 0 {
 		restartPod = true
 	}
+	trace.Step("Computed restart decision")
 
 	if restartPod {
+		// A quarantined pod used up its VM recreation budget; leave it
+		// down until the quarantine expires.
+		if r.podQuarantined(pod, &result) {
+			return
+		}
+
+		// A hyper pod restarts as a unit, so apply the restart backoff before
+		// booting a new VM; a crashing container must not spin up VMs as fast
+		// as hyperd can create them.
+		if r.doBackOff(pod, internalPodStatus, backOff, &result) {
+			return
+		}
+
+		r.recordVMRecreation(pod)
+
 		restartCount := 0
 		// Only kill existing pod
 		podID, err := r.hyperClient.GetPodIDByName(podFullName)
@@ -955,22 +1944,51 @@ func (r *runtime) SyncPod(pod *api.Pod, podStatus api.PodStatus, internalPodStat
 			}
 			restartCount++
 
-			if err = r.KillPod(pod, runningPod, nil); err != nil {
+			if err = r.killPod(pod, runningPod, nil); err != nil {
 				glog.Errorf("Hyper: kill pod %s failed, error: %s", runningPod.Name, err)
 				return
 			}
+			trace.Step("Killed stale pod")
 		}
 
-		if err := r.RunPod(pod, restartCount, pullSecrets); err != nil {
+		if err := r.runPod(pod, restartCount, pullSecrets); err != nil {
 			glog.Errorf("Hyper: run pod %s failed, error: %s", pod.Name, err)
 			return
 		}
+		trace.Step("Recreated pod")
 	}
 	return
 }
 
-// KillPod kills all the containers of a pod.
+// KillPod kills all the containers of a pod, holding its per-pod lock.
 func (r *runtime) KillPod(pod *api.Pod, runningPod kubecontainer.Pod, gracePeriodOverride *int64) error {
+	podName, podNamespace := runningPod.Name, runningPod.Namespace
+	if len(podName) == 0 && pod != nil {
+		podName, podNamespace = pod.Name, pod.Namespace
+	}
+	if len(podName) == 0 {
+		return nil
+	}
+
+	podFullName := kubecontainer.BuildPodFullName(podName, podNamespace)
+	r.podLocks.lock(podFullName)
+	defer r.podLocks.unlock(podFullName)
+
+	return r.killPod(pod, runningPod, gracePeriodOverride)
+}
+
+// killPod is KillPod without the per-pod lock, for callers already holding
+// it.
+func (r *runtime) killPod(pod *api.Pod, runningPod kubecontainer.Pod, gracePeriodOverride *int64) error {
+	if err := r.checkReadOnly("kill pod " + runningPod.Name); err != nil {
+		return err
+	}
+
+	// give annotated pods their early heads-up before the VM goes away
+	if pod != nil {
+		r.deliverTerminationNotice(pod, runningPod, gracePeriodOverride)
+	}
+
 	var (
 		podID        string
 		podFullName  string
@@ -992,6 +2010,9 @@ func (r *runtime) KillPod(pod *api.Pod, runningPod kubecontainer.Pod, gracePerio
 	podFullName = kubecontainer.BuildPodFullName(podName, podNamespace)
 	glog.V(4).Infof("Hyper: killing pod %q.", podFullName)
 
+	trace := util.NewTrace(fmt.Sprintf("Hyper KillPod %s (UID %s)", podFullName, runningPod.ID))
+	defer trace.LogIfLong(podLifecycleTraceThreshold)
+
 	defer func() {
 		// Teardown pod's network
 		err = r.networkPlugin.TearDownPod(podNamespace, podName, kubecontainer.ContainerID{}, "hyper")
@@ -999,8 +2020,11 @@ func (r *runtime) KillPod(pod *api.Pod, runningPod kubecontainer.Pod, gracePerio
 			glog.Warningf("Hyper: networkPlugin.TearDownPod failed, error: %v", err)
 		}
 
+		// Release the hardened bind mounts backing read-only vfs shares
+		r.cleanupHardenedMounts(podFullName)
+
 		// Delete pod spec file
-		specFileName := path.Join(hyperPodSpecDir, podFullName)
+		specFileName := path.Join(r.specDir, podFullName)
 		_, err = os.Stat(specFileName)
 		if err == nil {
 			e := os.Remove(specFileName)
@@ -1012,6 +2036,9 @@ func (r *runtime) KillPod(pod *api.Pod, runningPod kubecontainer.Pod, gracePerio
 
 	// preStop hook
 	for _, c := range runningPod.Containers {
+		if ref, ok := r.containerRefManager.GetRef(c.ID); ok {
+			r.recorder.Eventf(ref, api.EventTypeNormal, kubecontainer.KillingContainer, "Killing container with hyper id %v", c.ID.ID)
+		}
 		r.containerRefManager.ClearRef(c.ID)
 
 		var container *api.Container
@@ -1060,6 +2087,7 @@ func (r *runtime) KillPod(pod *api.Pod, runningPod kubecontainer.Pod, gracePerio
 			gracePeriod = minimumGracePeriodInSeconds
 		}
 	}
+	trace.Step("PreStop hooks done")
 
 	podInfos, err := r.hyperClient.ListPods()
 	if err != nil {
@@ -1071,9 +2099,13 @@ func (r *runtime) KillPod(pod *api.Pod, runningPod kubecontainer.Pod, gracePerio
 		if podInfo.PodName == podFullName {
 			podID = podInfo.PodID
 
+			// Persist the container logs before the VM is removed, for
+			// `kubectl logs --previous`.
+			r.archiveContainerLogs(podInfo)
+
 			// Remove log links
 			for _, c := range podInfo.PodInfo.Status.ContainerStatus {
-				_, _, _, containerName, _, _, err := r.parseHyperContainerFullName(c.Name)
+				containerName, _, _, err := r.containerMetadata(c.Name, containerSpecLabels(podInfo.PodInfo.Spec, c.ContainerID))
 				if err != nil {
 					continue
 				}
@@ -1087,12 +2119,32 @@ func (r *runtime) KillPod(pod *api.Pod, runningPod kubecontainer.Pod, gracePerio
 			break
 		}
 	}
+	trace.Step("Archived container logs")
+
+	// Idempotence: the pod may already be gone, e.g. when a delete raced a
+	// sync that decided to recreate it.
+	if len(podID) == 0 {
+		glog.V(4).Infof("Hyper: pod %s is already gone from hyperd", podFullName)
+		return nil
+	}
 
+	// Under pressure, freeing a VM must not queue behind boot slots. The
+	// priority window covers only the hyperd removal itself; notice sleeps
+	// and preStop hooks above must not stall boots node-wide.
+	r.bootGate.enterKill()
 	err = r.hyperClient.RemovePod(podID)
+	r.bootGate.exitKill()
 	if err != nil {
+		// A remove that raced another delete reached its goal.
+		if IsPodNotFound(err) {
+			glog.V(4).Infof("Hyper: pod %s was already removed", podFullName)
+			return nil
+		}
 		glog.Errorf("Hyper: remove pod %s failed, error: %s", podID, err)
+		r.recordError("kill pod "+podFullName, err)
 		return err
 	}
+	trace.Step("Pod removed from hyperd")
 
 	return nil
 }
@@ -1136,16 +2188,27 @@ func (r *runtime) GetPodStatus(uid types.UID, name, namespace string) (*kubecont
 		for _, containerInfo := range podInfo.PodInfo.Status.ContainerStatus {
 			for _, container := range podInfo.PodInfo.Spec.Containers {
 				if container.ContainerID == containerInfo.ContainerID {
-					c := r.getContainerStatus(containerInfo, container.Image, container.ImageID,
-						podInfo.PodInfo.Status.StartTime, podInfo.PodInfo.Spec.Labels)
+					c := r.getContainerStatus(containerInfo, container.Labels, container.Image, container.ImageID,
+						podInfo.PodInfo.CreatedAt, podInfo.PodInfo.Status.StartTime, podInfo.PodInfo.Status.FinishTime,
+						podInfo.Status, podInfo.PodInfo.Spec.Labels)
+					r.applyDeadlineReason(podInfo.PodID, c)
 					status.ContainerStatuses = append(
 						status.ContainerStatuses,
 						c)
+					r.noteAbnormalTermination(podInfo, c)
 				}
 			}
 		}
 	}
 
+	// The pod may have run to completion and had its VM released; serve the
+	// checkpointed final status so the terminal phase stays accurate.
+	if len(status.ContainerStatuses) == 0 {
+		if saved, ok := r.loadFinalStatus(uid); ok {
+			return saved, nil
+		}
+	}
+
 	glog.V(5).Infof("Hyper: get pod %s status %s", podFullName, status)
 
 	return status, nil
@@ -1154,22 +2217,43 @@ func (r *runtime) GetPodStatus(uid types.UID, name, namespace string) (*kubecont
 // PullImage pulls an image from the network to local storage using the supplied
 // secrets if necessary.
 func (r *runtime) PullImage(image kubecontainer.ImageSpec, pullSecrets []api.Secret) error {
-	img := image.Image
+	if err := r.checkReadOnly("pull image " + image.Image); err != nil {
+		return err
+	}
+
+	img := r.registryConfig.mirrorImage(image.Image)
+	if img != image.Image {
+		glog.V(4).Infof("Hyper: pulling image %s through mirror as %s", image.Image, img)
+	}
+	if registry := imageRegistry(img); r.registryConfig.isInsecureRegistry(registry) {
+		glog.V(4).Infof("Hyper: registry %s is configured as insecure", registry)
+	}
 
 	repoToPull, tag := parseImageName(img)
 	if exist, _ := r.hyperClient.IsImagePresent(repoToPull, tag); exist {
 		return nil
 	}
 
-	keyring, err := credentialprovider.MakeDockerKeyring(pullSecrets, r.dockerKeyring)
-	if err != nil {
+	trace := util.NewTrace(fmt.Sprintf("Hyper PullImage %s", img))
+	defer trace.LogIfLong(podLifecycleTraceThreshold)
+
+	// node image policy and signature policy decide before hyperd sees
+	// the reference
+	if err := r.checkImagePolicy(img); err != nil {
+		r.recordError("pull image "+img, err)
+		return err
+	}
+	if err := r.verifyImageSignature(img); err != nil {
+		r.recordError("verify image "+img, err)
 		return err
 	}
+	trace.Step("Image signature verified")
 
-	creds, ok := keyring.Lookup(repoToPull)
-	if !ok || len(creds) == 0 {
-		glog.V(4).Infof("Hyper: pulling image %s without credentials", img)
+	creds, err := r.lookupPullCredentials(repoToPull, pullSecrets)
+	if err != nil {
+		return err
 	}
+	trace.Step("Resolved pull credentials")
 
 	var credential string
 	if len(creds) > 0 {
@@ -1182,13 +2266,22 @@ func (r *runtime) PullImage(image kubecontainer.ImageSpec, pullSecrets []api.Sec
 
 	err = r.hyperClient.PullImage(img, credential)
 	if err != nil {
+		r.recordError("pull image "+img, err)
+		// Keep classified errors intact so callers can tell a missing
+		// image from an unreachable daemon.
+		if errorKind(err) != nil {
+			return err
+		}
 		return fmt.Errorf("Hyper: Failed to pull image: %v", err)
 	}
+	trace.Step("Image pulled")
 
-	if exist, _ := r.hyperClient.IsImagePresent("haproxy", "1.5"); !exist {
-		err = r.hyperClient.PullImage("haproxy:1.5", credential)
+	proxyImage := r.configManager.getConfig().ProxyImage
+	proxyRepo, proxyTag := parseImageName(proxyImage)
+	if exist, _ := r.hyperClient.IsImagePresent(proxyRepo, proxyTag); !exist {
+		err = r.hyperClient.PullImage(proxyImage, credential)
 		if err != nil {
-			return fmt.Errorf("Hyper: Failed to pull haproxy:1.5 image: %v", err)
+			return fmt.Errorf("Hyper: Failed to pull %s image: %v", proxyImage, err)
 		}
 	}
 
@@ -1228,6 +2321,10 @@ func (r *runtime) ListImages() ([]kubecontainer.Image, error) {
 
 // Removes the specified image.
 func (r *runtime) RemoveImage(image kubecontainer.ImageSpec) error {
+	if err := r.checkReadOnly("remove image " + image.Image); err != nil {
+		return err
+	}
+
 	err := r.hyperClient.RemoveImage(image.Image)
 	if err != nil {
 		return err
@@ -1243,16 +2340,31 @@ func (r *runtime) RemoveImage(image kubecontainer.ImageSpec) error {
 func (r *runtime) GetContainerLogs(pod *api.Pod, containerID kubecontainer.ContainerID, logOptions *api.PodLogOptions, stdout, stderr io.Writer) error {
 	glog.V(4).Infof("Hyper: running logs on container %s", containerID.ID)
 
+	if logOptions.Previous {
+		return r.copyPreviousLogs(pod, containerID, stdout)
+	}
+
+	// hyperd expects an absolute timestamp; SinceTime wins over SinceSeconds
+	// like in the docker runtime.
 	var tailLines, since int64
 	if logOptions.SinceSeconds != nil && *logOptions.SinceSeconds != 0 {
-		since = *logOptions.SinceSeconds
+		since = time.Now().Add(-time.Duration(*logOptions.SinceSeconds) * time.Second).Unix()
+	}
+	if logOptions.SinceTime != nil && !logOptions.SinceTime.IsZero() {
+		since = logOptions.SinceTime.Unix()
 	}
 	if logOptions.TailLines != nil && *logOptions.TailLines != 0 {
 		tailLines = *logOptions.TailLines
 	}
+
+	output := io.Writer(stdout)
+	if logOptions.LimitBytes != nil && *logOptions.LimitBytes > 0 {
+		output = &limitWriter{w: stdout, remaining: *logOptions.LimitBytes}
+	}
+
 	opts := ContainerLogsOptions{
 		Container:    containerID.ID,
-		OutputStream: stdout,
+		OutputStream: output,
 		ErrorStream:  stderr,
 		Follow:       logOptions.Follow,
 		Timestamps:   logOptions.Timestamps,
@@ -1260,7 +2372,41 @@ func (r *runtime) GetContainerLogs(pod *api.Pod, containerID kubecontainer.Conta
 		TailLines:    tailLines,
 	}
 
-	return r.hyperClient.ContainerLogs(opts)
+	err := r.hyperClient.ContainerLogs(opts)
+	if err == errLogLimitReached {
+		// The requested byte limit was served; not an error.
+		return nil
+	}
+	return err
+}
+
+// errLogLimitReached stops the log stream once logOptions.LimitBytes bytes
+// were written.
+var errLogLimitReached = errors.New("container log byte limit reached")
+
+// limitWriter writes at most the configured number of bytes to the underlying
+// writer and then fails with errLogLimitReached.
+type limitWriter struct {
+	w         io.Writer
+	remaining int64
+}
+
+func (l *limitWriter) Write(p []byte) (int, error) {
+	if l.remaining <= 0 {
+		return 0, errLogLimitReached
+	}
+	if int64(len(p)) > l.remaining {
+		p = p[:l.remaining]
+	}
+	n, err := l.w.Write(p)
+	l.remaining -= int64(n)
+	if err != nil {
+		return n, err
+	}
+	if l.remaining == 0 {
+		return n, errLogLimitReached
+	}
+	return n, nil
 }
 
 // hyperExitError implemets /pkg/util/exec.ExitError interface.
@@ -1275,21 +2421,55 @@ func (r *hyperExitError) ExitStatus() int {
 	return 0
 }
 
+// execSyncExitError reports a non-zero exit code of a synchronous exec. It
+// implements /pkg/util/exec.ExitError so exec probes treat it as a probe
+// failure rather than a runtime error.
+type execSyncExitError struct {
+	code   int
+	stderr []byte
+}
+
+var _ utilexec.ExitError = &execSyncExitError{}
+
+func (e *execSyncExitError) String() string { return e.Error() }
+func (e *execSyncExitError) Error() string {
+	return fmt.Sprintf("command terminated with exit code %d: %s", e.code, string(e.stderr))
+}
+func (e *execSyncExitError) Exited() bool    { return true }
+func (e *execSyncExitError) ExitStatus() int { return e.code }
+
 // Runs the command in the container of the specified pod
-func (r *runtime) RunInContainer(containerID kubecontainer.ContainerID, cmd []string) ([]byte, error) {
+func (r *runtime) RunInContainer(containerID kubecontainer.ContainerID, cmd []string) (output []byte, err error) {
 	glog.V(4).Infof("Hyper: running %s in container %s.", cmd, containerID.ID)
 
-	buffer := bytes.NewBuffer(nil)
-	err := r.ExecInContainer(containerID, cmd, nil, nopCloser{buffer}, nil, false)
-	if err != nil {
-		if exitErr, ok := err.(*exec.ExitError); ok {
-			err = &hyperExitError{exitErr}
+	start := time.Now()
+	defer func() { r.auditExec("run", "kubelet", containerID, cmd, start, err) }()
+
+	if caps := r.agentCapabilities(); !caps.ExecExitCodes {
+		glog.V(2).Infof("Hyper: guest agent of container %s does not report exec exit codes, the command result is based on the stream outcome only", containerID.ID)
+
+		buffer := bytes.NewBuffer(nil)
+		err := r.ExecInContainer(containerID, cmd, nil, nopCloser{buffer}, nil, false)
+		if err != nil {
+			if exitErr, ok := err.(*exec.ExitError); ok {
+				err = &hyperExitError{exitErr}
+			}
+
+			return nil, err
 		}
 
+		return buffer.ReadBytes('\n')
+	}
+
+	stdout, stderr, exitCode, err := r.hyperClient.ExecSync(containerID.ID, cmd, defaultProbeExecTimeout)
+	if err != nil {
 		return nil, err
 	}
+	if exitCode != 0 {
+		return stdout, &execSyncExitError{code: int(exitCode), stderr: stderr}
+	}
 
-	return buffer.ReadBytes('\n')
+	return stdout, nil
 }
 
 // Forward the specified port from the specified pod to the stream.
@@ -1301,9 +2481,18 @@ func (r *runtime) PortForward(pod *kubecontainer.Pod, port uint16, stream io.Rea
 // Runs the command in the container of the specified pod.
 // Attaches the processes stdin, stdout, and stderr. Optionally uses a
 // tty.
-func (r *runtime) ExecInContainer(containerID kubecontainer.ContainerID, cmd []string, stdin io.Reader, stdout, stderr io.WriteCloser, tty bool) error {
+func (r *runtime) ExecInContainer(containerID kubecontainer.ContainerID, cmd []string, stdin io.Reader, stdout, stderr io.WriteCloser, tty bool) (err error) {
 	glog.V(4).Infof("Hyper: execing %s in container %s.", cmd, containerID.ID)
 
+	start := time.Now()
+	defer func() { r.auditExec("exec", "api-client", containerID, cmd, start, err) }()
+
+	if caps := r.agentCapabilities(); tty && !caps.TerminalResize {
+		// Degrade instead of failing: the session works, the terminal just
+		// keeps its initial size.
+		glog.V(2).Infof("Hyper: guest agent of container %s does not support terminal resize, the exec session will keep its initial size", containerID.ID)
+	}
+
 	opts := ExecInContainerOptions{
 		Container:    containerID.ID,
 		InputStream:  stdin,
@@ -1312,13 +2501,19 @@ func (r *runtime) ExecInContainer(containerID kubecontainer.ContainerID, cmd []s
 		Commands:     cmd,
 		TTY:          tty,
 	}
+	if secs := r.configManager.getConfig().ExecTimeoutSeconds; secs > 0 {
+		opts.Timeout = time.Duration(secs) * time.Second
+	}
 
 	return r.hyperClient.Exec(opts)
 }
 
-func (r *runtime) AttachContainer(containerID kubecontainer.ContainerID, stdin io.Reader, stdout, stderr io.WriteCloser, tty bool) error {
+func (r *runtime) AttachContainer(containerID kubecontainer.ContainerID, stdin io.Reader, stdout, stderr io.WriteCloser, tty bool) (err error) {
 	glog.V(4).Infof("Hyper: attaching container %s.", containerID.ID)
 
+	start := time.Now()
+	defer func() { r.auditExec("attach", "api-client", containerID, nil, start, err) }()
+
 	opts := AttachToContainerOptions{
 		Container:    containerID.ID,
 		InputStream:  stdin,
@@ -1356,7 +2551,19 @@ func (r *runtime) ConvertPodStatusToAPIPodStatus(pod *api.Pod, status *kubeconta
 			}
 		default:
 			// Unknown state.
-			st.Waiting = &api.ContainerStateWaiting{}
+			st.Waiting = &api.ContainerStateWaiting{
+				Reason:  c.Reason,
+				Message: c.Message,
+			}
+		}
+
+		// A running container is ready unless its readiness probe says
+		// otherwise; exited and waiting containers are never ready.
+		ready := st.Running != nil
+		if ready && r.readinessManager != nil {
+			if result, ok := r.readinessManager.Get(c.ID); ok {
+				ready = result == proberesults.Success
+			}
 		}
 
 		status, ok := containerStatuses[c.Name]
@@ -1367,6 +2574,7 @@ func (r *runtime) ConvertPodStatusToAPIPodStatus(pod *api.Pod, status *kubeconta
 				ImageID:      c.ImageID,
 				ContainerID:  c.ID.String(),
 				RestartCount: int32(c.RestartCount),
+				Ready:        ready,
 				State:        st,
 			}
 			continue
@@ -1386,8 +2594,9 @@ func (r *runtime) ConvertPodStatusToAPIPodStatus(pod *api.Pod, status *kubeconta
 			cs = &api.ContainerStatus{
 				Name:  c.Name,
 				Image: c.Image,
-				// TODO(yifan): Add reason and message.
-				State: api.ContainerState{Waiting: &api.ContainerStateWaiting{}},
+				State: api.ContainerState{Waiting: &api.ContainerStateWaiting{
+					Reason: "ContainerCreating",
+				}},
 			}
 		}
 		apiPodStatus.ContainerStatuses = append(apiPodStatus.ContainerStatuses, *cs)
@@ -1399,15 +2608,27 @@ func (r *runtime) ConvertPodStatusToAPIPodStatus(pod *api.Pod, status *kubeconta
 }
 
 func (r *runtime) GarbageCollect(gcPolicy kubecontainer.ContainerGCPolicy, allSourcesReady bool) error {
+	if err := r.checkReadOnly("garbage collect"); err != nil {
+		return err
+	}
+
+	// In dry-run mode only report what would be removed.
+	if r.configManager.getConfig().GCDryRun {
+		_, err := r.gcDryRun(gcPolicy.MinAge)
+		return err
+	}
+
 	podInfos, err := r.hyperClient.ListPods()
 	if err != nil {
 		return err
 	}
 
+	// First pass: pick the condemned pods and persist their logs while the
+	// VMs still exist.
+	var condemned []HyperPod
 	for _, pod := range podInfos {
 		// omit not managed pods
-		podName, podNamespace, err := kubecontainer.ParsePodFullName(pod.PodName)
-		if err != nil {
+		if _, _, err := kubecontainer.ParsePodFullName(pod.PodName); err != nil {
 			continue
 		}
 
@@ -1420,47 +2641,90 @@ func (r *runtime) GarbageCollect(gcPolicy kubecontainer.ContainerGCPolicy, allSo
 		if err != nil {
 			continue
 		}
+		if !lastTime.Before(time.Now().Add(-gcPolicy.MinAge)) {
+			continue
+		}
 
-		if lastTime.Before(time.Now().Add(-gcPolicy.MinAge)) {
-			// Remove log links
-			for _, c := range pod.PodInfo.Status.ContainerStatus {
-				_, _, _, containerName, _, _, err := r.parseHyperContainerFullName(c.Name)
-				if err != nil {
-					continue
-				}
-				symlinkFile := LogSymlink(r.containerLogsDir, pod.PodName, containerName, c.ContainerID)
-				err = os.Remove(symlinkFile)
-				if err != nil && !os.IsNotExist(err) {
-					glog.Warningf("Failed to remove container log symlink %q: %v", symlinkFile, err)
-				}
-			}
+		// Serialize with syncs and deletes of the same pod.
+		r.podLocks.lock(pod.PodName)
 
-			// TODO(harryz) use allSourcesReady to prevent aggressive actions
-			// Remove the pod
-			err = r.hyperClient.RemovePod(pod.PodID)
-			if err != nil {
-				glog.Warningf("Hyper GarbageCollect: remove pod %s failed, error: %s", pod.PodID, err)
-				return err
-			}
+		// Persist the container logs before the VM is removed, for
+		// `kubectl logs --previous`.
+		r.archiveContainerLogs(pod)
 
-			// KillPod is only called for running Pods, we should teardown network here for non-running Pods
-			err = r.networkPlugin.TearDownPod(podNamespace, podName, kubecontainer.ContainerID{}, "hyper")
+		// Remove log links
+		for _, c := range pod.PodInfo.Status.ContainerStatus {
+			containerName, _, _, err := r.containerMetadata(c.Name, containerSpecLabels(pod.PodInfo.Spec, c.ContainerID))
 			if err != nil {
-				glog.Warningf("Hyper: networkPlugin.TearDownPod failed, error: %v", err)
+				continue
+			}
+			symlinkFile := LogSymlink(r.containerLogsDir, pod.PodName, containerName, c.ContainerID)
+			err = os.Remove(symlinkFile)
+			if err != nil && !os.IsNotExist(err) {
+				glog.Warningf("Failed to remove container log symlink %q: %v", symlinkFile, err)
 			}
+		}
 
-			// Delete pod spec file
-			specFileName := path.Join(hyperPodSpecDir, pod.PodName)
-			_, err = os.Stat(specFileName)
-			if err == nil {
-				e := os.Remove(specFileName)
-				if e != nil {
-					glog.Warningf("Hyper: delete spec file for %s failed, error: %v", pod.PodName, e)
-				}
+		r.podLocks.unlock(pod.PodName)
+		condemned = append(condemned, pod)
+	}
+
+	// TODO(harryz) use allSourcesReady to prevent aggressive actions
+	// Remove the condemned pods in one concurrent batch; a node drain leaves
+	// dozens of them, and destroying VMs one after another takes minutes.
+	if len(condemned) > 0 {
+		podIDs := make([]string, 0, len(condemned))
+		for _, pod := range condemned {
+			podIDs = append(podIDs, pod.PodID)
+		}
+		if err := r.hyperClient.RemovePods(podIDs); err != nil {
+			glog.Warningf("Hyper GarbageCollect: batch pod removal failed, error: %s", err)
+			return err
+		}
+	}
+
+	// Second pass: tear down what the removed pods leave on the node.
+	for _, pod := range condemned {
+		podName, podNamespace, err := kubecontainer.ParsePodFullName(pod.PodName)
+		if err != nil {
+			continue
+		}
+
+		r.podLocks.lock(pod.PodName)
+
+		// KillPod is only called for running Pods, we should teardown network here for non-running Pods
+		err = r.networkPlugin.TearDownPod(podNamespace, podName, kubecontainer.ContainerID{}, "hyper")
+		if err != nil {
+			glog.Warningf("Hyper: networkPlugin.TearDownPod failed, error: %v", err)
+		}
+
+		// Delete pod spec file
+		specFileName := path.Join(r.specDir, pod.PodName)
+		_, err = os.Stat(specFileName)
+		if err == nil {
+			e := os.Remove(specFileName)
+			if e != nil {
+				glog.Warningf("Hyper: delete spec file for %s failed, error: %v", pod.PodName, e)
 			}
 		}
+
+		// The pod is gone for good, drop its image digest pins
+		if uid := pod.PodInfo.Spec.Labels[KEY_API_POD_UID]; uid != "" {
+			removeImagePins(uid)
+		}
+
+		r.podLocks.unlock(pod.PodName)
 	}
 
+	// Remove spec checkpoints of pods hyperd no longer knows about
+	r.cleanupOrphanedSpecFiles(podInfos)
+
+	// Remove volume artifacts of pods hyperd no longer knows about
+	r.cleanupOrphanedVolumeArtifacts(podInfos)
+
+	// Drop archived previous logs past their retention
+	r.prunePreviousLogs()
+
 	// Remove dead symlinks - should only happen on upgrade
 	// from a k8s version without proper log symlink cleanup
 	logSymlinks, _ := filepath.Glob(path.Join(r.containerLogsDir, "*.log"))
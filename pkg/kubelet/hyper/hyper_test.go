@@ -0,0 +1,232 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyper
+
+import (
+	"strings"
+	"testing"
+
+	"k8s.io/kubernetes/pkg/api"
+	kubecontainer "k8s.io/kubernetes/pkg/kubelet/container"
+	proberesults "k8s.io/kubernetes/pkg/kubelet/prober/results"
+	"k8s.io/kubernetes/pkg/types"
+)
+
+// TestSyncPodAdoptsHealthyPod verifies the kubelet upgrade guarantee: when
+// the observed pod state (as rebuilt from hyperd after a kubelet restart)
+// matches the desired spec and the containers are healthy, SyncPod must not
+// restart the pod. The runtime under test has no hyper client at all, so any
+// attempt to kill or recreate the pod would panic.
+func TestSyncPodAdoptsHealthyPod(t *testing.T) {
+	container := api.Container{Name: "bar", Image: "busybox"}
+	pod := &api.Pod{
+		ObjectMeta: api.ObjectMeta{
+			UID:       types.UID("12345678"),
+			Name:      "foo",
+			Namespace: "default",
+		},
+		Spec: api.PodSpec{
+			Containers: []api.Container{container},
+		},
+	}
+
+	internalPodStatus := &kubecontainer.PodStatus{
+		ID:        pod.UID,
+		Name:      pod.Name,
+		Namespace: pod.Namespace,
+		ContainerStatuses: []*kubecontainer.ContainerStatus{
+			{
+				ID:    kubecontainer.ContainerID{Type: typeHyper, ID: "c1"},
+				Name:  container.Name,
+				Image: container.Image,
+				Hash:  kubecontainer.HashContainer(&container),
+				State: kubecontainer.ContainerStateRunning,
+			},
+		},
+	}
+
+	r := &runtime{livenessManager: proberesults.NewManager()}
+	result := r.SyncPod(pod, api.PodStatus{}, internalPodStatus, nil, nil)
+	if result.Error() != nil {
+		t.Errorf("unexpected sync error for healthy pod: %v", result.Error())
+	}
+}
+
+// TestContainerMetadataLabelFallback verifies that container metadata is
+// resolved from labels when present, including names the legacy encoding
+// cannot represent, and from the underscore-delimited full name otherwise.
+func TestContainerMetadataLabelFallback(t *testing.T) {
+	r := &runtime{}
+
+	labels := map[string]string{
+		kubernetesContainerNameLabel:         "my_container",
+		kubernetesContainerRestartCountLabel: "3",
+		kubernetesContainerHashLabel:         "deadbeef",
+	}
+	name, restartCount, hash, err := r.containerMetadata("kube_uid_has_many_underscores", labels)
+	if err != nil {
+		t.Fatalf("unexpected error resolving labelled container: %v", err)
+	}
+	if name != "my_container" || restartCount != 3 || hash != "deadbeef" {
+		t.Errorf("unexpected metadata from labels: %q %d %q", name, restartCount, hash)
+	}
+
+	name, restartCount, hash, err = r.containerMetadata("kube_12345678_foo_default_bar_2_cafe", nil)
+	if err != nil {
+		t.Fatalf("unexpected error resolving legacy container name: %v", err)
+	}
+	if name != "bar" || restartCount != 2 || hash != "cafe" {
+		t.Errorf("unexpected metadata from legacy name: %q %d %q", name, restartCount, hash)
+	}
+}
+
+func TestPodTmpfsVolumes(t *testing.T) {
+	pod := &api.Pod{
+		ObjectMeta: api.ObjectMeta{
+			Annotations: map[string]string{
+				tmpfsSizeAnnotationPrefix + "scratch": "256M",
+			},
+		},
+		Spec: api.PodSpec{
+			Volumes: []api.Volume{
+				{Name: "scratch", VolumeSource: api.VolumeSource{EmptyDir: &api.EmptyDirVolumeSource{Medium: api.StorageMediumMemory}}},
+				{Name: "cache", VolumeSource: api.VolumeSource{EmptyDir: &api.EmptyDirVolumeSource{Medium: api.StorageMediumMemory}}},
+				{Name: "disk", VolumeSource: api.VolumeSource{EmptyDir: &api.EmptyDirVolumeSource{}}},
+			},
+		},
+	}
+
+	volumes := podTmpfsVolumes(pod)
+	if len(volumes) != 2 {
+		t.Fatalf("expected 2 tmpfs volumes, got %v", volumes)
+	}
+	if volumes["scratch"] != "256M" {
+		t.Errorf("expected annotated size 256M for scratch, got %q", volumes["scratch"])
+	}
+	if volumes["cache"] != defaultTmpfsSize {
+		t.Errorf("expected default size for cache, got %q", volumes["cache"])
+	}
+}
+
+func TestRedactPodSpec(t *testing.T) {
+	spec := []byte(`{"containers":[{"name":"c1","envs":[{"env":"TOKEN","value":"tokenvalue"}]}],` +
+		`"volumes":[{"name":"data","option":{"monitors":["10.0.0.1:6789"],"secret":"cephkey","keyring":"rbdkeyring"}}]}`)
+	redacted, err := redactPodSpec(spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, leaked := range []string{"tokenvalue", "cephkey", "rbdkeyring"} {
+		if strings.Contains(string(redacted), leaked) {
+			t.Errorf("redacted spec still contains %q: %s", leaked, redacted)
+		}
+	}
+	if !strings.Contains(string(redacted), "TOKEN") {
+		t.Errorf("redacted spec should keep env names: %s", redacted)
+	}
+	if !strings.Contains(string(redacted), "10.0.0.1:6789") {
+		t.Errorf("redacted spec should keep non-credential volume options: %s", redacted)
+	}
+}
+
+func TestParseProcStat(t *testing.T) {
+	// Command names may contain spaces and parentheses.
+	line := "42 (tmux (server)) S 1 42 42 0 -1 4194560 1000 0 0 0 7 3 0 0 20 0 1 0 100 4558848 256 18446744073709551615 0 0 0 0 0 0 0 0 0 0 0 0 17 0 0 0 0 0 0"
+	process, err := parseProcStat(line)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if process.Pid != 42 {
+		t.Errorf("expected pid 42, got %d", process.Pid)
+	}
+	if process.Command != "tmux (server)" {
+		t.Errorf("expected command %q, got %q", "tmux (server)", process.Command)
+	}
+	if process.CPUTicks != 10 {
+		t.Errorf("expected 10 cpu ticks, got %d", process.CPUTicks)
+	}
+	if process.RSSBytes != 256*guestPageSize {
+		t.Errorf("expected rss of 256 pages, got %d bytes", process.RSSBytes)
+	}
+
+	if _, err := parseProcStat("not a stat line"); err == nil {
+		t.Error("expected an error for a malformed line")
+	}
+}
+
+func TestPodSysctls(t *testing.T) {
+	pod := &api.Pod{
+		ObjectMeta: api.ObjectMeta{
+			Annotations: map[string]string{
+				sysctlsAnnotation: "net.core.somaxconn=1024, kernel.shm_rmid_forced=1",
+			},
+		},
+	}
+	sysctls, err := podSysctls(pod)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if sysctls["net.core.somaxconn"] != "1024" || sysctls["kernel.shm_rmid_forced"] != "1" {
+		t.Errorf("unexpected sysctls: %v", sysctls)
+	}
+
+	pod.Annotations[sysctlsAnnotation] = "not-a-pair"
+	if _, err := podSysctls(pod); err == nil {
+		t.Error("expected an error for a malformed annotation")
+	}
+
+	if sysctls, err := podSysctls(&api.Pod{}); err != nil || sysctls != nil {
+		t.Errorf("expected no sysctls for an unannotated pod, got %v, %v", sysctls, err)
+	}
+}
+
+func TestNormalizePortProtocol(t *testing.T) {
+	for input, expected := range map[api.Protocol]string{
+		"":    "tcp",
+		"TCP": "tcp",
+		"udp": "udp",
+	} {
+		protocol, err := normalizePortProtocol(input)
+		if err != nil {
+			t.Errorf("unexpected error for %q: %v", input, err)
+		}
+		if protocol != expected {
+			t.Errorf("expected %q for %q, got %q", expected, input, protocol)
+		}
+	}
+
+	if _, err := normalizePortProtocol("SCTP"); err == nil {
+		t.Error("expected an error for an unsupported protocol")
+	}
+}
+
+func TestMatchesImagePattern(t *testing.T) {
+	for _, tc := range []struct {
+		pattern, image string
+		expected       bool
+	}{
+		{"docker.io", "docker.io/library/nginx:1.9", true},
+		{"docker.io", "gcr.io/project/nginx:1.9", false},
+		{"docker.io/library/nginx", "docker.io/library/nginx:1.9", true},
+		{"docker.io/*/*:latest", "docker.io/library/nginx:latest", true},
+		{"docker.io/*/*:latest", "docker.io/library/nginx:1.9", false},
+		{"gcr.io/project/*", "gcr.io/project/nginx:1.9", true},
+	} {
+		if got := matchesImagePattern(tc.pattern, tc.image); got != tc.expected {
+			t.Errorf("matchesImagePattern(%q, %q) = %v, expected %v", tc.pattern, tc.image, got, tc.expected)
+		}
+	}
+}
@@ -17,17 +17,25 @@ limitations under the License.
 package hyper
 
 import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/docker/docker/pkg/parsers"
 	"github.com/golang/glog"
+	"golang.org/x/net/context"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 	grpctypes "k8s.io/kubernetes/pkg/kubelet/hyper/types"
+	"k8s.io/kubernetes/pkg/util/flowcontrol"
 )
 
 const (
@@ -41,8 +49,12 @@ const (
 	KEY_CONTAINER_PORT = "containerPort"
 	KEY_CONTAINERS     = "containers"
 	KEY_DNS            = "dns"
+	KEY_CONTENT        = "content"
+	KEY_ENCODING       = "encoding"
 	KEY_ENTRYPOINT     = "entrypoint"
 	KEY_ENVS           = "envs"
+	KEY_FILENAME       = "filename"
+	KEY_FILES          = "files"
 	KEY_HOST_PORT      = "hostPort"
 	KEY_HOSTNAME       = "hostname"
 	KEY_ID             = "id"
@@ -54,12 +66,14 @@ const (
 	KEY_MEMORY         = "memory"
 	KEY_MOUNTPATH      = "path"
 	KEY_NAME           = "name"
+	KEY_PERM           = "perm"
 	KEY_POD_ID         = "podId"
 	KEY_POD_NAME       = "podName"
 	KEY_PORTS          = "ports"
 	KEY_PROTOCOL       = "protocol"
 	KEY_READONLY       = "readOnly"
 	KEY_RESOURCE       = "resource"
+	KEY_SYSCTL         = "sysctl"
 	KEY_TAG            = "tag"
 	KEY_TTY            = "tty"
 	KEY_TYPE           = "type"
@@ -76,7 +90,9 @@ const (
 	TYPE_CONTAINER = "container"
 	TYPE_POD       = "pod"
 
-	VOLUME_TYPE_VFS = "vfs"
+	VOLUME_TYPE_TMPFS = "tmpfs"
+	VOLUME_TYPE_VFS   = "vfs"
+	VOLUME_TYPE_RAW   = "raw"
 
 	//timeout in second for creating context with timeout.
 	hyperContextTimeout = 15 * time.Second
@@ -89,16 +105,119 @@ type HyperClient struct {
 	proto  string
 	addr   string
 	scheme string
+	server string
 	client grpctypes.PublicAPIClient
+
+	// Dialed endpoints and the index of the active one, see failover.go.
+	// Empty without a configured standby; server and client above always
+	// describe the active endpoint.
+	failoverLock sync.RWMutex
+	endpoints    []hyperEndpoint
+	active       int
+
+	// Cache of PodInfo responses for incremental ListPods syncs.
+	infoCache podInfoCache
+
+	// Fails calls fast while hyperd is down, see retry.go.
+	breaker circuitBreaker
+
+	// hyperd calls currently in flight, see introspect.go.
+	inflight inflightOps
+
+	// Client-side QPS cap, see ratelimit.go; nil means unthrottled.
+	limiter flowcontrol.RateLimiter
+}
+
+// podInfoCacheEntry remembers the PodInfo of a pod together with the list
+// metadata it was fetched under, so changed pods can be detected cheaply.
+type podInfoCacheEntry struct {
+	status    string
+	createdAt int64
+	fetchedAt time.Time
+	info      *grpctypes.PodInfo
+}
+
+// podInfoCache avoids one PodInfo round-trip per pod on every ListPods
+// call. Entries are reused only while the pod's list metadata is unchanged
+// and the entry is younger than podInfoCacheTTL, bounding staleness of
+// container-level state.
+type podInfoCache struct {
+	sync.Mutex
+	entries map[string]podInfoCacheEntry
+}
+
+// podInfoCacheTTL bounds how long a cached PodInfo may be served.
+const podInfoCacheTTL = 5 * time.Second
+
+func (pc *podInfoCache) get(pod *grpctypes.PodListResult) *grpctypes.PodInfo {
+	pc.Lock()
+	defer pc.Unlock()
+
+	entry, ok := pc.entries[pod.PodID]
+	if !ok || entry.status != pod.Status || entry.createdAt != pod.CreatedAt ||
+		time.Since(entry.fetchedAt) > podInfoCacheTTL {
+		return nil
+	}
+	return entry.info
 }
 
-func NewHyperClient() (*HyperClient, error) {
+func (pc *podInfoCache) put(pod *grpctypes.PodListResult, info *grpctypes.PodInfo) {
+	pc.Lock()
+	defer pc.Unlock()
+
+	if pc.entries == nil {
+		pc.entries = make(map[string]podInfoCacheEntry)
+	}
+	pc.entries[pod.PodID] = podInfoCacheEntry{
+		status:    pod.Status,
+		createdAt: pod.CreatedAt,
+		fetchedAt: time.Now(),
+		info:      info,
+	}
+}
+
+// prune drops cache entries for pods no longer in the list.
+func (pc *podInfoCache) prune(seen map[string]bool) {
+	pc.Lock()
+	defer pc.Unlock()
+
+	for podID := range pc.entries {
+		if !seen[podID] {
+			delete(pc.entries, podID)
+		}
+	}
+}
+
+// NewHyperClient connects to the hyperd gRPC API at the given address
+// (host:port or a unix:// socket path). An empty server selects the default
+// local endpoint.
+func NewHyperClient(server string) (*HyperClient, error) {
+	return NewHyperClientWithTLS(server, nil)
+}
+
+// NewHyperClientWithTLS connects to hyperd with mutual TLS, so a kubelet
+// can drive a hyperd in a different security domain. A nil tlsConfig falls
+// back to the insecure local connection.
+func NewHyperClientWithTLS(server string, tlsConfig *TLSConfig) (*HyperClient, error) {
 	var (
 		scheme = HYPER_SCHEME
 		proto  = HYPER_PROTO
 		addr   = HYPER_ADDR
 	)
-	conn, err := grpc.Dial(HYPER_SERVER, grpc.WithInsecure())
+	if server == "" {
+		server = HYPER_SERVER
+	}
+
+	dialOption := grpc.WithInsecure()
+	if tlsConfig != nil {
+		creds, err := newTransportCredentials(tlsConfig)
+		if err != nil {
+			return nil, err
+		}
+		dialOption = grpc.WithTransportCredentials(creds)
+	}
+
+	conn, err := grpc.Dial(server, dialOption)
 	if err != nil {
 		return nil, err
 	}
@@ -107,12 +226,38 @@ func NewHyperClient() (*HyperClient, error) {
 		proto:  proto,
 		addr:   addr,
 		scheme: scheme,
+		server: server,
 		client: grpctypes.NewPublicAPIClient(conn),
 	}, nil
 }
 
+// newTransportCredentials builds gRPC transport credentials from the client
+// certificate, key and CA bundle in the TLS configuration.
+func newTransportCredentials(tlsConfig *TLSConfig) (credentials.TransportAuthenticator, error) {
+	cert, err := tls.LoadX509KeyPair(tlsConfig.CertFile, tlsConfig.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load hyperd client certificate: %v", err)
+	}
+
+	caData, err := ioutil.ReadFile(tlsConfig.CAFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read hyperd CA file: %v", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(caData) {
+		return nil, fmt.Errorf("no certificates found in hyperd CA file %s", tlsConfig.CAFile)
+	}
+
+	return credentials.NewTLS(&tls.Config{
+		Certificates: []tls.Certificate{cert},
+		RootCAs:      pool,
+	}), nil
+}
+
 // parseImageName parses a docker image string into two parts: repo and tag.
-// If tag is empty, return the defaultImageTag.
+// For image references pinned by digest (e.g. "busybox@sha256:..."), the
+// digest is returned in place of the tag. If neither a tag nor a digest was
+// specified, return the defaultImageTag.
 func parseImageName(image string) (string, string) {
 	repoToPull, tag := parsers.ParseRepositoryTag(image)
 	// If no tag was specified, use the default "latest".
@@ -122,13 +267,24 @@ func parseImageName(image string) (string, string) {
 	return repoToPull, tag
 }
 
+// isImageDigest checks whether the tag part returned by parseImageName is
+// actually a sha256 digest.
+func isImageDigest(tag string) bool {
+	return strings.HasPrefix(tag, "sha256:")
+}
+
 func (c *HyperClient) Version() (string, error) {
 	request := grpctypes.VersionRequest{}
 
 	ctx, cancel := getContextWithTimeout(hyperContextTimeout)
 	defer cancel()
 
-	response, err := c.client.Version(ctx, &request)
+	var response *grpctypes.VersionResponse
+	err := c.withRetry("Version", func() error {
+		var err error
+		response, err = c.api().Version(ctx, &request)
+		return err
+	})
 	if err != nil {
 		return "", err
 	}
@@ -142,7 +298,12 @@ func (c *HyperClient) GetPodIDByName(podName string) (string, error) {
 	ctx, cancel := getContextWithTimeout(hyperContextTimeout)
 	defer cancel()
 
-	response, err := c.client.PodList(ctx, &request)
+	var response *grpctypes.PodListResponse
+	err := c.withRetry("PodList", func() error {
+		var err error
+		response, err = c.api().PodList(ctx, &request)
+		return err
+	})
 	if err != nil {
 		return "", err
 	}
@@ -153,22 +314,98 @@ func (c *HyperClient) GetPodIDByName(podName string) (string, error) {
 		}
 	}
 
-	return "", fmt.Errorf("Can not get PodID by name %s", podName)
+	return "", &hyperError{kind: ErrPodNotFound, cause: fmt.Errorf("Can not get PodID by name %s", podName)}
 }
 
+// ListPods returns all hyperd pods with their full PodInfo. Infos of pods
+// whose list metadata is unchanged are served from the incremental sync
+// cache instead of re-querying hyperd.
 func (c *HyperClient) ListPods() ([]HyperPod, error) {
+	return c.listPods(0, 0)
+}
+
+// ListPodsPaged returns a slice of the pod list starting at offset with at
+// most limit entries (limit 0 means all), so callers on dense nodes can
+// consume the list in chunks.
+func (c *HyperClient) ListPodsPaged(offset, limit int) ([]HyperPod, error) {
+	return c.listPods(offset, limit)
+}
+
+func (c *HyperClient) listPods(offset, limit int) ([]HyperPod, error) {
 	request := grpctypes.PodListRequest{}
 
 	ctx, cancel := getContextWithTimeout(hyperContextTimeout)
 	defer cancel()
 
-	response, err := c.client.PodList(ctx, &request)
+	var response *grpctypes.PodListResponse
+	err := c.withRetry("PodList", func() error {
+		var err error
+		response, err = c.api().PodList(ctx, &request)
+		return err
+	})
 	if err != nil {
 		return nil, err
 	}
 
-	var result []HyperPod
+	seen := make(map[string]bool, len(response.PodList))
 	for _, pod := range response.PodList {
+		seen[pod.PodID] = true
+	}
+	c.infoCache.prune(seen)
+
+	podList := response.PodList
+	if offset > 0 {
+		if offset >= len(podList) {
+			return nil, nil
+		}
+		podList = podList[offset:]
+	}
+	if limit > 0 && limit < len(podList) {
+		podList = podList[:limit]
+	}
+
+	return c.hydratePods(ctx, podList)
+}
+
+// ListPodsByNames returns the pods with the given full names, hydrating
+// PodInfo only for the matches. Callers interested in one pod should not pay
+// one PodInfo round-trip per pod on the node.
+func (c *HyperClient) ListPodsByNames(names []string) ([]HyperPod, error) {
+	wanted := make(map[string]bool, len(names))
+	for _, name := range names {
+		wanted[name] = true
+	}
+
+	request := grpctypes.PodListRequest{}
+
+	ctx, cancel := getContextWithTimeout(hyperContextTimeout)
+	defer cancel()
+
+	var response *grpctypes.PodListResponse
+	err := c.withRetry("PodList", func() error {
+		var err error
+		response, err = c.api().PodList(ctx, &request)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var matches []*grpctypes.PodListResult
+	for _, pod := range response.PodList {
+		if wanted[pod.PodName] {
+			matches = append(matches, pod)
+		}
+	}
+
+	return c.hydratePods(ctx, matches)
+}
+
+// hydratePods attaches the full PodInfo to each listed pod, served from the
+// incremental sync cache where the list metadata is unchanged.
+func (c *HyperClient) hydratePods(ctx context.Context, podList []*grpctypes.PodListResult) ([]HyperPod, error) {
+	var result []HyperPod
+	for _, pod := range podList {
 
 		var hyperPod HyperPod
 		hyperPod.PodID = pod.PodID
@@ -176,14 +413,25 @@ func (c *HyperClient) ListPods() ([]HyperPod, error) {
 		hyperPod.VmName = pod.VmID
 		hyperPod.Status = pod.Status
 
-		req := grpctypes.PodInfoRequest{PodID: pod.PodID}
+		info := c.infoCache.get(pod)
+		if info == nil {
+			req := grpctypes.PodInfoRequest{PodID: pod.PodID}
 
-		res, err := c.client.PodInfo(ctx, &req)
-		if err != nil {
-			return nil, err
+			var res *grpctypes.PodInfoResponse
+			err := c.withRetry("PodInfo", func() error {
+				var err error
+				res, err = c.api().PodInfo(ctx, &req)
+				return err
+			})
+			if err != nil {
+				return nil, err
+			}
+
+			info = res.PodInfo
+			c.infoCache.put(pod, info)
 		}
 
-		hyperPod.PodInfo = res.PodInfo
+		hyperPod.PodInfo = info
 
 		result = append(result, hyperPod)
 	}
@@ -197,7 +445,7 @@ func (c *HyperClient) ListContainers() ([]HyperContainer, error) {
 	ctx, cancel := getContextWithTimeout(hyperContextTimeout)
 	defer cancel()
 
-	response, err := c.client.ContainerList(ctx, &request)
+	response, err := c.api().ContainerList(ctx, &request)
 	if err != nil {
 		return nil, err
 	}
@@ -222,7 +470,7 @@ func (c *HyperClient) Info() (*grpctypes.InfoResponse, error) {
 	ctx, cancel := getContextWithTimeout(hyperContextTimeout)
 	defer cancel()
 
-	response, err := c.client.Info(ctx, &request)
+	response, err := c.api().Info(ctx, &request)
 	if err != nil {
 		return nil, err
 	}
@@ -238,7 +486,12 @@ func (c *HyperClient) ListImages() ([]HyperImage, error) {
 	ctx, cancel := getContextWithTimeout(hyperContextTimeout)
 	defer cancel()
 
-	response, err := c.client.ImageList(ctx, &request)
+	var response *grpctypes.ImageListResponse
+	err := c.withRetry("ImageList", func() error {
+		var err error
+		response, err = c.api().ImageList(ctx, &request)
+		return err
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -250,6 +503,7 @@ func (c *HyperClient) ListImages() ([]HyperImage, error) {
 		imageHyper.imageID = image.Id
 		imageHyper.createdAt = image.Created
 		imageHyper.virtualSize = image.VirtualSize
+		imageHyper.repoDigests = image.RepoDigests
 
 		hyperImages = append(hyperImages, imageHyper)
 	}
@@ -258,6 +512,11 @@ func (c *HyperClient) ListImages() ([]HyperImage, error) {
 }
 
 func (c *HyperClient) RemoveImage(imageID string) error {
+	c.throttle()
+
+	token := c.inflight.begin("RemoveImage")
+	defer c.inflight.end(token)
+
 	request := grpctypes.ImageRemoveRequest{
 		Image: imageID,
 	}
@@ -265,15 +524,20 @@ func (c *HyperClient) RemoveImage(imageID string) error {
 	ctx, cancel := getContextWithTimeout(hyperContextTimeout)
 	defer cancel()
 
-	_, err := c.client.ImageRemove(ctx, &request)
+	_, err := c.api().ImageRemove(ctx, &request)
 	if err != nil {
-		return err
+		return classifyError(err)
 	}
 
 	return nil
 }
 
 func (c *HyperClient) RemovePod(podID string) error {
+	c.throttle()
+
+	token := c.inflight.begin("RemovePod")
+	defer c.inflight.end(token)
+
 	request := grpctypes.PodRemoveRequest{
 		PodID: podID,
 	}
@@ -281,21 +545,58 @@ func (c *HyperClient) RemovePod(podID string) error {
 	ctx, cancel := getContextWithTimeout(hyperContextTimeout)
 	defer cancel()
 
-	_, err := c.client.PodRemove(ctx, &request)
+	_, err := c.api().PodRemove(ctx, &request)
 	if err != nil {
-		return err
+		return classifyError(err)
 	}
 
 	return nil
 }
 
+// maxConcurrentPodRemovals bounds the parallelism of a batch pod removal.
+const maxConcurrentPodRemovals = 4
+
+// RemovePods removes a batch of pods concurrently. Destroying a VM is slow
+// enough that a node drain pays seconds per pod when removals run one after
+// another. Already-gone pods count as removed; the first other failure is
+// returned after the whole batch was attempted.
+func (c *HyperClient) RemovePods(podIDs []string) error {
+	token := c.inflight.begin("RemovePods")
+	defer c.inflight.end(token)
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, maxConcurrentPodRemovals)
+	errs := make(chan error, len(podIDs))
+	for _, podID := range podIDs {
+		wg.Add(1)
+		go func(podID string) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			if err := c.RemovePod(podID); err != nil && !IsPodNotFound(err) {
+				errs <- fmt.Errorf("remove pod %s: %v", podID, err)
+			}
+		}(podID)
+	}
+	wg.Wait()
+	close(errs)
+
+	return <-errs
+}
+
 func (c *HyperClient) StartPod(podID string) error {
+	c.throttle()
+
+	token := c.inflight.begin("StartPod")
+	defer c.inflight.end(token)
+
 	ctx, cancel := getContextWithTimeout(hyperContextTimeout)
 	defer cancel()
 
-	stream, err := c.client.PodStart(ctx)
+	stream, err := c.api().PodStart(ctx)
 	if err != nil {
-		return err
+		return classifyError(err)
 	}
 
 	request := grpctypes.PodStartMessage{
@@ -303,18 +604,23 @@ func (c *HyperClient) StartPod(podID string) error {
 	}
 	err = stream.Send(&request)
 	if err != nil {
-		return err
+		return classifyError(err)
 	}
 
 	_, err = stream.Recv()
 	if err != nil {
-		return err
+		return classifyError(err)
 	}
 
 	return nil
 }
 
 func (c *HyperClient) StopPod(podID string) error {
+	c.throttle()
+
+	token := c.inflight.begin("StopPod")
+	defer c.inflight.end(token)
+
 	request := grpctypes.PodStopRequest{
 		PodID: podID,
 	}
@@ -322,7 +628,23 @@ func (c *HyperClient) StopPod(podID string) error {
 	ctx, cancel := getContextWithTimeout(hyperContextTimeout)
 	defer cancel()
 
-	_, err := c.client.PodStop(ctx, &request)
+	_, err := c.api().PodStop(ctx, &request)
+	if err != nil {
+		return classifyError(err)
+	}
+
+	return nil
+}
+
+func (c *HyperClient) StopContainer(containerID string) error {
+	request := grpctypes.ContainerStopRequest{
+		ContainerID: containerID,
+	}
+
+	ctx, cancel := getContextWithTimeout(hyperContextTimeout)
+	defer cancel()
+
+	_, err := c.api().ContainerStop(ctx, &request)
 	if err != nil {
 		return err
 	}
@@ -330,7 +652,105 @@ func (c *HyperClient) StopPod(podID string) error {
 	return nil
 }
 
+// CreateVM boots an empty VM with the base kernel and initrd, to be picked
+// up by a later pod create of matching size.
+func (c *HyperClient) CreateVM(cpu, memory int32) (string, error) {
+	request := grpctypes.VMCreateRequest{
+		Cpu:    cpu,
+		Memory: memory,
+	}
+
+	ctx, cancel := getContextWithTimeout(hyperContextTimeout)
+	defer cancel()
+
+	response, err := c.api().VMCreate(ctx, &request)
+	if err != nil {
+		return "", err
+	}
+
+	return response.VmID, nil
+}
+
+// RemoveVM destroys a standby VM.
+func (c *HyperClient) RemoveVM(vmID string) error {
+	request := grpctypes.VMRemoveRequest{
+		VmID: vmID,
+	}
+
+	ctx, cancel := getContextWithTimeout(hyperContextTimeout)
+	defer cancel()
+
+	_, err := c.api().VMRemove(ctx, &request)
+	return err
+}
+
+// ListVMs returns all VMs hyperd manages, standby ones included.
+func (c *HyperClient) ListVMs() ([]*grpctypes.VMListResult, error) {
+	request := grpctypes.VMListRequest{}
+
+	ctx, cancel := getContextWithTimeout(hyperContextTimeout)
+	defer cancel()
+
+	var response *grpctypes.VMListResponse
+	err := c.withRetry("VMList", func() error {
+		var err error
+		response, err = c.api().VMList(ctx, &request)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return response.VmList, nil
+}
+
+// GetPodStats returns the resource usage of a pod as reported by hyperd.
+func (c *HyperClient) GetPodStats(podID string) (*grpctypes.PodStats, error) {
+	request := grpctypes.PodStatsRequest{
+		PodID: podID,
+	}
+
+	ctx, cancel := getContextWithTimeout(hyperContextTimeout)
+	defer cancel()
+
+	var response *grpctypes.PodStatsResponse
+	err := c.withRetry("PodStats", func() error {
+		var err error
+		response, err = c.api().PodStats(ctx, &request)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return response.PodStats, nil
+}
+
+// CreateContainer adds a container to an existing pod. The container is not
+// started; a subsequent StartPod boots the containers that are not running.
+func (c *HyperClient) CreateContainer(podID string, spec *grpctypes.UserContainer) (string, error) {
+	request := grpctypes.ContainerCreateRequest{
+		PodID:         podID,
+		ContainerSpec: spec,
+	}
+
+	ctx, cancel := getContextWithTimeout(hyperContextTimeout)
+	defer cancel()
+
+	response, err := c.api().ContainerCreate(ctx, &request)
+	if err != nil {
+		return "", err
+	}
+
+	return response.ContainerID, nil
+}
+
 func (c *HyperClient) PullImage(image string, credential string) error {
+	c.throttle()
+
+	token := c.inflight.begin("PullImage")
+	defer c.inflight.end(token)
+
 	imageName, tag := parseImageName(image)
 	authConfig := &grpctypes.AuthConfig{}
 	if credential != "" {
@@ -351,9 +771,9 @@ func (c *HyperClient) PullImage(image string, credential string) error {
 		Tag:   tag,
 		Auth:  authConfig,
 	}
-	stream, err := c.client.ImagePull(ctx, &request)
+	stream, err := c.api().ImagePull(ctx, &request)
 	if err != nil {
-		return err
+		return classifyError(err)
 	}
 
 	errC := make(chan error)
@@ -381,7 +801,7 @@ func (c *HyperClient) PullImage(image string, credential string) error {
 		case <-ticker.C:
 			return fmt.Errorf("Cancel pulling image %q because of no progress for %v", image, defaultImagePullingStuckTimeout)
 		case err = <-errC:
-			return err
+			return classifyError(err)
 		case <-progressC:
 			ticker.Stop()
 			ticker = time.NewTicker(defaultImagePullingStuckTimeout)
@@ -393,6 +813,11 @@ func (c *HyperClient) PullImage(image string, credential string) error {
 }
 
 func (c *HyperClient) CreatePod(podSpec *grpctypes.UserPod) (string, error) {
+	c.throttle()
+
+	token := c.inflight.begin("CreatePod")
+	defer c.inflight.end(token)
+
 	request := grpctypes.PodCreateRequest{
 		PodSpec: podSpec,
 	}
@@ -400,9 +825,9 @@ func (c *HyperClient) CreatePod(podSpec *grpctypes.UserPod) (string, error) {
 	ctx, cancel := getContextWithTimeout(hyperContextTimeout)
 	defer cancel()
 
-	response, err := c.client.PodCreate(ctx, &request)
+	response, err := c.api().PodCreate(ctx, &request)
 	if err != nil {
-		return "", err
+		return "", classifyError(err)
 	}
 
 	return response.PodID, nil
@@ -416,7 +841,7 @@ func (c *HyperClient) Attach(opts AttachToContainerOptions) error {
 	ctx, cancel := getContextWithCancel()
 	defer cancel()
 
-	stream, err := c.client.Attach(ctx)
+	stream, err := c.api().Attach(ctx)
 	if err != nil {
 		return err
 	}
@@ -500,16 +925,19 @@ func (c *HyperClient) Exec(opts ExecInContainerOptions) error {
 	}
 
 	ctx, cancel := getContextWithCancel()
+	if opts.Timeout > 0 {
+		ctx, cancel = getContextWithTimeout(opts.Timeout)
+	}
 	defer cancel()
 
-	createResponse, err := c.client.ExecCreate(ctx, &createRequest)
+	createResponse, err := c.api().ExecCreate(ctx, &createRequest)
 	if err != nil {
 		return err
 	}
 
 	execId := createResponse.ExecID
 
-	stream, err := c.client.ExecStart(ctx)
+	stream, err := c.api().ExecStart(ctx)
 	if err != nil {
 		return err
 	}
@@ -576,6 +1004,9 @@ func (c *HyperClient) Exec(opts ExecInContainerOptions) error {
 	}
 
 	if err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			return fmt.Errorf("exec in container %s timed out after %v", opts.Container, opts.Timeout)
+		}
 		return err
 	}
 
@@ -583,6 +1014,82 @@ func (c *HyperClient) Exec(opts ExecInContainerOptions) error {
 	return nil
 }
 
+// ExecSync runs a command in a container without a terminal and returns its
+// stdout, stderr and exit code separately. Non-tty exec output from hyperd is
+// framed like docker's attach protocol; the first byte of each 8 byte frame
+// header selects the stream.
+func (c *HyperClient) ExecSync(container string, commands []string, timeout time.Duration) ([]byte, []byte, int32, error) {
+	if container == "" {
+		return nil, nil, 0, fmt.Errorf("No Such Container %s", container)
+	}
+
+	createRequest := grpctypes.ExecCreateRequest{
+		ContainerID: container,
+		Command:     commands,
+		Tty:         false,
+	}
+
+	ctx, cancel := getContextWithCancel()
+	if timeout > 0 {
+		ctx, cancel = getContextWithTimeout(timeout)
+	}
+	defer cancel()
+
+	createResponse, err := c.api().ExecCreate(ctx, &createRequest)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+
+	execId := createResponse.ExecID
+
+	stream, err := c.api().ExecStart(ctx)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+
+	startRequest := grpctypes.ExecStartRequest{
+		ContainerID: container,
+		ExecID:      execId,
+	}
+	if err = stream.Send(&startRequest); err != nil {
+		return nil, nil, 0, err
+	}
+
+	var stdout, stderr bytes.Buffer
+	for {
+		res, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			if ctx.Err() == context.DeadlineExceeded {
+				return stdout.Bytes(), stderr.Bytes(), 0, fmt.Errorf("exec in container %s timed out after %v", container, timeout)
+			}
+			return nil, nil, 0, err
+		}
+
+		data := res.Stdout
+		out := &stdout
+		if len(data) > 8 && (data[0] == 1 || data[0] == 2) {
+			if data[0] == 2 {
+				out = &stderr
+			}
+			data = data[8:]
+		}
+		out.Write(data)
+	}
+
+	waitResponse, err := c.api().Wait(ctx, &grpctypes.WaitRequest{
+		Container: container,
+		ProcessId: execId,
+	})
+	if err != nil {
+		return stdout.Bytes(), stderr.Bytes(), 0, err
+	}
+
+	return stdout.Bytes(), stderr.Bytes(), waitResponse.ExitCode, nil
+}
+
 func (c *HyperClient) ContainerLogs(opts ContainerLogsOptions) error {
 	request := grpctypes.ContainerLogsRequest{
 		Container:  opts.Container,
@@ -597,7 +1104,7 @@ func (c *HyperClient) ContainerLogs(opts ContainerLogsOptions) error {
 	ctx, cancel := getContextWithTimeout(hyperContextTimeout)
 	defer cancel()
 
-	stream, err := c.client.ContainerLogs(ctx, &request)
+	stream, err := c.api().ContainerLogs(ctx, &request)
 	if err != nil {
 		return err
 	}
@@ -632,6 +1139,16 @@ func (c *HyperClient) ContainerLogs(opts ContainerLogsOptions) error {
 func (client *HyperClient) IsImagePresent(repo, tag string) (bool, error) {
 	if outputs, err := client.ListImages(); err == nil {
 		for _, imgInfo := range outputs {
+			if isImageDigest(tag) {
+				// Images pinned by digest are matched on their repo digests
+				// rather than on tags.
+				for _, digest := range imgInfo.repoDigests {
+					if digest == fmt.Sprintf("%s@%s", repo, tag) {
+						return true, nil
+					}
+				}
+				continue
+			}
 			if imgInfo.repository == repo && imgInfo.tag == tag {
 				return true, nil
 			}
@@ -640,6 +1157,42 @@ func (client *HyperClient) IsImagePresent(repo, tag string) (bool, error) {
 	return false, nil
 }
 
+// IsImagesPresent answers the presence check for several images with a single
+// ImageList round-trip and maps each input image to whether it is already in
+// the local storage. Pod creation checks the image of every container, so
+// batching avoids one list round-trip per container.
+func (client *HyperClient) IsImagesPresent(images []string) (map[string]bool, error) {
+	present := make(map[string]bool, len(images))
+	if len(images) == 0 {
+		return present, nil
+	}
+
+	imageInfos, err := client.ListImages()
+	if err != nil {
+		return nil, err
+	}
+
+	tags := make(map[string]bool, len(imageInfos))
+	digests := make(map[string]bool)
+	for _, imgInfo := range imageInfos {
+		tags[fmt.Sprintf("%s:%s", imgInfo.repository, imgInfo.tag)] = true
+		for _, digest := range imgInfo.repoDigests {
+			digests[digest] = true
+		}
+	}
+
+	for _, image := range images {
+		repo, tag := parseImageName(image)
+		if isImageDigest(tag) {
+			present[image] = digests[fmt.Sprintf("%s@%s", repo, tag)]
+		} else {
+			present[image] = tags[fmt.Sprintf("%s:%s", repo, tag)]
+		}
+	}
+
+	return present, nil
+}
+
 func (c *HyperClient) ListServices(podId string) ([]*grpctypes.UserService, error) {
 	request := grpctypes.ServiceListRequest{
 		PodID: podId,
@@ -648,7 +1201,7 @@ func (c *HyperClient) ListServices(podId string) ([]*grpctypes.UserService, erro
 	ctx, cancel := getContextWithTimeout(hyperContextTimeout)
 	defer cancel()
 
-	response, err := c.client.ServiceList(ctx, &request)
+	response, err := c.api().ServiceList(ctx, &request)
 	if err != nil {
 		if strings.Contains(err.Error(), "doesn't have services discovery") {
 			return nil, nil
@@ -669,7 +1222,7 @@ func (c *HyperClient) UpdateServices(podId string, services []*grpctypes.UserSer
 	ctx, cancel := getContextWithTimeout(hyperContextTimeout)
 	defer cancel()
 
-	_, err := c.client.ServiceUpdate(ctx, &request)
+	_, err := c.api().ServiceUpdate(ctx, &request)
 	if err != nil {
 		return err
 	}
@@ -687,7 +1240,7 @@ func (c *HyperClient) UpdatePodLabels(podId string, labels map[string]string) er
 	ctx, cancel := getContextWithTimeout(hyperContextTimeout)
 	defer cancel()
 
-	_, err := c.client.SetPodLabels(ctx, &request)
+	_, err := c.api().SetPodLabels(ctx, &request)
 	if err != nil {
 		return err
 	}
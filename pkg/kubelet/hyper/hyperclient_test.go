@@ -0,0 +1,51 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyper
+
+import "testing"
+
+func TestParseImageName(t *testing.T) {
+	tests := []struct {
+		image        string
+		expectedRepo string
+		expectedTag  string
+	}{
+		{"busybox", "busybox", "latest"},
+		{"busybox:1.24", "busybox", "1.24"},
+		{"gcr.io/google_containers/pause:2.0", "gcr.io/google_containers/pause", "2.0"},
+		{"localhost:5000/nginx", "localhost:5000/nginx", "latest"},
+		{"busybox@sha256:4a731fb46adc5cefe3ae374a8b6020fc1b6ad667a279647766e9a3cd89f6fa92",
+			"busybox", "sha256:4a731fb46adc5cefe3ae374a8b6020fc1b6ad667a279647766e9a3cd89f6fa92"},
+	}
+
+	for _, test := range tests {
+		repo, tag := parseImageName(test.image)
+		if repo != test.expectedRepo || tag != test.expectedTag {
+			t.Errorf("parseImageName(%q) = (%q, %q), want (%q, %q)",
+				test.image, repo, tag, test.expectedRepo, test.expectedTag)
+		}
+	}
+}
+
+func TestIsImageDigest(t *testing.T) {
+	if !isImageDigest("sha256:4a731fb46adc5cefe3ae374a8b6020fc1b6ad667a279647766e9a3cd89f6fa92") {
+		t.Errorf("expected digest tag to be recognized")
+	}
+	if isImageDigest("latest") {
+		t.Errorf("expected plain tag not to be recognized as digest")
+	}
+}
@@ -0,0 +1,115 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyper
+
+import (
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/golang/glog"
+)
+
+// Hypervisor capability discovery. A node can run the kubelet and hyperd
+// and still be unable to boot a single VM — /dev/kvm missing, virtualization
+// disabled in firmware, or simply too little memory for the configured VM
+// size. The capabilities are probed once at startup: a node without KVM
+// fails the runtime health check so the scheduler stops placing hyper pods
+// on it, and the estimated VM count caps the pod limit.
+
+// hypervisorCapabilities is the probed virtualization state of the node.
+type hypervisorCapabilities struct {
+	// KVMAvailable is whether /dev/kvm exists; without it hyperd falls
+	// back to emulation or fails outright.
+	KVMAvailable bool `json:"kvmAvailable"`
+
+	// NestedVirt is whether the kvm module reports nested virtualization,
+	// relevant when the node is itself a VM.
+	NestedVirt bool `json:"nestedVirt"`
+
+	// MaxVMs estimates how many default-sized VMs fit into the node's
+	// memory; zero when the estimate is unavailable.
+	MaxVMs int `json:"maxVMs"`
+}
+
+// detectHypervisorCapabilities probes /dev/kvm, nested virtualization and
+// the node memory once at startup.
+func detectHypervisorCapabilities(defaultMemoryMB int) hypervisorCapabilities {
+	var caps hypervisorCapabilities
+
+	if _, err := os.Stat("/dev/kvm"); err == nil {
+		caps.KVMAvailable = true
+	}
+
+	for _, module := range []string{"kvm_intel", "kvm_amd"} {
+		data, err := ioutil.ReadFile("/sys/module/" + module + "/parameters/nested")
+		if err != nil {
+			continue
+		}
+		value := strings.TrimSpace(string(data))
+		if value == "1" || value == "Y" || value == "y" {
+			caps.NestedVirt = true
+		}
+		break
+	}
+
+	if defaultMemoryMB > 0 {
+		if totalMB := nodeMemoryMB(); totalMB > 0 {
+			caps.MaxVMs = totalMB / defaultMemoryMB
+		}
+	}
+
+	return caps
+}
+
+// nodeMemoryMB reads the node's total memory from /proc/meminfo; zero when
+// it cannot be determined.
+func nodeMemoryMB() int {
+	data, err := ioutil.ReadFile("/proc/meminfo")
+	if err != nil {
+		return 0
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if !strings.HasPrefix(line, "MemTotal:") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			return 0
+		}
+		kb, err := strconv.Atoi(fields[1])
+		if err != nil {
+			return 0
+		}
+		return kb / 1024
+	}
+	return 0
+}
+
+// effectiveMaxPods combines the configured pod cap with the VM count the
+// node's memory supports; zero still means no cap.
+func (r *runtime) effectiveMaxPods() int {
+	max := r.configManager.getConfig().MaxPods
+	if detected := r.hypervisorCaps.MaxVMs; detected > 0 && (max == 0 || detected < max) {
+		if max > 0 {
+			glog.V(4).Infof("Hyper: configured pod limit %d exceeds the %d VMs the node memory supports", max, detected)
+		}
+		max = detected
+	}
+	return max
+}
@@ -0,0 +1,114 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyper
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/golang/glog"
+
+	"k8s.io/kubernetes/pkg/api"
+)
+
+const (
+	// Per-pod image digest pins are checkpointed here, keyed by pod UID.
+	// A VM recreation (e.g. a liveness restart) boots the pinned digests,
+	// so a moved tag cannot change the bits under a running workload.
+	imagePinDir = "/var/lib/kubelet/hyper-image-pins"
+
+	// Annotation opting a pod out of digest pinning: restarts resolve
+	// image tags again and pick up whatever they point at now.
+	latestAtRestartAnnotation = "hyper.sh/latest-at-restart"
+)
+
+// pinFile returns the pin checkpoint path of a pod.
+func pinFile(uid string) string {
+	return path.Join(imagePinDir, uid+".json")
+}
+
+// latestAtRestart reports whether a pod opted out of digest pinning.
+func latestAtRestart(pod *api.Pod) bool {
+	return pod.Annotations[latestAtRestartAnnotation] == "true"
+}
+
+// saveImagePins records the digest each container image resolves to right
+// now. Called at initial pod creation, after the images were pulled.
+func (r *runtime) saveImagePins(pod *api.Pod) {
+	images, err := r.hyperClient.ListImages()
+	if err != nil {
+		glog.V(4).Infof("Hyper: cannot list images to pin pod %s: %v", pod.Name, err)
+		return
+	}
+
+	pins := make(map[string]string)
+	for _, container := range pod.Spec.Containers {
+		repo, tag := parseImageName(container.Image)
+		for _, image := range images {
+			if image.repository != repo || image.tag != tag {
+				continue
+			}
+			for _, digest := range image.repoDigests {
+				if digest != "" && !strings.Contains(digest, "<none>") {
+					pins[container.Name] = digest
+					break
+				}
+			}
+			break
+		}
+	}
+	if len(pins) == 0 {
+		return
+	}
+
+	if err := os.MkdirAll(imagePinDir, 0700); err != nil {
+		glog.V(4).Infof("Hyper: cannot create image pin directory: %v", err)
+		return
+	}
+	data, err := json.Marshal(pins)
+	if err != nil {
+		return
+	}
+	if err := ioutil.WriteFile(pinFile(string(pod.UID)), data, 0600); err != nil {
+		glog.V(4).Infof("Hyper: cannot write image pins of pod %s: %v", pod.Name, err)
+	}
+}
+
+// loadImagePins returns the pinned digest per container name of a pod, or
+// nil when the pod has no pins.
+func (r *runtime) loadImagePins(uid string) map[string]string {
+	data, err := ioutil.ReadFile(pinFile(uid))
+	if err != nil {
+		return nil
+	}
+
+	pins := make(map[string]string)
+	if err := json.Unmarshal(data, &pins); err != nil {
+		glog.Warningf("Hyper: corrupt image pins of pod %s: %v", uid, err)
+		return nil
+	}
+	return pins
+}
+
+// removeImagePins drops the pin checkpoint of a pod, for when the pod itself
+// is gone.
+func removeImagePins(uid string) {
+	os.Remove(pinFile(uid))
+}
@@ -0,0 +1,71 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyper
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// Node-level image policy. Admission controllers decide which images enter
+// the cluster, but they can be bypassed — mirrored static pods, disabled
+// plugins — and the node is the last line. The runtime evaluates every
+// image reference against an operator-configured denylist and allowlist
+// before starting the pod and again before pulling, so a docker.io:latest
+// ban holds even without admission control.
+
+// matchesImagePattern reports whether an image reference matches one policy
+// pattern. A pattern without a slash names a registry; otherwise it is
+// compared against the repository and the repository:tag form, literally or
+// as a path.Match pattern (e.g. "docker.io/*:latest").
+func matchesImagePattern(pattern, image string) bool {
+	repo, tag := parseImageName(image)
+	if !strings.Contains(pattern, "/") {
+		return pattern == imageRegistry(image)
+	}
+	for _, candidate := range []string{repo, repo + ":" + tag} {
+		if pattern == candidate {
+			return true
+		}
+		if ok, err := path.Match(pattern, candidate); err == nil && ok {
+			return true
+		}
+	}
+	return false
+}
+
+// checkImagePolicy rejects image references the node policy forbids. The
+// denylist wins over the allowlist; an empty allowlist allows everything
+// not denied, keeping nodes without a policy unaffected.
+func (r *runtime) checkImagePolicy(image string) error {
+	config := r.configManager.getConfig()
+	for _, pattern := range config.ImageDenylist {
+		if matchesImagePattern(pattern, image) {
+			return fmt.Errorf("image %s is denied by the node image policy (%q)", image, pattern)
+		}
+	}
+	if len(config.ImageAllowlist) == 0 {
+		return nil
+	}
+	for _, pattern := range config.ImageAllowlist {
+		if matchesImagePattern(pattern, image) {
+			return nil
+		}
+	}
+	return fmt.Errorf("image %s is not in the node image allowlist", image)
+}
@@ -0,0 +1,125 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyper
+
+import (
+	"sync"
+	"time"
+)
+
+// Client introspection for the debug server: which hyperd calls are in
+// flight right now, how the connection is doing and what the pod info cache
+// holds. A hung hyperd shows up here as old in-flight operations long before
+// it shows up in logs.
+
+// inflightOp is one hyperd call currently in flight.
+type inflightOp struct {
+	Operation string    `json:"operation"`
+	StartedAt time.Time `json:"startedAt"`
+}
+
+// inflightOps tracks the hyperd calls currently in flight. The zero value is
+// ready to use.
+type inflightOps struct {
+	sync.Mutex
+	seq int64
+	ops map[int64]inflightOp
+}
+
+// begin registers an operation and returns the token to end it with.
+func (t *inflightOps) begin(operation string) int64 {
+	t.Lock()
+	defer t.Unlock()
+
+	if t.ops == nil {
+		t.ops = make(map[int64]inflightOp)
+	}
+	t.seq++
+	t.ops[t.seq] = inflightOp{Operation: operation, StartedAt: time.Now()}
+	return t.seq
+}
+
+// end unregisters a completed operation.
+func (t *inflightOps) end(token int64) {
+	t.Lock()
+	defer t.Unlock()
+	delete(t.ops, token)
+}
+
+// snapshot returns the operations currently in flight.
+func (t *inflightOps) snapshot() []inflightOp {
+	t.Lock()
+	defer t.Unlock()
+
+	ops := make([]inflightOp, 0, len(t.ops))
+	for _, op := range t.ops {
+		ops = append(ops, op)
+	}
+	return ops
+}
+
+// cachedPodInfo describes one pod info cache entry without its content.
+type cachedPodInfo struct {
+	PodID     string    `json:"podID"`
+	Status    string    `json:"status"`
+	FetchedAt time.Time `json:"fetchedAt"`
+}
+
+// snapshot returns the cache contents as metadata.
+func (pc *podInfoCache) snapshot() []cachedPodInfo {
+	pc.Lock()
+	defer pc.Unlock()
+
+	cached := make([]cachedPodInfo, 0, len(pc.entries))
+	for podID, entry := range pc.entries {
+		cached = append(cached, cachedPodInfo{
+			PodID:     podID,
+			Status:    entry.status,
+			FetchedAt: entry.fetchedAt,
+		})
+	}
+	return cached
+}
+
+// clientDebugState is the introspection view of the hyperd client.
+type clientDebugState struct {
+	Endpoint            string          `json:"endpoint"`
+	ConsecutiveFailures int             `json:"consecutiveFailures"`
+	CircuitOpenUntil    time.Time       `json:"circuitOpenUntil,omitempty"`
+	InflightOps         []inflightOp    `json:"inflightOps"`
+	CachedPods          []cachedPodInfo `json:"cachedPods"`
+}
+
+// debugState assembles the introspection view of the client.
+func (c *HyperClient) debugState() clientDebugState {
+	c.breaker.Lock()
+	failures := c.breaker.failures
+	openUntil := c.breaker.openUntil
+	c.breaker.Unlock()
+
+	c.failoverLock.RLock()
+	endpoint := c.server
+	c.failoverLock.RUnlock()
+
+	return clientDebugState{
+		Endpoint:            endpoint,
+		ConsecutiveFailures: failures,
+		CircuitOpenUntil:    openUntil,
+		InflightOps:         c.inflight.snapshot(),
+		CachedPods:          c.infoCache.snapshot(),
+	}
+}
@@ -0,0 +1,74 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyper
+
+import (
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/golang/glog"
+)
+
+// iSCSI volumes reach the node as a block device once the host has logged in
+// to the target (the cinder baremetal attacher does the login). Handing that
+// device to hyperd directly attaches it to the pod VM as a virtual disk,
+// which keeps block storage off the vfs/9p shared-folder path and its
+// filesystem double-hop.
+
+// iscsiDevicePath renders the by-path device node of an attached iSCSI LUN,
+// matching the naming the iscsi volume plugin relies on. Incomplete metadata
+// returns the empty string.
+func iscsiDevicePath(metadata map[string]interface{}) string {
+	portal, _ := metadata["target_portal"].(string)
+	iqn, _ := metadata["target_iqn"].(string)
+
+	var lun string
+	switch value := metadata["target_lun"].(type) {
+	case string:
+		lun = value
+	case float64:
+		lun = strconv.Itoa(int(value))
+	case int:
+		lun = strconv.Itoa(value)
+	}
+
+	if portal == "" || iqn == "" || lun == "" {
+		return ""
+	}
+	return strings.Join([]string{"/dev/disk/by-path/ip", portal, "iscsi", iqn, "lun", lun}, "-")
+}
+
+// buildISCSIVolume fills in a hyperd volume attaching the LUN's block device
+// to the VM directly. It reports false — leaving the volume to the vfs
+// fallback — when the metadata is incomplete or the device is not present on
+// the host, e.g. because the target login failed.
+func (r *runtime) buildISCSIVolume(v map[string]interface{}, metadata map[string]interface{}) bool {
+	device := iscsiDevicePath(metadata)
+	if device == "" {
+		return false
+	}
+
+	if _, err := os.Stat(device); err != nil {
+		glog.Warningf("Hyper: iSCSI device %s of volume %v not present on host, falling back to vfs: %v", device, v[KEY_NAME], err)
+		return false
+	}
+
+	v[KEY_VOLUME_DRIVE] = VOLUME_TYPE_RAW
+	v[KEY_VOLUME_SOURCE] = device
+	return true
+}
@@ -0,0 +1,179 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyper
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path"
+	"time"
+
+	"github.com/golang/glog"
+
+	"k8s.io/kubernetes/pkg/api"
+	kubecontainer "k8s.io/kubernetes/pkg/kubelet/container"
+	"k8s.io/kubernetes/pkg/types"
+	"k8s.io/kubernetes/pkg/util/wait"
+)
+
+const (
+	// Label marking run-to-completion pods, so the reaper recognizes them
+	// across kubelet restarts.
+	runToCompletionLabel = "sh.hyper.run-to-completion"
+
+	// Final statuses of released pods are checkpointed here, keyed by pod
+	// UID, so the kubelet still observes an accurate terminal phase after
+	// the VM is gone.
+	finalStatusDir = "/var/lib/kubelet/hyper-final-status"
+
+	// How long a checkpointed final status is kept around.
+	finalStatusRetention = 24 * time.Hour
+
+	// How often succeeded run-to-completion pods are reaped.
+	jobReapInterval = 30 * time.Second
+)
+
+// isRunToCompletionPod reports whether a pod is a batch workload that runs to
+// completion rather than serving indefinitely.
+func isRunToCompletionPod(pod *api.Pod) bool {
+	return pod.Spec.RestartPolicy != api.RestartPolicyAlways
+}
+
+// startJobReaper releases the VMs of succeeded run-to-completion pods early.
+// Without it the VM sits idle until the API pod is deleted, which for batch
+// workloads can be long after completion.
+func (r *runtime) startJobReaper() {
+	go wait.Until(r.reapCompletedPods, jobReapInterval, wait.NeverStop)
+}
+
+// reapCompletedPods tears down succeeded run-to-completion pods after
+// archiving their logs and checkpointing their final status. Failed pods are
+// left alone: with RestartPolicy OnFailure the kubelet restarts them in place.
+func (r *runtime) reapCompletedPods() {
+	if err := r.checkReadOnly("reap completed pods"); err != nil {
+		return
+	}
+
+	podInfos, err := r.hyperClient.ListPods()
+	if err != nil {
+		glog.V(4).Infof("Hyper: job reaper: ListPods failed: %v", err)
+		return
+	}
+
+	for _, podInfo := range podInfos {
+		if podInfo.PodInfo.Spec.Labels[runToCompletionLabel] != "true" {
+			continue
+		}
+		if podInfo.Status != StatusSuccess {
+			continue
+		}
+
+		glog.V(2).Infof("Hyper: pod %s ran to completion, releasing its VM", podInfo.PodName)
+
+		// Serialize with syncs and deletes of the same pod.
+		r.podLocks.lock(podInfo.PodName)
+
+		r.archiveContainerLogs(podInfo)
+		if err := r.saveFinalStatus(podInfo); err != nil {
+			glog.Warningf("Hyper: cannot checkpoint final status of pod %s: %v, keeping its VM", podInfo.PodName, err)
+			r.podLocks.unlock(podInfo.PodName)
+			continue
+		}
+
+		if err := r.hyperClient.RemovePod(podInfo.PodID); err != nil {
+			glog.Warningf("Hyper: job reaper: remove pod %s failed: %v", podInfo.PodName, err)
+		}
+
+		r.podLocks.unlock(podInfo.PodName)
+	}
+
+	r.cleanupFinalStatuses()
+}
+
+// saveFinalStatus checkpoints the terminal status of a pod to disk before its
+// VM is removed.
+func (r *runtime) saveFinalStatus(podInfo HyperPod) error {
+	if err := os.MkdirAll(finalStatusDir, 0700); err != nil {
+		return err
+	}
+
+	podName, podNamespace, err := kubecontainer.ParsePodFullName(podInfo.PodName)
+	if err != nil {
+		return err
+	}
+	uid := podInfo.PodInfo.Spec.Labels[KEY_API_POD_UID]
+
+	status := &kubecontainer.PodStatus{
+		ID:        types.UID(uid),
+		Name:      podName,
+		Namespace: podNamespace,
+	}
+	if len(podInfo.PodInfo.Status.PodIP) > 0 {
+		status.IP = podInfo.PodInfo.Status.PodIP[0]
+	}
+
+	for _, containerInfo := range podInfo.PodInfo.Status.ContainerStatus {
+		for _, container := range podInfo.PodInfo.Spec.Containers {
+			if container.ContainerID == containerInfo.ContainerID {
+				c := r.getContainerStatus(containerInfo, container.Labels, container.Image, container.ImageID,
+					podInfo.PodInfo.CreatedAt, podInfo.PodInfo.Status.StartTime, podInfo.PodInfo.Status.FinishTime,
+					podInfo.Status, podInfo.PodInfo.Spec.Labels)
+				status.ContainerStatuses = append(status.ContainerStatuses, c)
+			}
+		}
+	}
+
+	data, err := json.Marshal(status)
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(path.Join(finalStatusDir, uid+".json"), data, 0600)
+}
+
+// loadFinalStatus returns the checkpointed final status of a pod whose VM was
+// already released, if one exists.
+func (r *runtime) loadFinalStatus(uid types.UID) (*kubecontainer.PodStatus, bool) {
+	data, err := ioutil.ReadFile(path.Join(finalStatusDir, string(uid)+".json"))
+	if err != nil {
+		return nil, false
+	}
+
+	status := &kubecontainer.PodStatus{}
+	if err := json.Unmarshal(data, status); err != nil {
+		glog.Warningf("Hyper: corrupt final status checkpoint of pod %s: %v", uid, err)
+		return nil, false
+	}
+
+	return status, true
+}
+
+// cleanupFinalStatuses drops final status checkpoints past their retention;
+// by then the API pod is long gone.
+func (r *runtime) cleanupFinalStatuses() {
+	files, err := ioutil.ReadDir(finalStatusDir)
+	if err != nil {
+		return
+	}
+
+	for _, file := range files {
+		if time.Since(file.ModTime()) > finalStatusRetention {
+			os.Remove(path.Join(finalStatusDir, file.Name()))
+		}
+	}
+}
@@ -0,0 +1,74 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyper
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"k8s.io/kubernetes/pkg/api"
+)
+
+// Per-pod kernel command-line arguments. Some guest tuning only works at
+// boot — transparent hugepage policy, alternative console devices — and
+// would otherwise require a custom kernel bundle per workload. Pods may
+// append allowlisted parameters to their VM's kernel cmdline instead. The
+// cmdline can disable security features wholesale, so like the guest image
+// selection the allowlist is an operator decision.
+
+const (
+	// Annotation listing extra kernel cmdline parameters, space-separated,
+	// e.g. "transparent_hugepage=never console=ttyS1".
+	kernelCmdlineAnnotation = "hyper.sh/kernel-cmdline"
+
+	// Runtime-internal label carrying the validated extra cmdline to
+	// hyperd.
+	kernelCmdlineLabel = "sh.hyper.kernel-cmdline"
+)
+
+// Shape of a single cmdline parameter; values may not contain whitespace or
+// quoting, which keeps the assembled cmdline unambiguous.
+var kernelParameterPattern = regexp.MustCompile(`^[a-zA-Z0-9_.-]+(=[a-zA-Z0-9_.,:/-]*)?$`)
+
+// podKernelCmdline parses and validates the kernel cmdline annotation of a
+// pod against the operator's parameter allowlist. Pods without the
+// annotation get ("", nil).
+func (r *runtime) podKernelCmdline(pod *api.Pod) (string, error) {
+	value, ok := pod.Annotations[kernelCmdlineAnnotation]
+	if !ok || strings.TrimSpace(value) == "" {
+		return "", nil
+	}
+
+	allowed := make(map[string]bool)
+	for _, name := range r.configManager.getConfig().AllowedKernelParameters {
+		allowed[name] = true
+	}
+
+	params := strings.Fields(value)
+	for _, param := range params {
+		if !kernelParameterPattern.MatchString(param) {
+			return "", fmt.Errorf("malformed kernel parameter %q in annotation %s", param, kernelCmdlineAnnotation)
+		}
+		name := strings.SplitN(param, "=", 2)[0]
+		if !allowed[name] {
+			return "", fmt.Errorf("kernel parameter %q is not in the configured allowlist", name)
+		}
+	}
+
+	return strings.Join(params, " "), nil
+}
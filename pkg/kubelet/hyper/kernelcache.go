@@ -0,0 +1,171 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyper
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"syscall"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"k8s.io/kubernetes/pkg/util/wait"
+)
+
+// Content-addressed cache of guest boot files. Operators drop kernel and
+// initrd variants into guestKernelDir; identical blobs — common when many
+// variants share one kernel — are deduplicated into hardlinks against a
+// store keyed by content hash. qcow2 layer sharing stays inside hyperd; this
+// covers the node-side boot files the kubelet owns.
+
+const (
+	// Content-addressed store of guest kernel and initrd blobs.
+	kernelCacheDir = "/var/lib/kubelet/hyper-kernel-cache"
+
+	// How often the boot file directory is re-scanned.
+	kernelCacheScanInterval = time.Hour
+)
+
+var kernelCacheSavedBytes = prometheus.NewGauge(prometheus.GaugeOpts{
+	Subsystem: "hyper",
+	Name:      "kernel_cache_saved_bytes",
+	Help:      "Disk bytes saved by deduplicating identical guest kernel and initrd files.",
+})
+
+func init() {
+	prometheus.MustRegister(kernelCacheSavedBytes)
+}
+
+// startKernelCache periodically deduplicates the guest boot file directory.
+func (r *runtime) startKernelCache() {
+	go wait.Until(r.dedupBootFiles, kernelCacheScanInterval, wait.NeverStop)
+}
+
+// dedupBootFiles hashes every file in the configured guest kernel directory
+// and replaces duplicates with hardlinks into the content-addressed store.
+// Replacement is atomic (link + rename), so hyperd can boot from the
+// directory at any time.
+func (r *runtime) dedupBootFiles() {
+	bootDir := r.configManager.getConfig().GuestKernelDir
+	if bootDir == "" {
+		return
+	}
+
+	files, err := ioutil.ReadDir(bootDir)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			glog.Warningf("Hyper: kernel cache: cannot read %s: %v", bootDir, err)
+		}
+		return
+	}
+	if err := os.MkdirAll(kernelCacheDir, 0700); err != nil {
+		glog.Warningf("Hyper: kernel cache: %v", err)
+		return
+	}
+
+	var savedBytes int64
+	for _, file := range files {
+		if !file.Mode().IsRegular() {
+			continue
+		}
+		filePath := path.Join(bootDir, file.Name())
+
+		digest, err := hashFile(filePath)
+		if err != nil {
+			glog.Warningf("Hyper: kernel cache: cannot hash %s: %v", filePath, err)
+			continue
+		}
+		cachePath := path.Join(kernelCacheDir, digest)
+
+		cacheInfo, err := os.Stat(cachePath)
+		if os.IsNotExist(err) {
+			// First file with this content seeds the store.
+			if err := os.Link(filePath, cachePath); err != nil {
+				glog.Warningf("Hyper: kernel cache: cannot link %s: %v", filePath, err)
+			}
+			continue
+		}
+		if err != nil {
+			continue
+		}
+
+		if os.SameFile(cacheInfo, file) {
+			// Already deduplicated in an earlier pass.
+			savedBytes += file.Size()
+			continue
+		}
+
+		tmpPath := filePath + ".dedup"
+		if err := os.Link(cachePath, tmpPath); err != nil {
+			glog.Warningf("Hyper: kernel cache: cannot link %s: %v", tmpPath, err)
+			continue
+		}
+		if err := os.Rename(tmpPath, filePath); err != nil {
+			os.Remove(tmpPath)
+			glog.Warningf("Hyper: kernel cache: cannot replace %s: %v", filePath, err)
+			continue
+		}
+		savedBytes += file.Size()
+		glog.V(2).Infof("Hyper: kernel cache: deduplicated %s (%s)", filePath, digest[:12])
+	}
+
+	kernelCacheSavedBytes.Set(float64(savedBytes))
+	r.pruneKernelCache(bootDir)
+}
+
+// pruneKernelCache drops store entries no boot file links to anymore.
+func (r *runtime) pruneKernelCache(bootDir string) {
+	entries, err := ioutil.ReadDir(kernelCacheDir)
+	if err != nil {
+		return
+	}
+	for _, entry := range entries {
+		if stat, ok := sysLinkCount(entry); ok && stat <= 1 {
+			os.Remove(path.Join(kernelCacheDir, entry.Name()))
+		}
+	}
+}
+
+// sysLinkCount returns the hardlink count of a file, when the platform
+// exposes it.
+func sysLinkCount(info os.FileInfo) (uint64, bool) {
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+		return uint64(stat.Nlink), true
+	}
+	return 0, false
+}
+
+// hashFile returns the hex sha256 of a file's content.
+func hashFile(filePath string) (string, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
@@ -103,6 +103,25 @@ func newLabels(container *api.Container, pod *api.Pod, restartCount int, enableC
 	return labels
 }
 
+// containerMetadataFromLabels reads the kubelet identity of a container back
+// from the labels written by newLabels. ok is false when the labels are
+// missing, i.e. the container was created by an older kubelet that only
+// encoded the metadata in the container name.
+func containerMetadataFromLabels(labels map[string]string) (name string, restartCount int, hash string, ok bool) {
+	name, found := labels[kubernetesContainerNameLabel]
+	if !found {
+		return "", 0, "", false
+	}
+
+	restartCount, err := strconv.Atoi(labels[kubernetesContainerRestartCountLabel])
+	if err != nil {
+		glog.Errorf("Unable to parse restart count label of container %q: %v", name, err)
+		return "", 0, "", false
+	}
+
+	return name, restartCount, labels[kubernetesContainerHashLabel], true
+}
+
 func logError(containerInfo *labelledContainerInfo, label string, err error) {
 	glog.Errorf("Unable to get %q for container %q of pod %q: %v", label, containerInfo.Name,
 		kubecontainer.BuildPodFullName(containerInfo.PodName, containerInfo.PodNamespace), err)
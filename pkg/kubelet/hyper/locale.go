@@ -0,0 +1,82 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyper
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/golang/glog"
+
+	"k8s.io/kubernetes/pkg/api"
+)
+
+// Time-zone and locale injection. Guest images default to UTC and the C
+// locale; legacy workloads expecting node-local time would need per-image
+// customization. Instead the node's own /etc/localtime and locale
+// configuration can be projected into the pod VM, the same way trust
+// bundles are.
+
+// Annotation turning node time-zone and locale propagation on ("true") or
+// off ("false") for one pod, overriding the propagateHostLocaltime
+// configuration default.
+const localtimeAnnotation = "hyper.sh/host-localtime"
+
+// Node files projected into the guest when propagation is on. Only the
+// ones present on the node are projected; locale configuration lives in
+// different files across distributions.
+var hostLocaleFiles = []string{"/etc/localtime", "/etc/locale.conf", "/etc/default/locale"}
+
+// guestLocaltimeFiles renders the node's time-zone and locale files as hyper
+// spec file entries, like guestTrustFiles does for CA bundles. It returns
+// (nil, nil) when propagation is off for the pod.
+func (r *runtime) guestLocaltimeFiles(pod *api.Pod) ([]map[string]interface{}, []map[string]interface{}) {
+	enabled := r.configManager.getConfig().PropagateHostLocaltime
+	if value, ok := pod.Annotations[localtimeAnnotation]; ok {
+		enabled = value == "true"
+	}
+	if !enabled {
+		return nil, nil
+	}
+
+	var podFiles, containerFiles []map[string]interface{}
+	for i, file := range hostLocaleFiles {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			if !os.IsNotExist(err) {
+				glog.Warningf("Hyper: cannot read %s for locale propagation: %v", file, err)
+			}
+			continue
+		}
+
+		name := fmt.Sprintf("host-locale-%d", i)
+		podFiles = append(podFiles, map[string]interface{}{
+			KEY_NAME:     name,
+			KEY_ENCODING: "base64",
+			KEY_CONTENT:  base64.StdEncoding.EncodeToString(data),
+		})
+		containerFiles = append(containerFiles, map[string]interface{}{
+			KEY_FILENAME:  name,
+			KEY_MOUNTPATH: file,
+			KEY_PERM:      "0644",
+		})
+	}
+
+	return podFiles, containerFiles
+}
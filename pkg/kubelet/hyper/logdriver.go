@@ -0,0 +1,270 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyper
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"time"
+
+	"github.com/golang/glog"
+
+	grpctypes "k8s.io/kubernetes/pkg/kubelet/hyper/types"
+	"k8s.io/kubernetes/pkg/util/wait"
+)
+
+const (
+	// Root of the node-side log files, laid out as
+	// /var/log/pods/<poduid>/<container>/0.log like the docker runtime, so
+	// fluentd/filebeat daemonsets pick up hyper pods without changes.
+	podLogsRootDir = "/var/log/pods"
+
+	// Rotation policy of one container log stream.
+	maxLogFileSize        = 10 * 1024 * 1024
+	maxLogFileGenerations = 5
+
+	// How often running containers are checked for a missing log pump.
+	logPumpSyncInterval = 30 * time.Second
+)
+
+// jsonLogEntry is one line of the docker JSON log format the cluster logging
+// agents understand.
+type jsonLogEntry struct {
+	Log    string `json:"log"`
+	Stream string `json:"stream"`
+	Time   string `json:"time"`
+}
+
+// jsonLogWriter appends JSON log lines to a file, rotating it by size.
+type jsonLogWriter struct {
+	logFile string
+	file    *os.File
+	size    int64
+
+	// Partial lines per stream, completed by the next chunk.
+	pending map[string]*bytes.Buffer
+}
+
+func newJSONLogWriter(logFile string) (*jsonLogWriter, error) {
+	file, err := os.OpenFile(logFile, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	size := int64(0)
+	if info, err := file.Stat(); err == nil {
+		size = info.Size()
+	}
+
+	return &jsonLogWriter{
+		logFile: logFile,
+		file:    file,
+		size:    size,
+		pending: make(map[string]*bytes.Buffer),
+	}, nil
+}
+
+// writeChunk splits a raw chunk of container output into lines and appends
+// them as JSON entries; an unterminated trailing line is buffered until its
+// remainder arrives.
+func (w *jsonLogWriter) writeChunk(stream string, data []byte) error {
+	buf := w.pending[stream]
+	if buf == nil {
+		buf = &bytes.Buffer{}
+		w.pending[stream] = buf
+	}
+	buf.Write(data)
+
+	for {
+		line, err := buf.ReadString('\n')
+		if err != nil {
+			// Put the partial line back and wait for more output.
+			buf.WriteString(line)
+			return nil
+		}
+		if err := w.writeEntry(stream, line); err != nil {
+			return err
+		}
+	}
+}
+
+func (w *jsonLogWriter) writeEntry(stream, line string) error {
+	entry, err := json.Marshal(jsonLogEntry{Log: line, Stream: stream, Time: time.Now().Format(time.RFC3339Nano)})
+	if err != nil {
+		return err
+	}
+	entry = append(entry, '\n')
+
+	if w.size+int64(len(entry)) > maxLogFileSize {
+		if err := w.rotate(); err != nil {
+			return err
+		}
+	}
+
+	n, err := w.file.Write(entry)
+	w.size += int64(n)
+	return err
+}
+
+// rotate shifts the log generations by one and starts a fresh file.
+func (w *jsonLogWriter) rotate() error {
+	w.file.Close()
+
+	oldest := fmt.Sprintf("%s.%d", w.logFile, maxLogFileGenerations-1)
+	os.Remove(oldest)
+	for i := maxLogFileGenerations - 1; i > 1; i-- {
+		os.Rename(fmt.Sprintf("%s.%d", w.logFile, i-1), fmt.Sprintf("%s.%d", w.logFile, i))
+	}
+	os.Rename(w.logFile, w.logFile+".1")
+
+	file, err := os.OpenFile(w.logFile, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	w.file = file
+	w.size = 0
+	return nil
+}
+
+func (w *jsonLogWriter) Close() {
+	w.file.Close()
+}
+
+// startLogDriver keeps one log pump per running container, copying its
+// stdout/stderr into node-side JSON log files.
+func (r *runtime) startLogDriver() {
+	go wait.Until(r.ensureLogPumps, logPumpSyncInterval, wait.NeverStop)
+}
+
+// ensureLogPumps starts pumps for running containers that do not have one,
+// covering both fresh pods and pods adopted after a kubelet restart.
+func (r *runtime) ensureLogPumps() {
+	podInfos, err := r.hyperClient.ListPods()
+	if err != nil {
+		glog.V(4).Infof("Hyper: log driver: ListPods failed: %v", err)
+		return
+	}
+
+	for _, podInfo := range podInfos {
+		if podInfo.Status != StatusRunning {
+			continue
+		}
+		podUID := podInfo.PodInfo.Spec.Labels[KEY_API_POD_UID]
+		if podUID == "" {
+			continue
+		}
+
+		for _, c := range podInfo.PodInfo.Status.ContainerStatus {
+			if c.Phase != StatusRunning {
+				continue
+			}
+			containerName, _, _, err := r.containerMetadata(c.Name, containerSpecLabels(podInfo.PodInfo.Spec, c.ContainerID))
+			if err != nil {
+				continue
+			}
+
+			containerID := c.ContainerID
+			r.pumpLock.Lock()
+			if r.activePumps == nil {
+				r.activePumps = make(map[string]bool)
+			}
+			if r.activePumps[containerID] {
+				r.pumpLock.Unlock()
+				continue
+			}
+			r.activePumps[containerID] = true
+			r.pumpLock.Unlock()
+
+			go func() {
+				defer func() {
+					r.pumpLock.Lock()
+					delete(r.activePumps, containerID)
+					r.pumpLock.Unlock()
+				}()
+				r.pumpContainerLogs(podUID, containerName, containerID)
+			}()
+		}
+	}
+}
+
+// pumpContainerLogs follows one container's log stream until it ends and
+// writes it to the node in the standard JSON format.
+func (r *runtime) pumpContainerLogs(podUID, containerName, containerID string) {
+	dir := path.Join(podLogsRootDir, podUID, containerName)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		glog.Warningf("Hyper: log driver: cannot create %s: %v", dir, err)
+		return
+	}
+
+	writer, err := newJSONLogWriter(path.Join(dir, "0.log"))
+	if err != nil {
+		glog.Warningf("Hyper: log driver: cannot open log file for container %s: %v", containerID, err)
+		return
+	}
+	defer writer.Close()
+
+	if err := r.hyperClient.followContainerLogs(containerID, writer); err != nil {
+		glog.V(4).Infof("Hyper: log driver: stream of container %s ended: %v", containerID, err)
+	}
+}
+
+// followContainerLogs streams a container's logs into the writer, keeping the
+// stdout/stderr distinction from the stream framing. hyperd frames every
+// chunk with an 8 byte header whose first byte is the stream type, like
+// docker's attach protocol.
+func (c *HyperClient) followContainerLogs(container string, writer *jsonLogWriter) error {
+	request := grpctypes.ContainerLogsRequest{
+		Container: container,
+		Follow:    true,
+		Stdout:    true,
+		Stderr:    true,
+		Tail:      "0",
+	}
+
+	ctx, cancel := getContextWithCancel()
+	defer cancel()
+
+	stream, err := c.api().ContainerLogs(ctx, &request)
+	if err != nil {
+		return err
+	}
+
+	for {
+		res, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if len(res.Log) <= 8 {
+			continue
+		}
+
+		streamName := "stdout"
+		if res.Log[0] == 2 {
+			streamName = "stderr"
+		}
+		if err := writer.writeChunk(streamName, res.Log[8:]); err != nil {
+			return err
+		}
+	}
+}
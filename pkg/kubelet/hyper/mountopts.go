@@ -0,0 +1,170 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyper
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"github.com/golang/glog"
+
+	"k8s.io/kubernetes/pkg/api"
+	kubecontainer "k8s.io/kubernetes/pkg/kubelet/container"
+)
+
+// Read-only enforcement for vfs shares. The readOnly flag of a volume mount
+// is honored by the guest kernel, but the 9p share underneath stays
+// writable: a compromised container that remounts inside the guest can still
+// write to the host directory. Volumes every container mounts read-only are
+// therefore re-shared from a host-side read-only bind mount, which makes
+// writes impossible at the hypervisor boundary no matter what the guest
+// does. The same bind mount carries operator-specified per-volume mount
+// options (nodev, noexec, nosuid).
+
+const (
+	// Annotation prefix selecting extra host-side mount options for one
+	// volume, e.g. sh.hyper.mount-options/data: "nodev,noexec".
+	volumeMountOptionsPrefix = "sh.hyper.mount-options/"
+
+	// Subdirectory of the spec dir holding the hardened bind mounts.
+	hardenedMountsDir = "mounts"
+)
+
+// volumeMountOptions returns the operator-specified mount options of a
+// volume, from the pod's annotations.
+func volumeMountOptions(pod *api.Pod, volume string) []string {
+	value := pod.Annotations[volumeMountOptionsPrefix+volume]
+	if value == "" {
+		return nil
+	}
+
+	var options []string
+	for _, option := range strings.Split(value, ",") {
+		if option = strings.TrimSpace(option); option != "" {
+			options = append(options, option)
+		}
+	}
+	return options
+}
+
+// volumeReadOnlyEverywhere reports whether the volume is mounted by at least
+// one container and read-only by all of them. Only then may the share itself
+// be made read-only without breaking a writer.
+func volumeReadOnlyEverywhere(pod *api.Pod, volume string) bool {
+	mounted := false
+	for _, container := range pod.Spec.Containers {
+		for _, mount := range container.VolumeMounts {
+			if mount.Name != volume {
+				continue
+			}
+			mounted = true
+			if !mount.ReadOnly {
+				return false
+			}
+		}
+	}
+	return mounted
+}
+
+// hardenedMountFlags converts mount options into host-enforceable mount
+// flags. Options the host cannot enforce are an error rather than silently
+// weaker than requested.
+func hardenedMountFlags(options []string) (uintptr, error) {
+	var flags uintptr
+	for _, option := range options {
+		switch option {
+		case "ro":
+			flags |= syscall.MS_RDONLY
+		case "nodev":
+			flags |= syscall.MS_NODEV
+		case "noexec":
+			flags |= syscall.MS_NOEXEC
+		case "nosuid":
+			flags |= syscall.MS_NOSUID
+		default:
+			return 0, fmt.Errorf("mount option %q cannot be enforced on the host", option)
+		}
+	}
+	return flags, nil
+}
+
+// hardenVFSSource re-shares a vfs volume source from a host-side bind mount
+// carrying the enforced flags, returning the new source. The empty string
+// means the volume needs no hardening or the bind mount failed; the caller
+// keeps the original source then, matching the historical behavior.
+func (r *runtime) hardenVFSSource(pod *api.Pod, volume, source string) string {
+	var flags uintptr
+	if volumeReadOnlyEverywhere(pod, volume) {
+		flags |= syscall.MS_RDONLY
+	}
+	if options := volumeMountOptions(pod, volume); len(options) > 0 {
+		optionFlags, err := hardenedMountFlags(options)
+		if err != nil {
+			glog.Warningf("Hyper: ignoring mount options of volume %s of pod %s: %v", volume, pod.Name, err)
+		} else {
+			flags |= optionFlags
+		}
+	}
+	if flags == 0 {
+		return ""
+	}
+
+	podFullName := kubecontainer.BuildPodFullName(pod.Name, pod.Namespace)
+	target := filepath.Join(r.specDir, hardenedMountsDir, podFullName, volume)
+	if err := os.MkdirAll(target, 0750); err != nil {
+		glog.Warningf("Hyper: cannot prepare hardened mount for volume %s of pod %s: %v", volume, podFullName, err)
+		return ""
+	}
+	if err := syscall.Mount(source, target, "", syscall.MS_BIND, ""); err != nil {
+		glog.Warningf("Hyper: bind mount of volume %s of pod %s failed: %v", volume, podFullName, err)
+		return ""
+	}
+	if err := syscall.Mount("", target, "", syscall.MS_BIND|syscall.MS_REMOUNT|flags, ""); err != nil {
+		glog.Warningf("Hyper: remount of volume %s of pod %s failed: %v", volume, podFullName, err)
+		syscall.Unmount(target, 0)
+		return ""
+	}
+	return target
+}
+
+// cleanupHardenedMounts unmounts and removes the hardened bind mounts of a
+// pod. Targets that are not mounted (e.g. after a reboot) are removed
+// silently.
+func (r *runtime) cleanupHardenedMounts(podFullName string) {
+	dir := filepath.Join(r.specDir, hardenedMountsDir, podFullName)
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			glog.Warningf("Hyper: cannot read hardened mounts of pod %s: %v", podFullName, err)
+		}
+		return
+	}
+
+	for _, entry := range entries {
+		target := filepath.Join(dir, entry.Name())
+		if err := syscall.Unmount(target, 0); err != nil && err != syscall.EINVAL {
+			glog.Warningf("Hyper: unmount of hardened mount %s failed: %v", target, err)
+		}
+	}
+	if err := os.RemoveAll(dir); err != nil {
+		glog.Warningf("Hyper: cannot remove hardened mounts of pod %s: %v", podFullName, err)
+	}
+}
@@ -0,0 +1,144 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyper
+
+import (
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/golang/glog"
+	"k8s.io/kubernetes/pkg/api"
+)
+
+const (
+	// Pods carrying the same value of this annotation are placed on the
+	// same host NUMA node, so latency-coupled service pairs share caches
+	// and memory locality.
+	numaGroupAnnotation = "hyper.sh/numa-group"
+
+	// Pods with this annotation set to "true" get a NUMA node that is not
+	// shared with any co-location group, when the host topology allows it.
+	numaIsolateAnnotation = "hyper.sh/numa-isolate"
+
+	// Label attached to the hyper pod naming the NUMA node its vCPUs and
+	// memory should be allocated from.
+	numaNodeLabel = "sh.hyper.numa-node"
+
+	sysfsNUMANodeGlob = "/sys/devices/system/node/node[0-9]*"
+)
+
+// numaAllocator assigns host NUMA nodes to co-location groups. Assignments
+// are sticky for the lifetime of the kubelet: all pods of a group land on
+// the group's node, isolated pods prefer nodes without any group.
+type numaAllocator struct {
+	sync.Mutex
+	nodes  []int
+	groups map[string]int
+	next   int
+}
+
+// newNUMAAllocator discovers the host NUMA topology from sysfs. On hosts
+// without NUMA information the allocator is inert and placement hints are
+// ignored.
+func newNUMAAllocator() *numaAllocator {
+	a := &numaAllocator{groups: make(map[string]int)}
+
+	paths, _ := filepath.Glob(sysfsNUMANodeGlob)
+	for _, p := range paths {
+		id, err := strconv.Atoi(strings.TrimPrefix(filepath.Base(p), "node"))
+		if err != nil {
+			continue
+		}
+		a.nodes = append(a.nodes, id)
+	}
+
+	if len(a.nodes) > 1 {
+		glog.V(2).Infof("Hyper: NUMA topology discovered, %d nodes", len(a.nodes))
+	}
+	return a
+}
+
+// nodeForGroup returns the NUMA node assigned to the given group,
+// allocating one round-robin on first use. The boolean is false when the
+// host has no usable topology.
+func (a *numaAllocator) nodeForGroup(group string) (int, bool) {
+	a.Lock()
+	defer a.Unlock()
+
+	if len(a.nodes) < 2 {
+		return 0, false
+	}
+
+	if node, ok := a.groups[group]; ok {
+		return node, true
+	}
+
+	node := a.nodes[a.next%len(a.nodes)]
+	a.next++
+	a.groups[group] = node
+	return node, true
+}
+
+// isolatedNode returns a NUMA node currently not assigned to any group, or
+// false if every node is taken or the host has no usable topology.
+func (a *numaAllocator) isolatedNode() (int, bool) {
+	a.Lock()
+	defer a.Unlock()
+
+	if len(a.nodes) < 2 {
+		return 0, false
+	}
+
+	used := make(map[int]bool, len(a.groups))
+	for _, node := range a.groups {
+		used[node] = true
+	}
+	for _, node := range a.nodes {
+		if !used[node] {
+			return node, true
+		}
+	}
+	return 0, false
+}
+
+// numaLabelsForPod translates the pod's co-location annotations into labels
+// for the hyper pod spec, so the hypervisor can pin the VM's vCPUs and
+// memory accordingly.
+func (a *numaAllocator) numaLabelsForPod(pod *api.Pod) map[string]string {
+	if pod.Annotations == nil {
+		return nil
+	}
+
+	if group := pod.Annotations[numaGroupAnnotation]; group != "" {
+		if node, ok := a.nodeForGroup(group); ok {
+			glog.V(4).Infof("Hyper: pod %s joins NUMA group %q on node %d", pod.Name, group, node)
+			return map[string]string{numaNodeLabel: strconv.Itoa(node)}
+		}
+	}
+
+	if pod.Annotations[numaIsolateAnnotation] == "true" {
+		if node, ok := a.isolatedNode(); ok {
+			glog.V(4).Infof("Hyper: pod %s isolated on NUMA node %d", pod.Name, node)
+			return map[string]string{numaNodeLabel: strconv.Itoa(node)}
+		}
+		glog.V(2).Infof("Hyper: no isolated NUMA node available for pod %s", pod.Name)
+	}
+
+	return nil
+}
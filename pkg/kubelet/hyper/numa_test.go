@@ -0,0 +1,60 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyper
+
+import "testing"
+
+func TestNUMAGroupAssignmentIsSticky(t *testing.T) {
+	a := &numaAllocator{nodes: []int{0, 1}, groups: make(map[string]int)}
+
+	first, ok := a.nodeForGroup("db-pair")
+	if !ok {
+		t.Fatalf("expected an assignment on a two-node host")
+	}
+	second, _ := a.nodeForGroup("db-pair")
+	if first != second {
+		t.Errorf("group assignment not sticky: %d vs %d", first, second)
+	}
+
+	other, _ := a.nodeForGroup("cache-pair")
+	if other == first {
+		t.Errorf("expected round-robin to pick a different node for a new group")
+	}
+}
+
+func TestNUMAIsolatedNode(t *testing.T) {
+	a := &numaAllocator{nodes: []int{0, 1}, groups: make(map[string]int)}
+
+	a.nodeForGroup("busy")
+	node, ok := a.isolatedNode()
+	if !ok {
+		t.Fatalf("expected a free node to remain")
+	}
+	if used := a.groups["busy"]; node == used {
+		t.Errorf("isolated node %d collides with group node %d", node, used)
+	}
+}
+
+func TestNUMADisabledOnSingleNodeHosts(t *testing.T) {
+	a := &numaAllocator{nodes: []int{0}, groups: make(map[string]int)}
+	if _, ok := a.nodeForGroup("any"); ok {
+		t.Errorf("expected no assignment on a single-node host")
+	}
+	if _, ok := a.isolatedNode(); ok {
+		t.Errorf("expected no isolated node on a single-node host")
+	}
+}
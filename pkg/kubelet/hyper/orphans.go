@@ -0,0 +1,107 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyper
+
+import (
+	"os"
+	"path"
+	"time"
+
+	"github.com/golang/glog"
+
+	"k8s.io/kubernetes/pkg/api"
+	apierrors "k8s.io/kubernetes/pkg/api/errors"
+	kubecontainer "k8s.io/kubernetes/pkg/kubelet/container"
+	kubetypes "k8s.io/kubernetes/pkg/kubelet/types"
+	"k8s.io/kubernetes/pkg/types"
+	"k8s.io/kubernetes/pkg/util/wait"
+)
+
+// How often hyperd pods are cross-checked against the API server.
+const orphanReconcileInterval = 5 * time.Minute
+
+// startOrphanReconciler periodically removes hyper pods whose API pod was
+// deleted while the node was down, so VMs do not keep running (and consuming
+// memory) for pods the cluster no longer knows about. The reconciler is inert
+// without an API server client.
+func (r *runtime) startOrphanReconciler() {
+	if r.kubeClient == nil {
+		return
+	}
+	go wait.Until(r.reconcileOrphanedPods, orphanReconcileInterval, wait.NeverStop)
+}
+
+// reconcileOrphanedPods lists the kubelet-managed hyperd pods and deletes the
+// ones that no longer have an API pod with the same UID.
+func (r *runtime) reconcileOrphanedPods() {
+	if err := r.checkReadOnly("reconcile orphaned pods"); err != nil {
+		return
+	}
+
+	podInfos, err := r.hyperClient.ListPods()
+	if err != nil {
+		glog.Warningf("Hyper: orphan reconciler: ListPods failed: %v", err)
+		return
+	}
+
+	for _, podInfo := range podInfos {
+		podName, podNamespace, err := kubecontainer.ParsePodFullName(podInfo.PodName)
+		if err != nil {
+			// Not a kubelet-managed pod.
+			continue
+		}
+
+		uid := podInfo.PodInfo.Spec.Labels[KEY_API_POD_UID]
+		apiPod, err := r.kubeClient.Core().Pods(podNamespace).Get(podName)
+		if err != nil {
+			if !apierrors.IsNotFound(err) {
+				// Do not delete anything on API server flakes.
+				glog.V(4).Infof("Hyper: orphan reconciler: cannot get pod %s: %v", podInfo.PodName, err)
+				continue
+			}
+		} else if uid == "" || string(apiPod.UID) == uid {
+			// The pod (or a pod we cannot tell apart) still exists.
+			continue
+		} else if _, isMirror := apiPod.Annotations[kubetypes.ConfigMirrorAnnotationKey]; isMirror {
+			// Static pods never share the UID of their mirror pod; they are
+			// owned by the node, not the API server.
+			continue
+		}
+
+		glog.V(2).Infof("Hyper: removing orphaned pod %s (ID:%s, UID:%s)", podInfo.PodName, podInfo.PodID, uid)
+		orphan := &api.Pod{ObjectMeta: api.ObjectMeta{Name: podName, Namespace: podNamespace, UID: types.UID(uid)}}
+
+		if err := r.hyperClient.RemovePod(podInfo.PodID); err != nil {
+			glog.Warningf("Hyper: orphan reconciler: remove pod %s failed: %v", podInfo.PodID, err)
+			continue
+		}
+
+		if err := r.networkPlugin.TearDownPod(podNamespace, podName, kubecontainer.ContainerID{}, "hyper"); err != nil {
+			glog.Warningf("Hyper: orphan reconciler: networkPlugin.TearDownPod failed: %v", err)
+		}
+
+		specFileName := path.Join(r.specDir, podInfo.PodName)
+		if _, err := os.Stat(specFileName); err == nil {
+			if err := os.Remove(specFileName); err != nil {
+				glog.Warningf("Hyper: orphan reconciler: delete spec file for %s failed: %v", podInfo.PodName, err)
+			}
+		}
+
+		r.recorder.Eventf(orphan, api.EventTypeNormal, "RemovedOrphanPod",
+			"Removed hyper pod %s (ID:%s) that no longer exists in the API server", podInfo.PodName, podInfo.PodID)
+	}
+}
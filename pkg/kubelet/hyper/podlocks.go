@@ -0,0 +1,69 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyper
+
+import "sync"
+
+// podLockSet serializes the mutating runtime operations per pod. The kubelet
+// pod workers already serialize syncs of one pod, but deletes, the garbage
+// collector and the background reconcilers run on their own goroutines; a
+// sync racing a delete must not double-create a VM or tear down a network
+// half-way. Locks are reference-counted so the map does not grow with every
+// pod the node ever ran.
+type podLockSet struct {
+	sync.Mutex
+	locks map[string]*podLock
+}
+
+type podLock struct {
+	sync.Mutex
+	refs int
+}
+
+// lock acquires the mutex of a pod, creating it on first use.
+func (s *podLockSet) lock(podFullName string) {
+	s.Lock()
+	if s.locks == nil {
+		s.locks = make(map[string]*podLock)
+	}
+	l, ok := s.locks[podFullName]
+	if !ok {
+		l = &podLock{}
+		s.locks[podFullName] = l
+	}
+	l.refs++
+	s.Unlock()
+
+	l.Lock()
+}
+
+// unlock releases the mutex of a pod, dropping it once nobody waits.
+func (s *podLockSet) unlock(podFullName string) {
+	s.Lock()
+	l, ok := s.locks[podFullName]
+	if !ok {
+		s.Unlock()
+		return
+	}
+	l.refs--
+	if l.refs == 0 {
+		delete(s.locks, podFullName)
+	}
+	s.Unlock()
+
+	l.Unlock()
+}
@@ -0,0 +1,74 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyper
+
+import (
+	"github.com/golang/glog"
+
+	kubecontainer "k8s.io/kubernetes/pkg/kubelet/container"
+)
+
+// Number of hinted images pulled concurrently. Pre-seeding is opportunistic
+// and must not starve pulls of pods already scheduled here.
+const maxConcurrentPrefetches = 2
+
+// prefetchImages starts background pulls for images hinted to be needed soon,
+// e.g. by a scheduler extender that already placed a pending pod on this
+// node. Images already present or already being prefetched are skipped.
+// Hints carry no pull secrets, so only images pullable anonymously (or via
+// the node-level registry configuration) benefit.
+func (r *runtime) prefetchImages(images []string) {
+	present, err := r.hyperClient.IsImagesPresent(images)
+	if err != nil {
+		glog.V(4).Infof("Hyper: prefetch: cannot check image presence: %v", err)
+		present = map[string]bool{}
+	}
+
+	for _, image := range images {
+		if present[image] {
+			continue
+		}
+
+		r.prefetchLock.Lock()
+		if r.prefetching == nil {
+			r.prefetching = make(map[string]bool)
+			r.prefetchSem = make(chan struct{}, maxConcurrentPrefetches)
+		}
+		if r.prefetching[image] {
+			r.prefetchLock.Unlock()
+			continue
+		}
+		r.prefetching[image] = true
+		r.prefetchLock.Unlock()
+
+		go func(image string) {
+			defer func() {
+				r.prefetchLock.Lock()
+				delete(r.prefetching, image)
+				r.prefetchLock.Unlock()
+			}()
+
+			r.prefetchSem <- struct{}{}
+			defer func() { <-r.prefetchSem }()
+
+			glog.V(2).Infof("Hyper: prefetching image %s", image)
+			if err := r.PullImage(kubecontainer.ImageSpec{Image: image}, nil); err != nil {
+				glog.V(2).Infof("Hyper: prefetch of image %s failed: %v", image, err)
+			}
+		}(image)
+	}
+}
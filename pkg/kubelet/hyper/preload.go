@@ -0,0 +1,71 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyper
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/golang/glog"
+)
+
+// loadedMarkerSuffix marks tarballs that were already imported, so restarts
+// do not re-load them.
+const loadedMarkerSuffix = ".loaded"
+
+// preloadImages imports all image tarballs found in dir into hyperd via
+// `hyper load`, so nodes without registry access can be seeded at bootstrap.
+// Each successfully imported tarball gets a marker file next to it and is
+// skipped on subsequent kubelet starts.
+func (r *runtime) preloadImages(dir string) {
+	if dir == "" {
+		return
+	}
+	if !r.cliRunner.available() {
+		glog.Warningf("Hyper: image preloading from %s is configured but the hyper CLI is not installed, skipping", dir)
+		return
+	}
+
+	var tarballs []string
+	for _, pattern := range []string{"*.tar", "*.tar.gz", "*.tgz"} {
+		matches, _ := filepath.Glob(filepath.Join(dir, pattern))
+		tarballs = append(tarballs, matches...)
+	}
+
+	for _, tarball := range tarballs {
+		marker := tarball + loadedMarkerSuffix
+		if _, err := os.Stat(marker); err == nil {
+			glog.V(5).Infof("Hyper: image tarball %s already loaded, skipping", tarball)
+			continue
+		}
+
+		glog.V(2).Infof("Hyper: preloading image tarball %s", tarball)
+		output, err := r.cliRunner.Run("load", "-i", tarball)
+		if err != nil {
+			glog.Warningf("Hyper: failed to load image tarball %s: %v, output: %s",
+				tarball, err, strings.TrimSpace(string(output)))
+			continue
+		}
+
+		if f, err := os.Create(marker); err != nil {
+			glog.Warningf("Hyper: failed to mark tarball %s as loaded: %v", tarball, err)
+		} else {
+			f.Close()
+		}
+	}
+}
@@ -0,0 +1,128 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyper
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/golang/glog"
+
+	"k8s.io/kubernetes/pkg/api"
+	kubecontainer "k8s.io/kubernetes/pkg/kubelet/container"
+)
+
+// Pre-start hooks. Between image pull and StartPod there is a natural veto
+// point: the images are local and resolvable to digests, the hyperd spec is
+// rendered, and nothing has booted yet. External hooks — vulnerability
+// scanners, license checkers — run there as operator-configured commands
+// receiving the pod identity, image digests and generated spec as JSON on
+// stdin; a nonzero exit vetoes the pod start. Like the signature verifier,
+// the integration stays a deployment choice rather than a runtime
+// dependency.
+
+// A hook that hangs must not wedge pod startup forever; scanners get this
+// long per invocation.
+const preStartHookTimeout = 2 * time.Minute
+
+// preStartHookInput is the JSON document each hook receives on stdin.
+type preStartHookInput struct {
+	Pod       string              `json:"pod"`
+	Namespace string              `json:"namespace"`
+	UID       string              `json:"uid"`
+	Images    []preStartHookImage `json:"images"`
+	Spec      json.RawMessage     `json:"spec"`
+}
+
+// preStartHookImage pairs one container image reference with its local repo
+// digests, when hyperd knows them.
+type preStartHookImage struct {
+	Image   string   `json:"image"`
+	Digests []string `json:"digests,omitempty"`
+}
+
+// runPreStartHooks invokes the configured hooks in order; the first veto
+// fails the pod start. Nodes without hooks are unaffected.
+func (r *runtime) runPreStartHooks(pod *api.Pod, specData []byte) error {
+	hooks := r.configManager.getConfig().PreStartHooks
+	if len(hooks) == 0 {
+		return nil
+	}
+
+	input := preStartHookInput{
+		Pod:       kubecontainer.GetPodFullName(pod),
+		Namespace: pod.Namespace,
+		UID:       string(pod.UID),
+		Images:    r.podImageDigests(pod),
+		Spec:      json.RawMessage(specData),
+	}
+	data, err := json.Marshal(&input)
+	if err != nil {
+		return err
+	}
+
+	for _, hook := range hooks {
+		cmd := exec.Command(hook, input.Pod)
+		cmd.Stdin = bytes.NewReader(data)
+		timer := time.AfterFunc(preStartHookTimeout, func() {
+			if cmd.Process != nil {
+				cmd.Process.Kill()
+			}
+		})
+		output, err := cmd.CombinedOutput()
+		timer.Stop()
+		if err != nil {
+			reason := strings.TrimSpace(string(output))
+			if reason == "" {
+				reason = err.Error()
+			}
+			return fmt.Errorf("pre-start hook %s vetoed the pod: %s", path.Base(hook), reason)
+		}
+		glog.V(4).Infof("Hyper: pre-start hook %s passed pod %s", path.Base(hook), input.Pod)
+	}
+
+	return nil
+}
+
+// podImageDigests resolves the pod's container images to their local repo
+// digests, best effort: a failed image list only costs the hooks the
+// digests, not the pod start.
+func (r *runtime) podImageDigests(pod *api.Pod) []preStartHookImage {
+	digestsByImage := make(map[string][]string)
+	if images, err := r.hyperClient.ListImages(); err == nil {
+		for _, image := range images {
+			digestsByImage[image.repository+":"+image.tag] = image.repoDigests
+		}
+	} else {
+		glog.V(4).Infof("Hyper: cannot list images for pre-start hooks: %v", err)
+	}
+
+	var result []preStartHookImage
+	for _, container := range pod.Spec.Containers {
+		repo, tag := parseImageName(container.Image)
+		result = append(result, preStartHookImage{
+			Image:   container.Image,
+			Digests: digestsByImage[repo+":"+tag],
+		})
+	}
+	return result
+}
@@ -0,0 +1,161 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyper
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"time"
+
+	"github.com/golang/glog"
+
+	"k8s.io/kubernetes/pkg/api"
+	kubecontainer "k8s.io/kubernetes/pkg/kubelet/container"
+)
+
+const (
+	// Terminated container logs are persisted here before their VM is
+	// removed, so `kubectl logs --previous` keeps working although hyperd
+	// does not retain dead containers.
+	previousLogsDir = "/var/lib/kubelet/hyper-prev-logs"
+
+	// Number of previous instances kept per container.
+	previousLogGenerations = 2
+
+	// How long archived previous logs survive once their container record
+	// has been deleted or garbage collected.
+	previousLogRetention = 7 * 24 * time.Hour
+)
+
+// previousLogFile returns the archive path of the newest previous instance of
+// a container.
+func previousLogFile(podFullName, containerName string) string {
+	return path.Join(previousLogsDir, fmt.Sprintf("%s_%s.log", podFullName, containerName))
+}
+
+// rotatePreviousLog shifts the archived generations of one container by one,
+// dropping the oldest.
+func rotatePreviousLog(logFile string) {
+	oldest := fmt.Sprintf("%s.%d", logFile, previousLogGenerations-1)
+	os.Remove(oldest)
+	for i := previousLogGenerations - 1; i > 1; i-- {
+		os.Rename(fmt.Sprintf("%s.%d", logFile, i-1), fmt.Sprintf("%s.%d", logFile, i))
+	}
+	os.Rename(logFile, logFile+".1")
+}
+
+// archiveOneContainerLog saves the logs of a single container to the node,
+// rotating older generations.
+func (r *runtime) archiveOneContainerLog(podFullName, containerName, containerID string) error {
+	if err := os.MkdirAll(previousLogsDir, 0700); err != nil {
+		return fmt.Errorf("cannot create previous logs directory %s: %v", previousLogsDir, err)
+	}
+
+	logFile := previousLogFile(podFullName, containerName)
+	rotatePreviousLog(logFile)
+
+	f, err := os.OpenFile(logFile, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return fmt.Errorf("cannot create previous log file %s: %v", logFile, err)
+	}
+
+	err = r.hyperClient.ContainerLogs(ContainerLogsOptions{
+		Container:    containerID,
+		OutputStream: f,
+		Timestamps:   true,
+	})
+	f.Close()
+	if err != nil {
+		os.Remove(logFile)
+		return fmt.Errorf("archiving logs of container %s of pod %s failed: %v", containerName, podFullName, err)
+	}
+	return nil
+}
+
+// archiveContainerLogs saves the logs of all containers of a pod to the node,
+// rotating older generations. It must run before the pod's VM is removed;
+// afterwards the logs are gone.
+func (r *runtime) archiveContainerLogs(podInfo HyperPod) {
+	for _, c := range podInfo.PodInfo.Status.ContainerStatus {
+		containerName, _, _, err := r.containerMetadata(c.Name, containerSpecLabels(podInfo.PodInfo.Spec, c.ContainerID))
+		if err != nil {
+			continue
+		}
+
+		if err := r.archiveOneContainerLog(podInfo.PodName, containerName, c.ContainerID); err != nil {
+			glog.Warningf("Hyper: %v", err)
+		}
+	}
+}
+
+// prunePreviousLogs drops archived previous logs older than the retention, so
+// deleted container records do not accumulate logs on the node forever.
+func (r *runtime) prunePreviousLogs() {
+	files, err := ioutil.ReadDir(previousLogsDir)
+	if err != nil {
+		return
+	}
+
+	cutoff := time.Now().Add(-previousLogRetention)
+	for _, file := range files {
+		if file.Mode().IsRegular() && file.ModTime().Before(cutoff) {
+			os.Remove(path.Join(previousLogsDir, file.Name()))
+		}
+	}
+}
+
+// copyPreviousLogs serves the archived logs of the container's previous
+// instance.
+func (r *runtime) copyPreviousLogs(pod *api.Pod, containerID kubecontainer.ContainerID, stdout io.Writer) error {
+	podFullName := kubecontainer.BuildPodFullName(pod.Name, pod.Namespace)
+
+	// Resolve the container name: preferably from the running pod, for
+	// single-container pods trivially from the spec.
+	var containerName string
+	if podInfos, err := r.hyperClient.ListPods(); err == nil {
+	resolve:
+		for _, podInfo := range podInfos {
+			for _, c := range podInfo.PodInfo.Spec.Containers {
+				if c.ContainerID == containerID.ID {
+					containerName, _, _, _ = r.containerMetadata(c.Name, c.Labels)
+					break resolve
+				}
+			}
+		}
+	}
+	if containerName == "" && len(pod.Spec.Containers) == 1 {
+		containerName = pod.Spec.Containers[0].Name
+	}
+	if containerName == "" {
+		return fmt.Errorf("cannot resolve container %s of pod %s for previous logs", containerID.ID, podFullName)
+	}
+
+	f, err := os.Open(previousLogFile(podFullName, containerName))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("no previous logs for container %s of pod %s", containerName, podFullName)
+		}
+		return err
+	}
+	defer f.Close()
+
+	_, err = io.Copy(stdout, f)
+	return err
+}
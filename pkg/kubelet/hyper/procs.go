@@ -0,0 +1,107 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyper
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Guest page size assumed when converting the rss field of /proc/<pid>/stat
+// to bytes. The hyper guest kernel is x86_64 with 4K pages.
+const guestPageSize = 4096
+
+// containerProcess is one entry of a container's process table.
+type containerProcess struct {
+	Pid      int    `json:"pid"`
+	Command  string `json:"command"`
+	CPUTicks uint64 `json:"cpuTicks"`
+	RSSBytes int64  `json:"rssBytes"`
+}
+
+// listProcesses returns the process table of a container. It reads the
+// guest's /proc through the agent's built-in shell rather than exec'ing ps,
+// so it works in images that do not ship procps.
+func (r *runtime) listProcesses(containerID string) ([]containerProcess, error) {
+	stdout, _, exitCode, err := r.hyperClient.ExecSync(containerID,
+		[]string{"sh", "-c", "cat /proc/[0-9]*/stat"}, defaultProbeExecTimeout)
+	if err != nil {
+		return nil, err
+	}
+	if exitCode != 0 {
+		return nil, fmt.Errorf("reading process table of container %s failed with exit code %d", containerID, exitCode)
+	}
+
+	var processes []containerProcess
+	for _, line := range strings.Split(string(stdout), "\n") {
+		if line == "" {
+			continue
+		}
+		process, err := parseProcStat(line)
+		if err != nil {
+			continue
+		}
+		processes = append(processes, process)
+	}
+
+	return processes, nil
+}
+
+// parseProcStat extracts pid, command, accumulated CPU time and resident set
+// size from one /proc/<pid>/stat line. The command may contain spaces and
+// parentheses, so it is delimited by the last ')' of the line's head.
+func parseProcStat(line string) (containerProcess, error) {
+	open := strings.Index(line, "(")
+	close := strings.LastIndex(line, ")")
+	if open < 0 || close < open {
+		return containerProcess{}, fmt.Errorf("malformed stat line: %q", line)
+	}
+
+	pid, err := strconv.Atoi(strings.TrimSpace(line[:open]))
+	if err != nil {
+		return containerProcess{}, err
+	}
+	command := line[open+1 : close]
+
+	// Fields after the command, 0-based: utime is field 11, stime 12 and
+	// rss 21 (fields 14, 15 and 24 of the full line).
+	fields := strings.Fields(line[close+1:])
+	if len(fields) < 22 {
+		return containerProcess{}, fmt.Errorf("truncated stat line: %q", line)
+	}
+
+	utime, err := strconv.ParseUint(fields[11], 10, 64)
+	if err != nil {
+		return containerProcess{}, err
+	}
+	stime, err := strconv.ParseUint(fields[12], 10, 64)
+	if err != nil {
+		return containerProcess{}, err
+	}
+	rssPages, err := strconv.ParseInt(fields[21], 10, 64)
+	if err != nil {
+		return containerProcess{}, err
+	}
+
+	return containerProcess{
+		Pid:      pid,
+		Command:  command,
+		CPUTicks: utime + stime,
+		RSSBytes: rssPages * guestPageSize,
+	}, nil
+}
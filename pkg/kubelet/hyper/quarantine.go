@@ -0,0 +1,94 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyper
+
+import (
+	"errors"
+	"time"
+
+	"github.com/golang/glog"
+
+	"k8s.io/kubernetes/pkg/api"
+	kubecontainer "k8s.io/kubernetes/pkg/kubelet/container"
+)
+
+// Events and errors of the VM recreation rate limiter.
+const reasonPodQuarantined = "PodQuarantined"
+
+var errPodQuarantined = errors.New("pod exceeded its VM recreation budget and is temporarily quarantined")
+
+// recordVMRecreation notes one VM recreation of a pod and quarantines the pod
+// when it exceeds the configured budget. CrashLoopBackOff slows an
+// individual crashing container down, but a pod that passes its probes
+// briefly and then crashes resets the backoff every time; the recreation
+// budget is the second line of defense against such pods churning VMs.
+func (r *runtime) recordVMRecreation(pod *api.Pod) {
+	config := r.configManager.getConfig()
+	if config.MaxVMRestartsPerWindow <= 0 {
+		return
+	}
+	window := time.Duration(config.VMRestartWindowSeconds) * time.Second
+	if window <= 0 {
+		window = 10 * time.Minute
+	}
+
+	r.restartLock.Lock()
+	defer r.restartLock.Unlock()
+
+	if r.restartHistory == nil {
+		r.restartHistory = make(map[string][]time.Time)
+		r.quarantinedUntil = make(map[string]time.Time)
+	}
+
+	uid := string(pod.UID)
+	now := time.Now()
+
+	recent := []time.Time{now}
+	for _, t := range r.restartHistory[uid] {
+		if now.Sub(t) < window {
+			recent = append(recent, t)
+		}
+	}
+	r.restartHistory[uid] = recent
+
+	if len(recent) > config.MaxVMRestartsPerWindow {
+		until := now.Add(window)
+		r.quarantinedUntil[uid] = until
+		glog.Warningf("Hyper: pod %s/%s recreated its VM %d times within %v, quarantined until %v",
+			pod.Namespace, pod.Name, len(recent), window, until)
+		r.recorder.Eventf(pod, api.EventTypeWarning, reasonPodQuarantined,
+			"Pod recreated its VM %d times within %v and is quarantined for %v", len(recent), window, window)
+	}
+}
+
+// podQuarantined fails the sync of a quarantined pod until its quarantine
+// expires. The pod's VM stays down for the quarantine period regardless of
+// how quickly its containers pass their probes after boot.
+func (r *runtime) podQuarantined(pod *api.Pod, result *kubecontainer.PodSyncResult) bool {
+	r.restartLock.Lock()
+	until, quarantined := r.quarantinedUntil[string(pod.UID)]
+	if quarantined && time.Now().After(until) {
+		delete(r.quarantinedUntil, string(pod.UID))
+		quarantined = false
+	}
+	r.restartLock.Unlock()
+
+	if quarantined {
+		result.Fail(errPodQuarantined)
+	}
+	return quarantined
+}
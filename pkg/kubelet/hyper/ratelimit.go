@@ -0,0 +1,73 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyper
+
+import (
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"k8s.io/kubernetes/pkg/util/flowcontrol"
+)
+
+// Client-side rate limiting. On a dense node the monitors, the sync loop
+// and GC together can hammer hyperd hard enough that pod boots queue behind
+// status calls. Like the kubeClient QPS flags, an operator-configured token
+// bucket smooths the call rate; the throttle metric shows when the cap is
+// the bottleneck.
+
+var throttledCalls = prometheus.NewCounter(prometheus.CounterOpts{
+	Subsystem: "hyper",
+	Name:      "throttled_calls_total",
+	Help:      "Number of hyperd calls delayed by the client-side QPS limit.",
+})
+
+func init() {
+	prometheus.MustRegister(throttledCalls)
+}
+
+// setRateLimit installs a client-side QPS cap with the given burst. A
+// non-positive QPS leaves calls unthrottled, the historical behavior. Must
+// be called before the client is used; calls do not take a lock around the
+// limiter.
+func (c *HyperClient) setRateLimit(qps float64, burst int) {
+	if qps <= 0 {
+		return
+	}
+	if burst < 1 {
+		burst = 1
+	}
+	c.limiter = flowcontrol.NewTokenBucketRateLimiter(float32(qps), burst)
+	glog.V(2).Infof("Hyper: limiting hyperd calls to %.1f QPS (burst %d)", qps, burst)
+}
+
+// throttle blocks until the limiter admits another hyperd call, counting
+// the calls that actually had to wait.
+func (c *HyperClient) throttle() {
+	if c.limiter == nil {
+		return
+	}
+	if c.limiter.TryAccept() {
+		return
+	}
+
+	start := time.Now()
+	c.limiter.Accept()
+	throttledCalls.Inc()
+	glog.V(4).Infof("Hyper: call throttled for %v by the QPS limit", time.Since(start))
+}
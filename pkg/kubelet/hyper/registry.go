@@ -0,0 +1,157 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyper
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/golang/glog"
+)
+
+const (
+	// Default location of the node-level registry configuration consumed by
+	// the hyper runtime. The file is optional.
+	hyperRegistryConfigFile = "/var/lib/kubelet/hyper-registry.json"
+
+	// Per-registry CA bundles are installed here so hyperd picks them up
+	// when pulling, following the docker certs.d layout.
+	hyperRegistryCertsDir = "/etc/hyper/certs.d"
+
+	// defaultRegistry is the registry implied by unqualified image names.
+	defaultRegistry = "docker.io"
+)
+
+// RegistryConfig carries node-level registry settings for image pulls:
+// mirrors, insecure registries and per-registry CA bundles. It allows
+// air-gapped and private-registry clusters to work without modifying the
+// hyperd daemon configuration by hand.
+type RegistryConfig struct {
+	// Mirrors maps a registry host to the mirror that should be used
+	// instead when pulling, e.g. "docker.io" -> "mirror.example.com:5000".
+	Mirrors map[string]string `json:"mirrors,omitempty"`
+
+	// InsecureRegistries lists registry hosts that may be reached without
+	// TLS verification.
+	InsecureRegistries []string `json:"insecureRegistries,omitempty"`
+
+	// CABundles maps a registry host to a PEM CA bundle file on the node.
+	// The bundles are installed into hyperd's certs.d directory at startup.
+	CABundles map[string]string `json:"caBundles,omitempty"`
+
+	// CredentialHelpers maps a registry host to a docker-style exec
+	// credential helper binary queried on every pull, e.g.
+	// "123456789.dkr.ecr.us-east-1.amazonaws.com" -> "docker-credential-ecr-login".
+	CredentialHelpers map[string]string `json:"credentialHelpers,omitempty"`
+}
+
+// readRegistryConfig loads the registry configuration from the given file.
+// A missing file yields an empty configuration.
+func readRegistryConfig(configFile string) (*RegistryConfig, error) {
+	config := &RegistryConfig{}
+
+	data, err := ioutil.ReadFile(configFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return config, nil
+		}
+		return nil, err
+	}
+
+	if err := json.Unmarshal(data, config); err != nil {
+		return nil, fmt.Errorf("failed to parse registry config %s: %v", configFile, err)
+	}
+
+	return config, nil
+}
+
+// imageRegistry returns the registry host part of an image reference, or
+// the default registry for unqualified names.
+func imageRegistry(image string) string {
+	parts := strings.SplitN(image, "/", 2)
+	if len(parts) == 2 && (strings.ContainsAny(parts[0], ".:") || parts[0] == "localhost") {
+		return parts[0]
+	}
+	return defaultRegistry
+}
+
+// mirrorImage rewrites an image reference through the configured mirror of
+// its registry, if there is one.
+func (c *RegistryConfig) mirrorImage(image string) string {
+	if c == nil || len(c.Mirrors) == 0 {
+		return image
+	}
+
+	registry := imageRegistry(image)
+	mirror, ok := c.Mirrors[registry]
+	if !ok {
+		return image
+	}
+
+	repo := image
+	if strings.HasPrefix(image, registry+"/") {
+		repo = strings.TrimPrefix(image, registry+"/")
+	}
+	return fmt.Sprintf("%s/%s", mirror, repo)
+}
+
+// isInsecureRegistry returns whether the registry is explicitly allowed to
+// be reached without TLS verification.
+func (c *RegistryConfig) isInsecureRegistry(registry string) bool {
+	if c == nil {
+		return false
+	}
+	for _, insecure := range c.InsecureRegistries {
+		if insecure == registry {
+			return true
+		}
+	}
+	return false
+}
+
+// installRegistryCertificates copies the configured per-registry CA bundles
+// into hyperd's certs.d directory so the daemon trusts them when pulling.
+func (c *RegistryConfig) installRegistryCertificates(certsDir string) error {
+	if c == nil || len(c.CABundles) == 0 {
+		return nil
+	}
+
+	for registry, bundle := range c.CABundles {
+		data, err := ioutil.ReadFile(bundle)
+		if err != nil {
+			return fmt.Errorf("failed to read CA bundle %s for registry %s: %v", bundle, registry, err)
+		}
+
+		registryDir := path.Join(certsDir, registry)
+		if err := os.MkdirAll(registryDir, 0755); err != nil {
+			return err
+		}
+
+		caFile := path.Join(registryDir, "ca.crt")
+		if err := ioutil.WriteFile(caFile, data, 0644); err != nil {
+			return err
+		}
+
+		glog.V(4).Infof("Hyper: installed CA bundle for registry %s at %s", registry, caFile)
+	}
+
+	return nil
+}
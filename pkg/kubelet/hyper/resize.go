@@ -0,0 +1,162 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyper
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/golang/glog"
+
+	"k8s.io/kubernetes/pkg/api"
+	kubecontainer "k8s.io/kubernetes/pkg/kubelet/container"
+	"k8s.io/kubernetes/pkg/util/wait"
+)
+
+// Online volume resize. When a PVC of a running pod is grown, the storage
+// backend resizes the underlying device (Cinder volume, rbd image, iSCSI
+// LUN) online, but neither the guest kernel nor the filesystem notice by
+// themselves. The monitor below watches PVC capacities and, on growth,
+// rescans the device and grows the filesystem from inside the guest — no
+// pod restart, which would be a full VM recreation here.
+
+// How often PVC capacities of running pods are compared.
+const volumeResizeCheckInterval = time.Minute
+
+// startVolumeResizeMonitor watches PVCs of running pods for capacity growth.
+func (r *runtime) startVolumeResizeMonitor() {
+	go wait.Until(r.checkVolumeResizes, volumeResizeCheckInterval, wait.NeverStop)
+}
+
+// checkVolumeResizes compares the current capacity of every PVC mounted by a
+// running pod against the last observed one and grows grown volumes in the
+// guest. The first observation only records the baseline.
+func (r *runtime) checkVolumeResizes() {
+	if r.kubeClient == nil {
+		return
+	}
+
+	podInfos, err := r.hyperClient.ListPods()
+	if err != nil {
+		glog.Warningf("Hyper: volume resize monitor: ListPods failed: %v", err)
+		return
+	}
+
+	for _, podInfo := range podInfos {
+		if podInfo.Status != StatusRunning {
+			continue
+		}
+
+		name, namespace, err := kubecontainer.ParsePodFullName(podInfo.PodName)
+		if err != nil {
+			continue
+		}
+		pod, err := r.kubeClient.Core().Pods(namespace).Get(name)
+		if err != nil {
+			glog.V(4).Infof("Hyper: volume resize monitor: cannot get pod %s: %v", podInfo.PodName, err)
+			continue
+		}
+
+		for _, volume := range pod.Spec.Volumes {
+			if volume.PersistentVolumeClaim == nil {
+				continue
+			}
+			claim := volume.PersistentVolumeClaim.ClaimName
+			pvc, err := r.kubeClient.Core().PersistentVolumeClaims(namespace).Get(claim)
+			if err != nil {
+				glog.V(4).Infof("Hyper: volume resize monitor: cannot get claim %s/%s: %v", namespace, claim, err)
+				continue
+			}
+			capacity, ok := pvc.Status.Capacity[api.ResourceStorage]
+			if !ok {
+				continue
+			}
+
+			key := podInfo.PodName + "/" + claim
+			bytes := capacity.Value()
+
+			r.resizeLock.Lock()
+			if r.observedCapacities == nil {
+				r.observedCapacities = make(map[string]int64)
+			}
+			observed, seen := r.observedCapacities[key]
+			if !seen || bytes <= observed {
+				r.observedCapacities[key] = bytes
+				r.resizeLock.Unlock()
+				continue
+			}
+			r.resizeLock.Unlock()
+
+			if err := r.growVolumeInGuest(pod, podInfo, volume.Name); err != nil {
+				glog.Warningf("Hyper: growing volume %s of pod %s failed: %v", volume.Name, podInfo.PodName, err)
+				r.recorder.Eventf(pod, api.EventTypeWarning, "VolumeResizeFailed",
+					"Growing volume %q to %s in the guest failed: %v", volume.Name, capacity.String(), err)
+				continue
+			}
+
+			r.resizeLock.Lock()
+			r.observedCapacities[key] = bytes
+			r.resizeLock.Unlock()
+			r.recorder.Eventf(pod, api.EventTypeNormal, "VolumeResized",
+				"Volume %q grown to %s without restarting the pod", volume.Name, capacity.String())
+		}
+	}
+}
+
+// growVolumeInGuest rescans the volume's device and grows its filesystem
+// from inside the guest, through the container mounting the volume.
+func (r *runtime) growVolumeInGuest(pod *api.Pod, podInfo HyperPod, volumeName string) error {
+	mountPath, containerName := "", ""
+	for _, container := range pod.Spec.Containers {
+		for _, mount := range container.VolumeMounts {
+			if mount.Name == volumeName {
+				mountPath, containerName = mount.MountPath, container.Name
+				break
+			}
+		}
+		if mountPath != "" {
+			break
+		}
+	}
+	if mountPath == "" {
+		return fmt.Errorf("volume %s is not mounted by any container", volumeName)
+	}
+
+	var containerID string
+	for _, c := range podInfo.PodInfo.Status.ContainerStatus {
+		parsedName, _, _, err := r.containerMetadata(c.Name, containerSpecLabels(podInfo.PodInfo.Spec, c.ContainerID))
+		if err == nil && parsedName == containerName && c.Phase == StatusRunning {
+			containerID = c.ContainerID
+			break
+		}
+	}
+	if containerID == "" {
+		return fmt.Errorf("no running container mounts volume %s", volumeName)
+	}
+
+	// Rescan picks up the grown device size; resize2fs and xfs_growfs cover
+	// the filesystems the guest images ship with.
+	script := fmt.Sprintf(
+		"dev=$(df -P %s | awk 'NR==2{print $1}'); "+
+			"[ -e /sys/class/block/$(basename $dev)/device/rescan ] && echo 1 > /sys/class/block/$(basename $dev)/device/rescan; "+
+			"resize2fs $dev 2>/dev/null || xfs_growfs %s", mountPath, mountPath)
+	output, err := r.RunInContainer(kubecontainer.ContainerID{Type: typeHyper, ID: containerID}, []string{"sh", "-c", script})
+	if err != nil {
+		return fmt.Errorf("%v: %s", err, string(output))
+	}
+	return nil
+}
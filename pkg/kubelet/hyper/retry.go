@@ -0,0 +1,136 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyper
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+
+	"k8s.io/kubernetes/pkg/util/wait"
+)
+
+// A hyperd restart drops every in-flight gRPC call. Idempotent read calls are
+// retried with exponential backoff and jitter to ride the restart out; when
+// hyperd stays unreachable a circuit breaker fails further calls fast and
+// surfaces the outage through the runtime health check instead of letting
+// every caller block on its own timeout.
+
+const (
+	// How often an idempotent call is attempted in total.
+	retryAttempts = 3
+
+	// Backoff before the second attempt; doubled per further attempt and
+	// jittered by up to 50% to avoid thundering herds after a restart.
+	retryBaseDelay = 200 * time.Millisecond
+
+	// Consecutive unreachable-daemon failures before the breaker opens.
+	breakerThreshold = 5
+
+	// How long an open breaker fails calls fast before probing again.
+	breakerCooldown = 30 * time.Second
+)
+
+// circuitBreaker counts consecutive failures to reach hyperd. The zero value
+// is a closed breaker.
+type circuitBreaker struct {
+	sync.Mutex
+	failures  int
+	openUntil time.Time
+}
+
+// check returns an error while the breaker is open. After the cooldown the
+// breaker lets calls through again; the failure count stays, so the next
+// unreachable-daemon failure reopens it immediately.
+func (b *circuitBreaker) check() error {
+	b.Lock()
+	defer b.Unlock()
+	if !b.openUntil.IsZero() && time.Now().Before(b.openUntil) {
+		return &hyperError{
+			kind:  ErrDaemonUnavailable,
+			cause: fmt.Errorf("hyperd circuit open after %d consecutive failures", b.failures),
+		}
+	}
+	return nil
+}
+
+// record updates the breaker with a call outcome. Any answer from hyperd —
+// including an error — proves the daemon reachable and closes the breaker.
+func (b *circuitBreaker) record(err error) {
+	b.Lock()
+	defer b.Unlock()
+
+	if !IsDaemonUnavailable(err) {
+		b.failures = 0
+		b.openUntil = time.Time{}
+		return
+	}
+
+	b.failures++
+	if b.failures >= breakerThreshold && time.Now().After(b.openUntil) {
+		b.openUntil = time.Now().Add(breakerCooldown)
+		glog.Warningf("Hyper: hyperd unreachable for %d consecutive calls, failing fast for %v", b.failures, breakerCooldown)
+	}
+}
+
+// withRetry runs an idempotent call against hyperd, retrying
+// unreachable-daemon failures with exponential backoff and jitter. Callers
+// must only pass calls that are safe to repeat.
+func (c *HyperClient) withRetry(operation string, call func() error) error {
+	if err := c.breaker.check(); err != nil {
+		return err
+	}
+
+	c.throttle()
+
+	token := c.inflight.begin(operation)
+	defer c.inflight.end(token)
+
+	// Per-RPC timing at high verbosity, so a slow pod start can be pinned
+	// on an individual hyperd call.
+	start := time.Now()
+	defer func() {
+		glog.V(5).Infof("Hyper: %s RPC took %v", operation, time.Since(start))
+	}()
+
+	var err error
+	delay := retryBaseDelay
+	for attempt := 0; attempt < retryAttempts; attempt++ {
+		if attempt > 0 {
+			time.Sleep(wait.Jitter(delay, 0.5))
+			delay *= 2
+		}
+
+		err = classifyError(call())
+		c.breaker.record(err)
+		if !IsDaemonUnavailable(err) {
+			return err
+		}
+		glog.V(2).Infof("Hyper: %s failed on attempt %d: %v", operation, attempt+1, err)
+	}
+
+	// The endpoint stayed unreachable through a whole retry cycle; switch
+	// to the standby, if one is configured, and replay the call once.
+	if c.failover() {
+		err = classifyError(call())
+		c.breaker.record(err)
+	}
+
+	return err
+}
@@ -0,0 +1,56 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyper
+
+import (
+	"fmt"
+
+	"k8s.io/kubernetes/pkg/api"
+)
+
+// Event emitted when a pod requests security settings hyper cannot honor.
+const reasonUnsupportedSecurityContext = "UnsupportedSecurityContext"
+
+// validatePodSecurityContext rejects pods whose security context cannot be
+// expressed in a hyper VM. The guest agent runs containers without the
+// docker capability machinery, so privileged mode and capability add/drop
+// would be silently ignored; running such a pod with different semantics
+// than requested is worse than refusing it with a clear error.
+//
+// AllowPrivileged permits privileged containers explicitly: the VM boundary
+// already isolates them from the host, so some deployments accept the
+// in-guest semantics.
+func (r *runtime) validatePodSecurityContext(pod *api.Pod) error {
+	allowPrivileged := r.configManager.getConfig().AllowPrivileged
+
+	for _, container := range pod.Spec.Containers {
+		sc := container.SecurityContext
+		if sc == nil {
+			continue
+		}
+
+		if sc.Privileged != nil && *sc.Privileged && !allowPrivileged {
+			return fmt.Errorf("container %s requests privileged mode, which the hyper runtime does not support (set allowPrivileged in the runtime configuration to accept in-guest semantics)", container.Name)
+		}
+
+		if sc.Capabilities != nil && (len(sc.Capabilities.Add) > 0 || len(sc.Capabilities.Drop) > 0) {
+			return fmt.Errorf("container %s requests capability changes (add: %v, drop: %v), which the hyper guest agent cannot apply", container.Name, sc.Capabilities.Add, sc.Capabilities.Drop)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,321 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyper
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/pprof"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+// Number of runtime errors retained for the state snapshot.
+const maxRecordedErrors = 32
+
+// errorRecord is one remembered runtime failure.
+type errorRecord struct {
+	Time      time.Time `json:"time"`
+	Operation string    `json:"operation"`
+	Error     string    `json:"error"`
+}
+
+// specFileInfo describes a pod spec checkpoint without exposing its content;
+// the checkpoints themselves are already redacted, but the snapshot only
+// needs their metadata.
+type specFileInfo struct {
+	Name    string    `json:"name"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"modTime"`
+}
+
+// podSnapshot is the per-pod slice of the state snapshot.
+type podSnapshot struct {
+	Name      string `json:"name"`
+	ID        string `json:"id"`
+	Status    string `json:"status"`
+	CreatedAt int64  `json:"createdAt"`
+}
+
+// stateSnapshot is the sanitized runtime state exported for support bundles.
+// It must never contain secrets: pod specs are reduced to checkpoint
+// metadata and the configuration carries only file paths.
+type stateSnapshot struct {
+	Time          time.Time              `json:"time"`
+	HyperdVersion string                 `json:"hyperdVersion"`
+	Config        *Config                `json:"config"`
+	Capabilities  agentCapabilities      `json:"capabilities"`
+	Hypervisor    hypervisorCapabilities `json:"hypervisor"`
+	CLIAvailable  bool                   `json:"cliAvailable"`
+	Pods          []podSnapshot          `json:"pods"`
+	SpecFiles     []specFileInfo         `json:"specFiles"`
+	LastErrors    []errorRecord          `json:"lastErrors"`
+}
+
+// recordError remembers a runtime failure for the state snapshot, keeping the
+// most recent maxRecordedErrors entries.
+func (r *runtime) recordError(operation string, err error) {
+	if err == nil {
+		return
+	}
+
+	r.errorsLock.Lock()
+	defer r.errorsLock.Unlock()
+
+	r.lastErrors = append(r.lastErrors, errorRecord{Time: time.Now(), Operation: operation, Error: err.Error()})
+	if len(r.lastErrors) > maxRecordedErrors {
+		r.lastErrors = r.lastErrors[len(r.lastErrors)-maxRecordedErrors:]
+	}
+}
+
+// stateSnapshot assembles the sanitized runtime state as JSON.
+func (r *runtime) stateSnapshot() ([]byte, error) {
+	snapshot := stateSnapshot{
+		Time:         time.Now(),
+		Config:       r.configManager.getConfig(),
+		Capabilities: r.agentCapabilities(),
+		Hypervisor:   r.hypervisorCaps,
+		CLIAvailable: r.cliRunner.available(),
+	}
+
+	if version, err := r.hyperClient.Version(); err == nil {
+		snapshot.HyperdVersion = version
+	} else {
+		r.recordError("version", err)
+	}
+
+	if podInfos, err := r.hyperClient.ListPods(); err == nil {
+		for _, podInfo := range podInfos {
+			snapshot.Pods = append(snapshot.Pods, podSnapshot{
+				Name:      podInfo.PodName,
+				ID:        podInfo.PodID,
+				Status:    podInfo.Status,
+				CreatedAt: podInfo.PodInfo.CreatedAt,
+			})
+		}
+	} else {
+		r.recordError("list pods", err)
+	}
+
+	if files, err := ioutil.ReadDir(r.specDir); err == nil {
+		for _, file := range files {
+			snapshot.SpecFiles = append(snapshot.SpecFiles, specFileInfo{
+				Name:    file.Name(),
+				Size:    file.Size(),
+				ModTime: file.ModTime(),
+			})
+		}
+	}
+
+	r.errorsLock.Lock()
+	snapshot.LastErrors = append([]errorRecord{}, r.lastErrors...)
+	r.errorsLock.Unlock()
+
+	return json.MarshalIndent(&snapshot, "", "  ")
+}
+
+// serveFreezeThaw handles a freeze or thaw request against a pod's volume
+// filesystems for the snapshot hooks.
+func (r *runtime) serveFreezeThaw(w http.ResponseWriter, req *http.Request, op func(string) error) {
+	if !r.featureEnabled(FeatureSnapshotHooks) {
+		http.Error(w, "snapshot hooks are disabled by feature gate", http.StatusForbidden)
+		return
+	}
+	if req.Method != "POST" {
+		http.Error(w, "only POST is supported", http.StatusMethodNotAllowed)
+		return
+	}
+	var request struct {
+		Pod string `json:"pod"`
+	}
+	if err := json.NewDecoder(req.Body).Decode(&request); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if request.Pod == "" {
+		http.Error(w, "pod is required", http.StatusBadRequest)
+		return
+	}
+	if err := op(request.Pod); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// startDebugServer exposes the state snapshot on the configured debug
+// address. The endpoint is meant for operators building support bundles and
+// is disabled unless an address is configured; it should only be bound to
+// localhost.
+func (r *runtime) startDebugServer(address string) {
+	if address == "" {
+		return
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/runtime/snapshot", func(w http.ResponseWriter, req *http.Request) {
+		data, err := r.stateSnapshot()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(data)
+	})
+	mux.HandleFunc("/runtime/prefetch", func(w http.ResponseWriter, req *http.Request) {
+		if !r.featureEnabled(FeatureImagePrefetch) {
+			http.Error(w, "image prefetching is disabled by feature gate", http.StatusForbidden)
+			return
+		}
+		if req.Method != "POST" {
+			http.Error(w, "only POST is supported", http.StatusMethodNotAllowed)
+			return
+		}
+		var hint struct {
+			Images []string `json:"images"`
+		}
+		if err := json.NewDecoder(req.Body).Decode(&hint); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if len(hint.Images) == 0 {
+			http.Error(w, "images list is empty", http.StatusBadRequest)
+			return
+		}
+		r.prefetchImages(hint.Images)
+		w.WriteHeader(http.StatusAccepted)
+	})
+	mux.HandleFunc("/runtime/eviction-stats", func(w http.ResponseWriter, req *http.Request) {
+		data, err := json.MarshalIndent(r.getEvictionStats(), "", "  ")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(data)
+	})
+	mux.HandleFunc("/runtime/console", r.serveConsole)
+	mux.HandleFunc("/runtime/debug-container", func(w http.ResponseWriter, req *http.Request) {
+		if !r.featureEnabled(FeatureDebugContainers) {
+			http.Error(w, "debug container injection is disabled by feature gate", http.StatusForbidden)
+			return
+		}
+		if req.Method != "POST" {
+			http.Error(w, "only POST is supported", http.StatusMethodNotAllowed)
+			return
+		}
+		var request struct {
+			Pod     string   `json:"pod"`
+			Image   string   `json:"image"`
+			Command []string `json:"command"`
+		}
+		if err := json.NewDecoder(req.Body).Decode(&request); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if request.Pod == "" || request.Image == "" {
+			http.Error(w, "pod and image are required", http.StatusBadRequest)
+			return
+		}
+		containerID, err := r.injectDebugContainer(request.Pod, request.Image, request.Command)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"containerID": containerID})
+	})
+	mux.HandleFunc("/runtime/freeze", func(w http.ResponseWriter, req *http.Request) {
+		r.serveFreezeThaw(w, req, r.freezePodVolumes)
+	})
+	mux.HandleFunc("/runtime/thaw", func(w http.ResponseWriter, req *http.Request) {
+		r.serveFreezeThaw(w, req, r.thawPodVolumes)
+	})
+	mux.HandleFunc("/runtime/gc-report", func(w http.ResponseWriter, req *http.Request) {
+		minAge := time.Duration(0)
+		if value := req.URL.Query().Get("minAge"); value != "" {
+			parsed, err := time.ParseDuration(value)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			minAge = parsed
+		}
+		report, err := r.gcDryRun(minAge)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		data, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(data)
+	})
+	mux.HandleFunc("/runtime/client", func(w http.ResponseWriter, req *http.Request) {
+		state := struct {
+			Client     clientDebugState `json:"client"`
+			LastErrors []errorRecord    `json:"lastErrors"`
+		}{Client: r.hyperClient.debugState()}
+
+		r.errorsLock.Lock()
+		state.LastErrors = append([]errorRecord{}, r.lastErrors...)
+		r.errorsLock.Unlock()
+
+		data, err := json.MarshalIndent(&state, "", "  ")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(data)
+	})
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.HandleFunc("/runtime/processes", func(w http.ResponseWriter, req *http.Request) {
+		container := req.URL.Query().Get("container")
+		if container == "" {
+			http.Error(w, "container parameter is required", http.StatusBadRequest)
+			return
+		}
+		processes, err := r.listProcesses(container)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		data, err := json.MarshalIndent(processes, "", "  ")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(data)
+	})
+
+	go func() {
+		if err := http.ListenAndServe(address, mux); err != nil {
+			glog.Errorf("Hyper: debug server on %s failed: %v", address, err)
+		}
+	}()
+}
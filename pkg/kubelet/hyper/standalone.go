@@ -0,0 +1,139 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyper
+
+import (
+	"net/http"
+	"time"
+
+	"k8s.io/kubernetes/pkg/api"
+	clientset "k8s.io/kubernetes/pkg/client/clientset_generated/internalclientset"
+	"k8s.io/kubernetes/pkg/client/record"
+	kubecontainer "k8s.io/kubernetes/pkg/kubelet/container"
+	"k8s.io/kubernetes/pkg/kubelet/network"
+	proberesults "k8s.io/kubernetes/pkg/kubelet/prober/results"
+	"k8s.io/kubernetes/pkg/types"
+	"k8s.io/kubernetes/pkg/util/flowcontrol"
+	"k8s.io/kubernetes/pkg/volume"
+)
+
+// StandaloneOptions configures a hyper runtime constructed outside of a
+// kubelet, e.g. by integration tests or by tools that drive hyper pods
+// directly. Every field is optional; zero values are replaced with inert
+// defaults.
+type StandaloneOptions struct {
+	// Recorder receives runtime events. Defaults to a recorder that
+	// discards them.
+	Recorder record.EventRecorder
+
+	// KubeClient is used by background reconcilers that need the API
+	// server view (e.g. orphan cleanup). Without it those reconcilers
+	// stay inert, which is usually what a standalone consumer wants.
+	KubeClient clientset.Interface
+
+	// NetworkPlugin wires pod networking. Defaults to the no-op plugin,
+	// leaving networking entirely to hyperd.
+	NetworkPlugin network.NetworkPlugin
+
+	// RuntimeHelper supplies per-pod data normally computed by the
+	// kubelet (run options, DNS, volumes). Defaults to a helper that
+	// returns empty values, sufficient for self-contained pod specs.
+	RuntimeHelper kubecontainer.RuntimeHelper
+
+	// ContainerLogsDir is where container log symlinks are created.
+	// Defaults to the kubelet's standard location.
+	ContainerLogsDir string
+
+	// DisableHyperInternalService disables the internal haproxy service
+	// in created pods.
+	DisableHyperInternalService bool
+}
+
+// standaloneRuntimeHelper is the default RuntimeHelper of a standalone
+// runtime. It provides no kubelet-derived data beyond the container
+// environment, so pods are created exactly as specified.
+type standaloneRuntimeHelper struct {
+	kubeClient clientset.Interface
+}
+
+func (h *standaloneRuntimeHelper) GenerateRunContainerOptions(pod *api.Pod, container *api.Container, podIP string) (*kubecontainer.RunContainerOptions, error) {
+	// Resolve the environment the way the kubelet would, so valueFrom
+	// references and $(VAR) expansion in command and args work in
+	// standalone mode too.
+	envs, err := resolveContainerEnv(h.kubeClient, pod, container)
+	if err != nil {
+		return nil, err
+	}
+	return &kubecontainer.RunContainerOptions{Envs: envs}, nil
+}
+
+func (h *standaloneRuntimeHelper) GetClusterDNS(pod *api.Pod) ([]string, []string, error) {
+	return nil, nil, nil
+}
+
+func (h *standaloneRuntimeHelper) GetPodDir(podUID types.UID) string {
+	return ""
+}
+
+func (h *standaloneRuntimeHelper) GeneratePodHostNameAndDomain(pod *api.Pod) (string, string, error) {
+	return pod.Name, "", nil
+}
+
+func (h *standaloneRuntimeHelper) ListVolumesForPod(podUID types.UID) (map[string]volume.Volume, bool) {
+	return nil, false
+}
+
+// NewStandalone creates a hyper runtime without a kubelet around it. It reads
+// the same node-level configuration files as the kubelet-embedded runtime and
+// runs the same background loops, so a pod handed to RunPod behaves the same
+// either way.
+func NewStandalone(options StandaloneOptions) (kubecontainer.Runtime, error) {
+	recorder := options.Recorder
+	if recorder == nil {
+		recorder = &record.FakeRecorder{}
+	}
+
+	networkPlugin := options.NetworkPlugin
+	if networkPlugin == nil {
+		networkPlugin = &network.NoopNetworkPlugin{}
+	}
+
+	runtimeHelper := options.RuntimeHelper
+	if runtimeHelper == nil {
+		runtimeHelper = &standaloneRuntimeHelper{kubeClient: options.KubeClient}
+	}
+
+	containerLogsDir := options.ContainerLogsDir
+	if containerLogsDir == "" {
+		containerLogsDir = "/var/log/containers"
+	}
+
+	return New(runtimeHelper,
+		recorder,
+		networkPlugin,
+		kubecontainer.NewRefManager(),
+		proberesults.NewManager(),
+		proberesults.NewManager(),
+		options.KubeClient,
+		flowcontrol.NewBackOff(10*time.Second, 5*time.Minute),
+		false,
+		&http.Client{},
+		options.DisableHyperInternalService,
+		containerLogsDir,
+		kubecontainer.RealOS{},
+	)
+}
@@ -0,0 +1,186 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyper
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"k8s.io/kubernetes/pkg/api"
+	"k8s.io/kubernetes/pkg/api/resource"
+	kubecontainer "k8s.io/kubernetes/pkg/kubelet/container"
+	"k8s.io/kubernetes/pkg/types"
+	"k8s.io/kubernetes/pkg/util/wait"
+)
+
+const (
+	// Annotation capping the writable storage of a pod VM, as a resource
+	// quantity, e.g. "2Gi". The hyperd API has no write-layer size knob,
+	// so the cap is enforced by the monitor below instead of by qemu.
+	ephemeralStorageLimitAnnotation = "hyper.sh/ephemeral-storage-limit"
+
+	// Label carrying the cap in bytes on the hyperd pod, so the monitor
+	// can enforce it without the API pod at hand.
+	storageLimitLabel = "sh.hyper.ephemeral-storage-limit"
+
+	// How often guest rootfs usage is measured.
+	storageCheckInterval = time.Minute
+
+	reasonEphemeralStorageExceeded = "EphemeralStorageExceeded"
+)
+
+var podEphemeralStorage = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Subsystem: "hyper",
+		Name:      "pod_ephemeral_storage_bytes",
+		Help:      "Bytes used on the writable rootfs layers of the pod VM guest.",
+	},
+	[]string{"pod"},
+)
+
+func init() {
+	prometheus.MustRegister(podEphemeralStorage)
+}
+
+// podEphemeralStorageLimit returns the writable-storage cap of a pod in
+// bytes: the annotation when set, otherwise the summed "storage" limits of
+// its containers. Zero means uncapped.
+func podEphemeralStorageLimit(pod *api.Pod) (int64, error) {
+	if value, ok := pod.Annotations[ephemeralStorageLimitAnnotation]; ok {
+		quantity, err := resource.ParseQuantity(value)
+		if err != nil {
+			return 0, fmt.Errorf("malformed annotation %s=%q: %v", ephemeralStorageLimitAnnotation, value, err)
+		}
+		return quantity.Value(), nil
+	}
+
+	var limit int64
+	for _, container := range pod.Spec.Containers {
+		if quantity, ok := container.Resources.Limits[api.ResourceStorage]; ok {
+			limit += quantity.Value()
+		}
+	}
+	return limit, nil
+}
+
+// startStorageMonitor periodically measures the writable rootfs usage of
+// every running pod VM, for eviction decisions and the storage caps.
+func (r *runtime) startStorageMonitor() {
+	go wait.Until(r.measureEphemeralStorage, storageCheckInterval, wait.NeverStop)
+}
+
+// measureEphemeralStorage sums the rootfs usage of the containers of each
+// running pod through exec sessions. The usage is exported as a per-pod
+// metric and remembered for the state snapshot; pods over their cap get a
+// warning event. hyperd cannot size the write layer itself, so this monitor
+// is the enforcement point of ephemeral-storage limits.
+func (r *runtime) measureEphemeralStorage() {
+	podInfos, err := r.hyperClient.ListPods()
+	if err != nil {
+		glog.Warningf("Hyper: storage monitor: ListPods failed: %v", err)
+		return
+	}
+
+	usage := make(map[string]int64)
+	for _, podInfo := range podInfos {
+		if podInfo.Status != StatusRunning {
+			continue
+		}
+
+		var podBytes int64
+		measured := false
+		for _, c := range podInfo.PodInfo.Status.ContainerStatus {
+			if c.Phase != StatusRunning {
+				continue
+			}
+			usedBytes, err := r.containerRootfsUsage(c.ContainerID)
+			if err != nil {
+				glog.V(4).Infof("Hyper: storage monitor: cannot measure container %s of pod %s: %v", c.ContainerID, podInfo.PodName, err)
+				continue
+			}
+			podBytes += usedBytes
+			measured = true
+		}
+		if !measured {
+			continue
+		}
+
+		podEphemeralStorage.WithLabelValues(podInfo.PodName).Set(float64(podBytes))
+		usage[podInfo.PodName] = podBytes
+
+		if value, ok := podInfo.PodInfo.Spec.Labels[storageLimitLabel]; ok {
+			limit, err := strconv.ParseInt(value, 10, 64)
+			if err == nil && limit > 0 && podBytes > limit {
+				r.warnOverStorageLimit(podInfo, podBytes, limit)
+			}
+		}
+	}
+
+	r.storageLock.Lock()
+	for podName := range r.storageUsage {
+		if _, ok := usage[podName]; !ok {
+			podEphemeralStorage.DeleteLabelValues(podName)
+		}
+	}
+	r.storageUsage = usage
+	r.storageLock.Unlock()
+}
+
+// containerRootfsUsage measures the used bytes of a container's rootfs via
+// an in-guest df.
+func (r *runtime) containerRootfsUsage(containerID string) (int64, error) {
+	output, err := r.RunInContainer(kubecontainer.ContainerID{Type: typeHyper, ID: containerID}, []string{"df", "-kP", "/"})
+	if err != nil {
+		return 0, err
+	}
+
+	lines := strings.Split(strings.TrimSpace(string(output)), "\n")
+	if len(lines) < 2 {
+		return 0, fmt.Errorf("unexpected df output %q", output)
+	}
+	fields := strings.Fields(lines[len(lines)-1])
+	if len(fields) < 3 {
+		return 0, fmt.Errorf("unexpected df output %q", output)
+	}
+	usedKB, err := strconv.ParseInt(fields[2], 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("unexpected df output %q: %v", output, err)
+	}
+	return usedKB * 1024, nil
+}
+
+// warnOverStorageLimit emits a warning event for a pod whose measured usage
+// exceeds its cap. Eviction stays with the kubelet eviction manager, which
+// acts on the exported metric; the event gives the pod owner the reason.
+func (r *runtime) warnOverStorageLimit(podInfo HyperPod, usedBytes, limit int64) {
+	podName, podNamespace, err := kubecontainer.ParsePodFullName(podInfo.PodName)
+	if err != nil {
+		return
+	}
+	pod := &api.Pod{ObjectMeta: api.ObjectMeta{
+		Name:      podName,
+		Namespace: podNamespace,
+		UID:       types.UID(podInfo.PodInfo.Spec.Labels[KEY_API_POD_UID]),
+	}}
+	r.recorder.Eventf(pod, api.EventTypeWarning, reasonEphemeralStorageExceeded,
+		"Pod uses %d bytes of ephemeral storage, over its limit of %d bytes", usedBytes, limit)
+}
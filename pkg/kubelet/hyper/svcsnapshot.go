@@ -0,0 +1,70 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyper
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path"
+
+	"github.com/golang/glog"
+
+	grpctypes "k8s.io/kubernetes/pkg/kubelet/hyper/types"
+)
+
+// Last-known service/endpoint lists are checkpointed here per namespace.
+// When a pod (re)starts while the API server is unreachable, its in-pod
+// proxy is seeded from the snapshot instead of starting with no backends.
+const serviceSnapshotDir = "/var/lib/kubelet/hyper-service-snapshots"
+
+// saveServiceSnapshot checkpoints the freshly discovered service list of a
+// namespace. Failures only cost the warm standby, not the pod.
+func saveServiceSnapshot(namespace string, services []grpctypes.UserService) {
+	if err := os.MkdirAll(serviceSnapshotDir, 0700); err != nil {
+		glog.V(4).Infof("Hyper: cannot create service snapshot directory: %v", err)
+		return
+	}
+
+	data, err := json.Marshal(services)
+	if err != nil {
+		glog.V(4).Infof("Hyper: cannot marshal service snapshot of namespace %s: %v", namespace, err)
+		return
+	}
+
+	file := path.Join(serviceSnapshotDir, namespace+".json")
+	if err := ioutil.WriteFile(file, data, 0600); err != nil {
+		glog.V(4).Infof("Hyper: cannot write service snapshot %s: %v", file, err)
+	}
+}
+
+// loadServiceSnapshot returns the last-known service list of a namespace, or
+// nil when no snapshot exists.
+func loadServiceSnapshot(namespace string) []grpctypes.UserService {
+	data, err := ioutil.ReadFile(path.Join(serviceSnapshotDir, namespace+".json"))
+	if err != nil {
+		return nil
+	}
+
+	var services []grpctypes.UserService
+	if err := json.Unmarshal(data, &services); err != nil {
+		glog.Warningf("Hyper: corrupt service snapshot of namespace %s: %v", namespace, err)
+		return nil
+	}
+
+	return services
+}
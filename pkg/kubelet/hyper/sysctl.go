@@ -0,0 +1,56 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyper
+
+import (
+	"fmt"
+	"strings"
+
+	"k8s.io/kubernetes/pkg/api"
+)
+
+// Annotation listing kernel parameters applied inside the pod's VM at boot,
+// as comma-separated key=value pairs, e.g.
+// "net.core.somaxconn=1024,kernel.shm_rmid_forced=1". Each pod has its own
+// kernel, so even parameters considered unsafe on shared-kernel runtimes
+// affect only this pod.
+const sysctlsAnnotation = "hyper.sh/sysctls"
+
+// podSysctls parses the sysctl annotation of a pod. A malformed annotation
+// is an error: silently booting without the requested parameters could break
+// the workload in subtle ways.
+func podSysctls(pod *api.Pod) (map[string]string, error) {
+	value, ok := pod.Annotations[sysctlsAnnotation]
+	if !ok || value == "" {
+		return nil, nil
+	}
+
+	sysctls := make(map[string]string)
+	for _, pair := range strings.Split(value, ",") {
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, fmt.Errorf("malformed sysctl %q in annotation %s, expected key=value", pair, sysctlsAnnotation)
+		}
+		name := strings.TrimSpace(parts[0])
+		if strings.ContainsAny(name, " \t/") {
+			return nil, fmt.Errorf("invalid sysctl name %q in annotation %s", name, sysctlsAnnotation)
+		}
+		sysctls[name] = strings.TrimSpace(parts[1])
+	}
+
+	return sysctls, nil
+}
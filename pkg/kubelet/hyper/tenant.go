@@ -0,0 +1,105 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyper
+
+import (
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+// Keystone tenant propagation. In hypernetes a namespace is bound to a
+// network, and the network carries the Keystone project (tenant) that owns
+// it. Stamping that tenant on the hyper pod lets per-tenant network and
+// storage backends select themselves from the pod alone, without a round
+// trip back to the API server.
+
+// Label carrying the Keystone tenant of the pod's namespace on the hyper
+// pod spec.
+const tenantIDLabel = "sh.hyper.tenant-id"
+
+// How long a resolved namespace-to-tenant binding may be reused. The binding
+// changes only when a namespace is rebound to another network, which is rare
+// enough that two API calls per pod start are not worth it.
+const tenantCacheTTL = 5 * time.Minute
+
+type tenantCacheEntry struct {
+	tenantID   string
+	resolvedAt time.Time
+}
+
+// tenantCache remembers resolved namespace tenants. The zero value is ready
+// to use.
+type tenantCache struct {
+	sync.Mutex
+	entries map[string]tenantCacheEntry
+}
+
+func (tc *tenantCache) get(namespace string) (string, bool) {
+	tc.Lock()
+	defer tc.Unlock()
+
+	entry, ok := tc.entries[namespace]
+	if !ok || time.Since(entry.resolvedAt) > tenantCacheTTL {
+		return "", false
+	}
+	return entry.tenantID, true
+}
+
+func (tc *tenantCache) put(namespace, tenantID string) {
+	tc.Lock()
+	defer tc.Unlock()
+
+	if tc.entries == nil {
+		tc.entries = make(map[string]tenantCacheEntry)
+	}
+	tc.entries[namespace] = tenantCacheEntry{tenantID: tenantID, resolvedAt: time.Now()}
+}
+
+// tenantIDForNamespace resolves the Keystone tenant of a namespace through
+// its network binding. Namespaces without a network — and kubelets running
+// without an API server — have no tenant, which is returned as the empty
+// string rather than an error so single-tenant clusters are unaffected.
+func (r *runtime) tenantIDForNamespace(namespace string) string {
+	if r.kubeClient == nil {
+		return ""
+	}
+
+	if tenantID, ok := r.tenants.get(namespace); ok {
+		return tenantID
+	}
+
+	ns, err := r.kubeClient.Core().Namespaces().Get(namespace)
+	if err != nil {
+		glog.Warningf("Hyper: couldn't get namespace %s for tenant resolution: %v", namespace, err)
+		return ""
+	}
+	if ns.Spec.Network == "" {
+		r.tenants.put(namespace, "")
+		return ""
+	}
+
+	network, err := r.kubeClient.Core().Networks().Get(ns.Spec.Network)
+	if err != nil {
+		glog.Warningf("Hyper: couldn't get network %s of namespace %s for tenant resolution: %v", ns.Spec.Network, namespace, err)
+		return ""
+	}
+
+	r.tenants.put(namespace, network.Spec.TenantID)
+	return network.Spec.TenantID
+}
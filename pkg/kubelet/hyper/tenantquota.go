@@ -0,0 +1,173 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyper
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/prometheus/client_golang/prometheus"
+
+	grpctypes "k8s.io/kubernetes/pkg/kubelet/hyper/types"
+	"k8s.io/kubernetes/pkg/util/wait"
+)
+
+// Per-tenant accounting of the VM envelopes actually allocated on this node.
+// API-level ResourceQuota counts requested container resources; a VM pod
+// reserves its whole envelope at boot, so a node can be exhausted by one
+// tenant well before quota notices. The aggregation below makes that visible
+// per tenant and, when node-level caps are configured, refuses to boot VMs
+// past them.
+
+// How often per-tenant allocations are re-aggregated and exported.
+const tenantAccountingInterval = time.Minute
+
+// Pods without a resolved tenant are accounted under this name.
+const unattributedTenant = "unattributed"
+
+var (
+	tenantVCPUAllocated = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Subsystem: "hyper",
+			Name:      "tenant_vcpu_allocated",
+			Help:      "VM vCPUs allocated on this node per Keystone tenant.",
+		},
+		[]string{"tenant"},
+	)
+	tenantMemoryAllocated = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Subsystem: "hyper",
+			Name:      "tenant_memory_allocated_megabytes",
+			Help:      "VM memory in megabytes allocated on this node per Keystone tenant.",
+		},
+		[]string{"tenant"},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(tenantVCPUAllocated)
+	prometheus.MustRegister(tenantMemoryAllocated)
+}
+
+// tenantAllocation is the allocated VM envelope sum of one tenant.
+type tenantAllocation struct {
+	VCPU     int
+	MemoryMB int
+}
+
+// tenantAllocations aggregates the VM envelopes of pods whose VM currently
+// exists, keyed by the tenant label stamped at creation.
+func (r *runtime) tenantAllocations() (map[string]tenantAllocation, error) {
+	podInfos, err := r.hyperClient.ListPods()
+	if err != nil {
+		return nil, err
+	}
+
+	allocations := make(map[string]tenantAllocation)
+	for _, podInfo := range podInfos {
+		// Failed and succeeded pods no longer hold a VM.
+		if podInfo.Status != StatusRunning && podInfo.Status != StatusPending {
+			continue
+		}
+
+		tenant := podInfo.PodInfo.Spec.Labels[tenantIDLabel]
+		if tenant == "" {
+			tenant = unattributedTenant
+		}
+		allocation := allocations[tenant]
+		allocation.VCPU += int(podInfo.PodInfo.Spec.Vcpu)
+		allocation.MemoryMB += int(podInfo.PodInfo.Spec.Memory)
+		allocations[tenant] = allocation
+	}
+	return allocations, nil
+}
+
+// startTenantAccountingMonitor periodically exports per-tenant allocations.
+func (r *runtime) startTenantAccountingMonitor() {
+	go wait.Until(r.publishTenantAllocations, tenantAccountingInterval, wait.NeverStop)
+}
+
+// publishTenantAllocations exports the current per-tenant allocations and
+// drops the metric series of tenants no longer present on the node.
+func (r *runtime) publishTenantAllocations() {
+	allocations, err := r.tenantAllocations()
+	if err != nil {
+		glog.Warningf("Hyper: tenant accounting: %v", err)
+		return
+	}
+
+	r.quotaLock.Lock()
+	defer r.quotaLock.Unlock()
+
+	for tenant, allocation := range allocations {
+		tenantVCPUAllocated.WithLabelValues(tenant).Set(float64(allocation.VCPU))
+		tenantMemoryAllocated.WithLabelValues(tenant).Set(float64(allocation.MemoryMB))
+	}
+	for tenant := range r.exportedTenants {
+		if _, ok := allocations[tenant]; !ok {
+			tenantVCPUAllocated.DeleteLabelValues(tenant)
+			tenantMemoryAllocated.DeleteLabelValues(tenant)
+		}
+	}
+
+	r.exportedTenants = make(map[string]bool, len(allocations))
+	for tenant := range allocations {
+		r.exportedTenants[tenant] = true
+	}
+}
+
+// checkTenantQuota refuses a pod spec whose VM envelope would push its
+// tenant past the configured node-level caps. With no caps configured, and
+// for pods without a tenant, this is a no-op; unattributed pods cannot be
+// held against anyone fairly.
+func (r *runtime) checkTenantQuota(podSpec *grpctypes.UserPod) error {
+	config := r.configManager.getConfig()
+	if config.TenantVCPULimit == 0 && config.TenantMemoryMBLimit == 0 {
+		return nil
+	}
+
+	tenant := podSpec.Labels[tenantIDLabel]
+	if tenant == "" {
+		return nil
+	}
+
+	allocations, err := r.tenantAllocations()
+	if err != nil {
+		// Fail open: a hyperd hiccup must not turn the quota check into a
+		// scheduling outage.
+		glog.Warningf("Hyper: tenant quota check skipped for %s: %v", podSpec.Id, err)
+		return nil
+	}
+
+	allocation := allocations[tenant]
+	var vcpu, memoryMB int
+	if podSpec.Resource != nil {
+		vcpu = int(podSpec.Resource.Vcpu)
+		memoryMB = int(podSpec.Resource.Memory)
+	}
+
+	if limit := config.TenantVCPULimit; limit > 0 && allocation.VCPU+vcpu > limit {
+		return fmt.Errorf("Hyper: tenant %s would exceed its node vCPU cap (%d allocated + %d requested > %d)",
+			tenant, allocation.VCPU, vcpu, limit)
+	}
+	if limit := config.TenantMemoryMBLimit; limit > 0 && allocation.MemoryMB+memoryMB > limit {
+		return fmt.Errorf("Hyper: tenant %s would exceed its node memory cap (%dMiB allocated + %dMiB requested > %dMiB)",
+			tenant, allocation.MemoryMB, memoryMB, limit)
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyper
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/golang/glog"
+
+	"k8s.io/kubernetes/pkg/api"
+	kubecontainer "k8s.io/kubernetes/pkg/kubelet/container"
+)
+
+const (
+	// Annotations of the termination notice: how long before the VM is
+	// destroyed the notice file appears in the containers, and where.
+	terminationNoticeSecondsAnnotation = "hyper.sh/termination-notice-seconds"
+	terminationNoticePathAnnotation    = "hyper.sh/termination-notice-path"
+
+	defaultTerminationNoticePath = "/var/run/pod-termination-notice"
+
+	// Upper bound of the notice period; a node drain must not be stalled
+	// indefinitely by a single pod's annotation.
+	maxTerminationNoticeSeconds = 300
+
+	reasonTerminationNotice = "TerminationNotice"
+)
+
+// deliverTerminationNotice creates the notice file in every running container
+// of a pod and waits the annotated period before returning, giving stateful
+// applications time to hand off work beyond the in-guest signal handling of
+// the standard grace period. Pods without the annotation are unaffected.
+func (r *runtime) deliverTerminationNotice(pod *api.Pod, runningPod kubecontainer.Pod, gracePeriodOverride *int64) {
+	value, ok := pod.Annotations[terminationNoticeSecondsAnnotation]
+	if !ok {
+		return
+	}
+	seconds, err := strconv.Atoi(value)
+	if err != nil || seconds <= 0 {
+		glog.Warningf("Hyper: ignoring invalid %s annotation %q of pod %s/%s", terminationNoticeSecondsAnnotation, value, pod.Namespace, pod.Name)
+		return
+	}
+	if seconds > maxTerminationNoticeSeconds {
+		seconds = maxTerminationNoticeSeconds
+	}
+
+	// The notice must not outlive the grace the pod actually has: an
+	// eviction or drain with a short grace period proceeds to the kill
+	// instead of waiting out the annotation.
+	grace := int64(-1)
+	switch {
+	case gracePeriodOverride != nil:
+		grace = *gracePeriodOverride
+	case pod.DeletionGracePeriodSeconds != nil:
+		grace = *pod.DeletionGracePeriodSeconds
+	case pod.Spec.TerminationGracePeriodSeconds != nil:
+		grace = *pod.Spec.TerminationGracePeriodSeconds
+	}
+	if grace >= 0 && int64(seconds) > grace {
+		seconds = int(grace)
+	}
+	if seconds <= 0 {
+		return
+	}
+
+	noticePath := pod.Annotations[terminationNoticePathAnnotation]
+	if noticePath == "" {
+		noticePath = defaultTerminationNoticePath
+	}
+
+	delivered := 0
+	for _, c := range runningPod.Containers {
+		_, _, exitCode, err := r.hyperClient.ExecSync(c.ID.ID,
+			[]string{"sh", "-c", fmt.Sprintf(": > %s", noticePath)}, defaultProbeExecTimeout)
+		if err != nil || exitCode != 0 {
+			glog.V(2).Infof("Hyper: cannot deliver termination notice to container %s of pod %s: %v (exit code %d)", c.Name, pod.Name, err, exitCode)
+			continue
+		}
+		delivered++
+	}
+	if delivered == 0 {
+		return
+	}
+
+	r.recorder.Eventf(pod, api.EventTypeNormal, reasonTerminationNotice,
+		"Termination notice written to %s, the pod will be stopped in %ds", noticePath, seconds)
+	glog.V(2).Infof("Hyper: termination notice delivered to pod %s/%s, waiting %ds before stopping it", pod.Namespace, pod.Name, seconds)
+	time.Sleep(time.Duration(seconds) * time.Second)
+}
@@ -0,0 +1,80 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyper
+
+import (
+	"sync"
+
+	"github.com/golang/glog"
+)
+
+// vmBootGate limits how many VMs boot at the same time. Booting a VM costs a
+// burst of memory and IO before any cgroup limit applies; a node rebooting
+// with dozens of pods would otherwise OOM itself before the first pod is up.
+// Kills always have priority over boots: under pressure, freeing resources
+// must not queue behind claiming them.
+type vmBootGate struct {
+	mu           sync.Mutex
+	cond         *sync.Cond
+	booting      int
+	killsPending int
+}
+
+// enterBoot blocks until a boot slot is free and no kill is waiting. A limit
+// of zero or less means unlimited; the limit is read per call, so the
+// configuration stays hot-reloadable.
+func (g *vmBootGate) enterBoot(limit int) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.cond == nil {
+		g.cond = sync.NewCond(&g.mu)
+	}
+
+	for g.killsPending > 0 || (limit > 0 && g.booting >= limit) {
+		glog.V(4).Infof("Hyper: boot gate: waiting (%d booting, %d kills pending, limit %d)", g.booting, g.killsPending, limit)
+		g.cond.Wait()
+	}
+	g.booting++
+}
+
+// exitBoot releases a boot slot.
+func (g *vmBootGate) exitBoot() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.booting--
+	if g.cond != nil {
+		g.cond.Broadcast()
+	}
+}
+
+// enterKill registers a kill in progress, making queued boots yield.
+func (g *vmBootGate) enterKill() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.cond == nil {
+		g.cond = sync.NewCond(&g.mu)
+	}
+	g.killsPending++
+}
+
+// exitKill unregisters a kill and wakes queued boots.
+func (g *vmBootGate) exitKill() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.killsPending--
+	g.cond.Broadcast()
+}
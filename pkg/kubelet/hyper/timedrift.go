@@ -0,0 +1,164 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyper
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"k8s.io/kubernetes/pkg/api"
+	kubecontainer "k8s.io/kubernetes/pkg/kubelet/container"
+	"k8s.io/kubernetes/pkg/types"
+	"k8s.io/kubernetes/pkg/util/wait"
+)
+
+const (
+	// How often the guest clocks are compared against the host clock.
+	clockDriftCheckInterval = 5 * time.Minute
+
+	// Drift beyond this threshold is surfaced as a pod event; silent clock
+	// drift in VMs breaks token validation and distributed locks.
+	clockDriftEventThreshold = time.Second
+)
+
+var podClockDrift = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Subsystem: "hyper",
+		Name:      "pod_clock_drift_seconds",
+		Help:      "Clock drift between the host and the pod VM guest in seconds; positive means the guest is ahead.",
+	},
+	[]string{"pod"},
+)
+
+func init() {
+	prometheus.MustRegister(podClockDrift)
+}
+
+// startClockDriftMonitor periodically measures the clock drift of every
+// running pod VM against the host.
+func (r *runtime) startClockDriftMonitor() {
+	go wait.Until(r.measureClockDrift, clockDriftCheckInterval, wait.NeverStop)
+}
+
+// measureClockDrift reads the guest clock of each running pod through an exec
+// session and compares it with the host clock, compensating for the session
+// round-trip. The drift is exported as a per-pod metric and, above the
+// threshold, as a warning event.
+func (r *runtime) measureClockDrift() {
+	podInfos, err := r.hyperClient.ListPods()
+	if err != nil {
+		glog.Warningf("Hyper: clock drift monitor: ListPods failed: %v", err)
+		return
+	}
+
+	seen := make(map[string]bool, len(podInfos))
+	for _, podInfo := range podInfos {
+		if podInfo.Status != StatusRunning {
+			continue
+		}
+
+		var containerID string
+		for _, c := range podInfo.PodInfo.Status.ContainerStatus {
+			if c.Phase == StatusRunning {
+				containerID = c.ContainerID
+				break
+			}
+		}
+		if containerID == "" {
+			continue
+		}
+
+		before := time.Now()
+		output, err := r.RunInContainer(kubecontainer.ContainerID{Type: typeHyper, ID: containerID}, []string{"date", "+%s.%N"})
+		roundTrip := time.Since(before)
+		if err != nil {
+			glog.V(4).Infof("Hyper: clock drift monitor: cannot read guest clock of pod %s: %v", podInfo.PodName, err)
+			continue
+		}
+
+		guestSeconds, err := strconv.ParseFloat(strings.TrimSpace(string(output)), 64)
+		if err != nil {
+			glog.V(4).Infof("Hyper: clock drift monitor: unexpected guest clock output %q from pod %s", output, podInfo.PodName)
+			continue
+		}
+
+		// The guest read the clock roughly in the middle of the round-trip.
+		hostSeconds := float64(before.Add(roundTrip/2).UnixNano()) / float64(time.Second)
+		drift := guestSeconds - hostSeconds
+
+		podClockDrift.WithLabelValues(podInfo.PodName).Set(drift)
+		seen[podInfo.PodName] = true
+
+		if driftDuration := time.Duration(drift * float64(time.Second)); driftDuration > clockDriftEventThreshold || driftDuration < -clockDriftEventThreshold {
+			podName, podNamespace, err := kubecontainer.ParsePodFullName(podInfo.PodName)
+			if err != nil {
+				continue
+			}
+			pod := &api.Pod{ObjectMeta: api.ObjectMeta{
+				Name:      podName,
+				Namespace: podNamespace,
+				UID:       types.UID(podInfo.PodInfo.Spec.Labels[KEY_API_POD_UID]),
+			}}
+			r.recorder.Eventf(pod, api.EventTypeWarning, "ClockDrift",
+				"Guest clock of pod %s drifts %.3fs from the host clock", podInfo.PodName, drift)
+
+			// Above the configured sync limit, correct the guest instead of
+			// only reporting: drifting clocks break log timestamps and TLS.
+			maxDrift := time.Duration(r.configManager.getConfig().ClockSyncMaxDriftSeconds) * time.Second
+			if maxDrift > 0 && (driftDuration > maxDrift || driftDuration < -maxDrift) {
+				if err := r.syncGuestClock(containerID); err != nil {
+					glog.Warningf("Hyper: cannot synchronize guest clock of pod %s: %v", podInfo.PodName, err)
+					continue
+				}
+				r.recorder.Eventf(pod, api.EventTypeNormal, "ClockSynchronized",
+					"Guest clock of pod %s stepped back to the host clock after drifting %.3fs", podInfo.PodName, drift)
+			}
+		}
+	}
+
+	// Drop metrics of pods that no longer run, so dashboards do not show
+	// stale drift values.
+	r.driftLock.Lock()
+	for podName := range r.driftPods {
+		if !seen[podName] {
+			podClockDrift.DeleteLabelValues(podName)
+		}
+	}
+	r.driftPods = seen
+	r.driftLock.Unlock()
+}
+
+// syncGuestClock steps a guest's clock back to the host clock through an exec
+// session, switching it to kvm-clock first so the correction sticks. The
+// paravirtual clocksource follows the host without NTP in the guest; guests
+// on TSC keep drifting.
+func (r *runtime) syncGuestClock(containerID string) error {
+	script := fmt.Sprintf(
+		"cs=/sys/devices/system/clocksource/clocksource0; "+
+			"grep -q kvm-clock $cs/available_clocksource 2>/dev/null && echo kvm-clock > $cs/current_clocksource; "+
+			"date -s @%.9f", float64(time.Now().UnixNano())/float64(time.Second))
+	output, err := r.RunInContainer(kubecontainer.ContainerID{Type: typeHyper, ID: containerID}, []string{"sh", "-c", script})
+	if err != nil {
+		return fmt.Errorf("%v: %s", err, string(output))
+	}
+	return nil
+}
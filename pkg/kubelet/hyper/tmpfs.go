@@ -0,0 +1,68 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyper
+
+import (
+	"k8s.io/kubernetes/pkg/api"
+)
+
+const (
+	// Size of a memory-backed volume can be set per volume with an
+	// annotation like "tmpfs-size.hyper.sh/scratch: 256M".
+	tmpfsSizeAnnotationPrefix = "tmpfs-size.hyper.sh/"
+
+	// Default size of a memory-backed volume inside the guest.
+	defaultTmpfsSize = "64M"
+
+	// The pod's /dev/shm can be resized with an annotation like
+	// "hyper.sh/shm-size: 1G"; the guest default of 64M is too small for
+	// databases and browsers.
+	shmSizeAnnotation = "hyper.sh/shm-size"
+
+	// Name of the synthetic pod volume backing a resized /dev/shm.
+	shmVolumeName = "k8s-pod-shm"
+)
+
+// podShmSize returns the annotated /dev/shm size of a pod, or "" to keep the
+// guest default.
+func podShmSize(pod *api.Pod) string {
+	return pod.Annotations[shmSizeAnnotation]
+}
+
+// podTmpfsVolumes returns the pod's memory-backed emptyDir volumes mapped
+// to their tmpfs size. These volumes are created as tmpfs inside the guest
+// rather than shared from the host, giving apps fast scratch space without
+// touching VM disks.
+func podTmpfsVolumes(pod *api.Pod) map[string]string {
+	var volumes map[string]string
+	for _, volume := range pod.Spec.Volumes {
+		if volume.EmptyDir == nil || volume.EmptyDir.Medium != api.StorageMediumMemory {
+			continue
+		}
+
+		size := defaultTmpfsSize
+		if value, found := pod.Annotations[tmpfsSizeAnnotationPrefix+volume.Name]; found {
+			size = value
+		}
+
+		if volumes == nil {
+			volumes = make(map[string]string)
+		}
+		volumes[volume.Name] = size
+	}
+	return volumes
+}
@@ -0,0 +1,52 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package translate previews the hyperd pod spec the hyper runtime would
+// create an API pod with. The translation is exactly the one RunPod uses,
+// but without side effects: no image pulls, no checkpoint writes, no events.
+// It exists so tooling and tests can validate how a pod maps onto a VM pod
+// before (or without) running it.
+package translate
+
+import (
+	"fmt"
+
+	"k8s.io/kubernetes/pkg/api"
+	"k8s.io/kubernetes/pkg/kubelet/hyper"
+)
+
+// DryRun renders the hyperd spec JSON of a pod offline. The node's hyper
+// runtime configuration is honored, but neither hyperd nor the API server is
+// contacted; kubelet-supplied per-pod data (volumes, DNS, cluster services)
+// renders as empty.
+func DryRun(pod *api.Pod) ([]byte, error) {
+	translator, err := hyper.NewPodTranslator()
+	if err != nil {
+		return nil, err
+	}
+	return translator.TranslatePod(pod)
+}
+
+// DryRunWith renders the hyperd spec JSON of a pod through an existing
+// runtime — e.g. the kubelet's — so the preview includes that runtime's
+// volume, DNS and service view. The runtime must be a hyper runtime.
+func DryRunWith(runtime interface{}, pod *api.Pod) ([]byte, error) {
+	translator, ok := runtime.(hyper.PodTranslator)
+	if !ok {
+		return nil, fmt.Errorf("runtime %T cannot translate hyper pod specs", runtime)
+	}
+	return translator.TranslatePod(pod)
+}
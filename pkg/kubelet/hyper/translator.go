@@ -0,0 +1,54 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyper
+
+import (
+	"k8s.io/kubernetes/pkg/api"
+	"k8s.io/kubernetes/pkg/client/record"
+)
+
+// PodTranslator renders the hyperd pod spec of an API pod without side
+// effects. The hyper runtime implements it, so tooling holding a
+// kubecontainer.Runtime can type-assert its way to a preview; for offline
+// use NewPodTranslator builds one without contacting hyperd.
+type PodTranslator interface {
+	TranslatePod(pod *api.Pod) ([]byte, error)
+}
+
+// TranslatePod returns the hyperd spec JSON that RunPod would create the pod
+// with, as of restart count zero. Nothing is pulled, written or recorded.
+func (r *runtime) TranslatePod(pod *api.Pod) ([]byte, error) {
+	return r.buildHyperPodSpec(pod, 0, true)
+}
+
+// NewPodTranslator returns an offline PodTranslator. It reads the node's
+// runtime configuration like the full runtime, but never dials hyperd or the
+// API server; per-pod kubelet data (volumes, DNS, cluster services) is
+// rendered as empty, matching a standalone runtime without a kubelet.
+func NewPodTranslator() (PodTranslator, error) {
+	configManager, err := newConfigManager(hyperRuntimeConfigFile)
+	if err != nil {
+		return nil, err
+	}
+
+	return &runtime{
+		runtimeHelper: &standaloneRuntimeHelper{},
+		recorder:      &record.FakeRecorder{},
+		configManager: configManager,
+		numaAllocator: newNUMAAllocator(),
+	}, nil
+}
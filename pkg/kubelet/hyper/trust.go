@@ -0,0 +1,66 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyper
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/golang/glog"
+)
+
+// Trust bundles are projected into every container of the pod under this
+// directory, which the common distributions include in their trust store
+// lookup path.
+const guestTrustStoreDir = "/etc/ssl/certs"
+
+// guestTrustFiles renders the operator-configured CA bundles (cluster CA
+// and any custom bundles) as hyper spec file entries. The first return
+// value holds the pod-level file definitions (base64 content), the second
+// the per-container references mounting them into the guest trust store.
+// In-pod TLS clients then trust internal services without per-image
+// customization.
+func (r *runtime) guestTrustFiles() ([]map[string]interface{}, []map[string]interface{}) {
+	bundles := r.configManager.getConfig().GuestCABundles
+	if len(bundles) == 0 {
+		return nil, nil
+	}
+
+	var podFiles, containerFiles []map[string]interface{}
+	for i, bundle := range bundles {
+		data, err := ioutil.ReadFile(bundle)
+		if err != nil {
+			glog.Warningf("Hyper: cannot read guest CA bundle %s: %v", bundle, err)
+			continue
+		}
+
+		name := fmt.Sprintf("trust-bundle-%d", i)
+		podFiles = append(podFiles, map[string]interface{}{
+			KEY_NAME:     name,
+			KEY_ENCODING: "base64",
+			KEY_CONTENT:  base64.StdEncoding.EncodeToString(data),
+		})
+		containerFiles = append(containerFiles, map[string]interface{}{
+			KEY_FILENAME:  name,
+			KEY_MOUNTPATH: fmt.Sprintf("%s/hypernetes-ca-%d.pem", guestTrustStoreDir, i),
+			KEY_PERM:      "0644",
+		})
+	}
+
+	return podFiles, containerFiles
+}
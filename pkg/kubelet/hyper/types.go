@@ -18,6 +18,8 @@ package hyper
 
 import (
 	"io"
+	"time"
+
 	grpctypes "k8s.io/kubernetes/pkg/kubelet/hyper/types"
 )
 
@@ -61,6 +63,9 @@ type ExecInContainerOptions struct {
 	ErrorStream  io.Writer
 	Commands     []string
 	TTY          bool
+	// Timeout cancels the exec session after the given duration; zero
+	// means no deadline.
+	Timeout time.Duration
 }
 
 type HyperImage struct {
@@ -69,6 +74,7 @@ type HyperImage struct {
 	imageID     string
 	createdAt   int64
 	virtualSize int64
+	repoDigests []string
 }
 
 type HyperPod struct {
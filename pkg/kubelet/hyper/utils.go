@@ -17,9 +17,14 @@ limitations under the License.
 package hyper
 
 import (
-	"golang.org/x/net/context"
+	"fmt"
 	"io"
+	"strings"
 	"time"
+
+	"golang.org/x/net/context"
+
+	"k8s.io/kubernetes/pkg/api"
 )
 
 type nopCloser struct {
@@ -49,3 +54,18 @@ func getContextWithTimeout(timeout time.Duration) (context.Context, context.Canc
 func getContextWithCancel() (context.Context, context.CancelFunc) {
 	return context.WithCancel(context.Background())
 }
+
+// normalizePortProtocol maps a port mapping protocol to the lowercase form
+// hyperd expects. An empty protocol defaults to tcp like the API does;
+// anything but TCP and UDP is rejected.
+func normalizePortProtocol(protocol api.Protocol) (string, error) {
+	switch strings.ToLower(string(protocol)) {
+	case "":
+		return "tcp", nil
+	case "tcp":
+		return "tcp", nil
+	case "udp":
+		return "udp", nil
+	}
+	return "", fmt.Errorf("unsupported protocol %q, hyperd supports TCP and UDP", protocol)
+}
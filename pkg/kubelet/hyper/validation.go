@@ -0,0 +1,110 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyper
+
+import (
+	"fmt"
+	"strings"
+
+	"k8s.io/kubernetes/pkg/api"
+)
+
+// Event emitted when a pod uses spec fields the hyper runtime ignores.
+const reasonUnsupportedPodFields = "UnsupportedPodFields"
+
+// unsupportedPodFields returns the spec fields of a pod that the hyper
+// runtime silently ignores: host namespaces do not exist for a VM pod,
+// SELinux and user switching are not implemented by the guest agent, and
+// volume subpaths are not expressible in the hyperd volume model. Privileged
+// mode and capabilities are handled separately by
+// validatePodSecurityContext, which rejects rather than ignores them.
+func unsupportedPodFields(pod *api.Pod) []string {
+	var fields []string
+
+	if sc := pod.Spec.SecurityContext; sc != nil {
+		if sc.HostNetwork {
+			fields = append(fields, "spec.securityContext.hostNetwork")
+		}
+		if sc.HostPID {
+			fields = append(fields, "spec.securityContext.hostPID")
+		}
+		if sc.HostIPC {
+			fields = append(fields, "spec.securityContext.hostIPC")
+		}
+		if sc.SELinuxOptions != nil {
+			fields = append(fields, "spec.securityContext.seLinuxOptions")
+		}
+		if sc.RunAsUser != nil {
+			fields = append(fields, "spec.securityContext.runAsUser")
+		}
+		if sc.RunAsNonRoot != nil && *sc.RunAsNonRoot {
+			fields = append(fields, "spec.securityContext.runAsNonRoot")
+		}
+		if len(sc.SupplementalGroups) > 0 {
+			fields = append(fields, "spec.securityContext.supplementalGroups")
+		}
+		if sc.FSGroup != nil {
+			fields = append(fields, "spec.securityContext.fsGroup")
+		}
+	}
+
+	for _, container := range pod.Spec.Containers {
+		prefix := fmt.Sprintf("spec.containers{%s}", container.Name)
+
+		if sc := container.SecurityContext; sc != nil {
+			if sc.SELinuxOptions != nil {
+				fields = append(fields, prefix+".securityContext.seLinuxOptions")
+			}
+			if sc.RunAsUser != nil {
+				fields = append(fields, prefix+".securityContext.runAsUser")
+			}
+			if sc.RunAsNonRoot != nil && *sc.RunAsNonRoot {
+				fields = append(fields, prefix+".securityContext.runAsNonRoot")
+			}
+			if sc.ReadOnlyRootFilesystem != nil && *sc.ReadOnlyRootFilesystem {
+				fields = append(fields, prefix+".securityContext.readOnlyRootFilesystem")
+			}
+		}
+
+		for _, mount := range container.VolumeMounts {
+			if mount.SubPath != "" {
+				fields = append(fields, fmt.Sprintf("%s.volumeMounts{%s}.subPath", prefix, mount.Name))
+			}
+		}
+	}
+
+	return fields
+}
+
+// validateUnsupportedFields surfaces spec fields the runtime would silently
+// ignore. By default the pod runs and a warning event lists the ignored
+// fields; with strictFieldValidation the pod is failed instead, so clusters
+// can refuse workloads that would not get what they asked for.
+func (r *runtime) validateUnsupportedFields(pod *api.Pod) error {
+	fields := unsupportedPodFields(pod)
+	if len(fields) == 0 {
+		return nil
+	}
+
+	if r.configManager.getConfig().StrictFieldValidation {
+		return fmt.Errorf("pod uses fields the hyper runtime cannot honor: %s", strings.Join(fields, ", "))
+	}
+
+	r.recorder.Eventf(pod, api.EventTypeWarning, reasonUnsupportedPodFields,
+		"The hyper runtime ignores: %s", strings.Join(fields, ", "))
+	return nil
+}
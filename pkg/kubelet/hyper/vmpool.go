@@ -0,0 +1,154 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyper
+
+import (
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"k8s.io/kubernetes/pkg/util/wait"
+)
+
+// VM template pool. Booting a fresh VM dominates pod cold-start latency;
+// hyperd associates a newly created pod with a standby VM of matching size
+// when one exists, so keeping a few idle template VMs booted cuts startup to
+// the container-attach time. The pool holds VMs of the default container
+// size, so only pods without explicit resource limits hit it.
+
+// How often the pool is reconciled to its configured size.
+const vmPoolReconcileInterval = 30 * time.Second
+
+var (
+	vmPoolIdle = prometheus.NewGauge(prometheus.GaugeOpts{
+		Subsystem: "hyper",
+		Name:      "vm_pool_idle",
+		Help:      "Number of pre-booted standby VMs currently idle in the pool.",
+	})
+	vmPoolHits = prometheus.NewCounter(prometheus.CounterOpts{
+		Subsystem: "hyper",
+		Name:      "vm_pool_hits_total",
+		Help:      "Pod starts served by a pre-booted VM from the pool.",
+	})
+	vmPoolMisses = prometheus.NewCounter(prometheus.CounterOpts{
+		Subsystem: "hyper",
+		Name:      "vm_pool_misses_total",
+		Help:      "Pod starts that had to boot a fresh VM while the pool was enabled.",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(vmPoolIdle)
+	prometheus.MustRegister(vmPoolHits)
+	prometheus.MustRegister(vmPoolMisses)
+}
+
+// vmPoolState tracks the standby VMs this kubelet booted, so consumed ones
+// can be told apart from VMs removed by the reconciler itself.
+type vmPoolState struct {
+	sync.Mutex
+	idle map[string]bool
+}
+
+// idleCount returns the number of standby VMs the pool believes are idle.
+func (s *vmPoolState) idleCount() int {
+	s.Lock()
+	defer s.Unlock()
+	return len(s.idle)
+}
+
+// startVMPool keeps the configured number of template VMs pre-booted.
+func (r *runtime) startVMPool() {
+	go wait.Until(r.reconcileVMPool, vmPoolReconcileInterval, wait.NeverStop)
+}
+
+// reconcileVMPool boots or removes standby VMs until the idle count matches
+// the configured pool size. Only VMs the pool booted itself are considered:
+// idle VMs created outside the kubelet (e.g. by an operator via the CLI) are
+// neither counted nor removed. Pool VMs that disappeared since the last pass
+// were claimed by pod creates and count as pool hits.
+func (r *runtime) reconcileVMPool() {
+	if err := r.checkReadOnly("reconcile VM pool"); err != nil {
+		return
+	}
+
+	config := r.configManager.getConfig()
+	poolSize := config.VMPoolSize
+
+	vms, err := r.hyperClient.ListVMs()
+	if err != nil {
+		glog.Warningf("Hyper: VM pool: ListVMs failed: %v", err)
+		return
+	}
+
+	present := make(map[string]bool)
+	for _, vm := range vms {
+		if vm.PodID == "" {
+			present[vm.VmID] = true
+		}
+	}
+
+	// Intersect the pool's own VMs with what is still idle on the node.
+	idle := make(map[string]bool)
+	r.vmPool.Lock()
+	for vmID := range r.vmPool.idle {
+		if present[vmID] {
+			idle[vmID] = true
+		} else {
+			// Claimed by a pod create since the last pass.
+			vmPoolHits.Inc()
+		}
+	}
+	r.vmPool.Unlock()
+
+	for len(idle) < poolSize {
+		vmID, err := r.hyperClient.CreateVM(int32(config.DefaultVCPU), int32(config.DefaultMemoryMB))
+		if err != nil {
+			glog.Warningf("Hyper: VM pool: cannot boot standby VM: %v", err)
+			break
+		}
+		glog.V(2).Infof("Hyper: VM pool: booted standby VM %s", vmID)
+		idle[vmID] = true
+	}
+	for vmID := range idle {
+		if len(idle) <= poolSize {
+			break
+		}
+		if err := r.hyperClient.RemoveVM(vmID); err != nil {
+			glog.Warningf("Hyper: VM pool: cannot remove standby VM %s: %v", vmID, err)
+			continue
+		}
+		glog.V(2).Infof("Hyper: VM pool: removed surplus standby VM %s", vmID)
+		delete(idle, vmID)
+	}
+
+	r.vmPool.Lock()
+	r.vmPool.idle = idle
+	r.vmPool.Unlock()
+	vmPoolIdle.Set(float64(len(idle)))
+}
+
+// notePoolMiss counts a pod boot that found the pool empty.
+func (r *runtime) notePoolMiss() {
+	if r.featureEnabled(FeatureVMTemplatePool) && r.configManager.getConfig().VMPoolSize > 0 {
+		if r.vmPool.idleCount() == 0 {
+			vmPoolMisses.Inc()
+		}
+	}
+}
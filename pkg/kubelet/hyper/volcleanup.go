@@ -0,0 +1,84 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyper
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/golang/glog"
+)
+
+// Orphaned volume artifact cleanup. A pod deleted while the node was down —
+// or a kill that died between RemovePod and its deferred teardown — leaves
+// volume state behind: hardened bind mounts under the spec dir and the
+// per-pod directory under hyperLogsDir where hyperd keeps the VM's disks and
+// 9p share state. Both are swept against the live hyperd pod list, at
+// startup and on every GC run.
+
+// cleanupOrphanedVolumeArtifacts removes the volume artifacts of pods that
+// no longer exist in hyperd.
+func (r *runtime) cleanupOrphanedVolumeArtifacts(podInfos []HyperPod) {
+	knownNames := make(map[string]bool, len(podInfos))
+	knownIDs := make(map[string]bool, len(podInfos))
+	for _, podInfo := range podInfos {
+		knownNames[podInfo.PodName] = true
+		knownIDs[podInfo.PodID] = true
+	}
+
+	// Hardened bind mounts are keyed by pod full name.
+	mountsRoot := filepath.Join(r.specDir, hardenedMountsDir)
+	if entries, err := ioutil.ReadDir(mountsRoot); err == nil {
+		for _, entry := range entries {
+			if !entry.IsDir() || knownNames[entry.Name()] {
+				continue
+			}
+			glog.V(2).Infof("Hyper: removing orphaned volume mounts of pod %s", entry.Name())
+			r.cleanupHardenedMounts(entry.Name())
+		}
+	} else if !os.IsNotExist(err) {
+		glog.Warningf("Hyper: cannot read hardened mounts dir %s: %v", mountsRoot, err)
+	}
+
+	// Per-pod VM directories are keyed by hyperd pod ID.
+	if entries, err := ioutil.ReadDir(hyperLogsDir); err == nil {
+		for _, entry := range entries {
+			if !entry.IsDir() || knownIDs[entry.Name()] {
+				continue
+			}
+			podDir := filepath.Join(hyperLogsDir, entry.Name())
+			glog.V(2).Infof("Hyper: removing orphaned VM disk directory %s", podDir)
+			if err := os.RemoveAll(podDir); err != nil {
+				glog.Warningf("Hyper: cannot remove orphaned VM disk directory %s: %v", podDir, err)
+			}
+		}
+	} else if !os.IsNotExist(err) {
+		glog.Warningf("Hyper: cannot read VM disk dir %s: %v", hyperLogsDir, err)
+	}
+}
+
+// sweepOrphanedVolumeArtifacts is the startup sweep: one pass of the cleanup
+// against the current hyperd pod list.
+func (r *runtime) sweepOrphanedVolumeArtifacts() {
+	podInfos, err := r.hyperClient.ListPods()
+	if err != nil {
+		glog.Warningf("Hyper: startup volume sweep: ListPods failed: %v", err)
+		return
+	}
+	r.cleanupOrphanedVolumeArtifacts(podInfos)
+}
@@ -0,0 +1,201 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyper
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/prometheus/client_golang/prometheus"
+
+	kubecontainer "k8s.io/kubernetes/pkg/kubelet/container"
+	"k8s.io/kubernetes/pkg/util/wait"
+)
+
+// Per-volume usage stats. Volumes of a hyper pod are filesystems inside the
+// guest — a host-side du of the share misses block-attached and
+// guest-mounted volumes entirely — so capacity, used and available bytes
+// are measured where the filesystem actually lives, through an in-guest df
+// on the volume's mount path. The results feed the volume stats metrics and
+// PVC usage monitoring.
+
+// How often volume usage is measured.
+const volumeStatsInterval = time.Minute
+
+var (
+	volumeStatsCapacity = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Subsystem: "hyper",
+			Name:      "volume_stats_capacity_bytes",
+			Help:      "Capacity of the volume's filesystem in bytes, measured inside the guest.",
+		},
+		[]string{"pod", "volume"},
+	)
+	volumeStatsUsed = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Subsystem: "hyper",
+			Name:      "volume_stats_used_bytes",
+			Help:      "Used bytes of the volume's filesystem, measured inside the guest.",
+		},
+		[]string{"pod", "volume"},
+	)
+	volumeStatsAvailable = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Subsystem: "hyper",
+			Name:      "volume_stats_available_bytes",
+			Help:      "Available bytes of the volume's filesystem, measured inside the guest.",
+		},
+		[]string{"pod", "volume"},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(volumeStatsCapacity)
+	prometheus.MustRegister(volumeStatsUsed)
+	prometheus.MustRegister(volumeStatsAvailable)
+}
+
+// volumeStats is the measured filesystem state of one volume.
+type volumeStats struct {
+	CapacityBytes  int64 `json:"capacityBytes"`
+	UsedBytes      int64 `json:"usedBytes"`
+	AvailableBytes int64 `json:"availableBytes"`
+}
+
+// startVolumeStatsMonitor periodically measures the volume filesystems of
+// every running pod.
+func (r *runtime) startVolumeStatsMonitor() {
+	go wait.Until(r.measureVolumeStats, volumeStatsInterval, wait.NeverStop)
+}
+
+// measureVolumeStats walks the volume mounts of running pods and exports
+// capacity, used and available bytes per pod and volume, dropping the
+// series of pods that are gone.
+func (r *runtime) measureVolumeStats() {
+	if r.kubeClient == nil {
+		return
+	}
+
+	podInfos, err := r.hyperClient.ListPods()
+	if err != nil {
+		glog.Warningf("Hyper: volume stats monitor: ListPods failed: %v", err)
+		return
+	}
+
+	seen := make(map[string]map[string]bool)
+	for _, podInfo := range podInfos {
+		if podInfo.Status != StatusRunning {
+			continue
+		}
+
+		name, namespace, err := kubecontainer.ParsePodFullName(podInfo.PodName)
+		if err != nil {
+			continue
+		}
+		pod, err := r.kubeClient.Core().Pods(namespace).Get(name)
+		if err != nil {
+			glog.V(4).Infof("Hyper: volume stats monitor: cannot get pod %s: %v", podInfo.PodName, err)
+			continue
+		}
+
+		for _, container := range pod.Spec.Containers {
+			var containerID string
+			for _, c := range podInfo.PodInfo.Status.ContainerStatus {
+				parsedName, _, _, err := r.containerMetadata(c.Name, containerSpecLabels(podInfo.PodInfo.Spec, c.ContainerID))
+				if err == nil && parsedName == container.Name && c.Phase == StatusRunning {
+					containerID = c.ContainerID
+					break
+				}
+			}
+			if containerID == "" {
+				continue
+			}
+
+			for _, mount := range container.VolumeMounts {
+				if seen[podInfo.PodName][mount.Name] {
+					continue
+				}
+				stats, err := r.guestFilesystemStats(containerID, mount.MountPath)
+				if err != nil {
+					glog.V(4).Infof("Hyper: volume stats monitor: cannot measure volume %s of pod %s: %v", mount.Name, podInfo.PodName, err)
+					continue
+				}
+
+				volumeStatsCapacity.WithLabelValues(podInfo.PodName, mount.Name).Set(float64(stats.CapacityBytes))
+				volumeStatsUsed.WithLabelValues(podInfo.PodName, mount.Name).Set(float64(stats.UsedBytes))
+				volumeStatsAvailable.WithLabelValues(podInfo.PodName, mount.Name).Set(float64(stats.AvailableBytes))
+				if seen[podInfo.PodName] == nil {
+					seen[podInfo.PodName] = make(map[string]bool)
+				}
+				seen[podInfo.PodName][mount.Name] = true
+			}
+		}
+	}
+
+	r.volStatsLock.Lock()
+	for podName, volumes := range r.exportedVolStats {
+		for volume := range volumes {
+			if !seen[podName][volume] {
+				volumeStatsCapacity.DeleteLabelValues(podName, volume)
+				volumeStatsUsed.DeleteLabelValues(podName, volume)
+				volumeStatsAvailable.DeleteLabelValues(podName, volume)
+			}
+		}
+	}
+	r.exportedVolStats = seen
+	r.volStatsLock.Unlock()
+}
+
+// guestFilesystemStats measures the filesystem holding a path inside the
+// guest via df, like containerRootfsUsage does for the rootfs.
+func (r *runtime) guestFilesystemStats(containerID, path string) (*volumeStats, error) {
+	output, err := r.RunInContainer(kubecontainer.ContainerID{Type: typeHyper, ID: containerID}, []string{"df", "-kP", path})
+	if err != nil {
+		return nil, err
+	}
+
+	lines := strings.Split(strings.TrimSpace(string(output)), "\n")
+	if len(lines) < 2 {
+		return nil, fmt.Errorf("unexpected df output %q", output)
+	}
+	fields := strings.Fields(lines[len(lines)-1])
+	if len(fields) < 4 {
+		return nil, fmt.Errorf("unexpected df output %q", output)
+	}
+
+	capacityKB, err := strconv.ParseInt(fields[1], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("unexpected df output %q: %v", output, err)
+	}
+	usedKB, err := strconv.ParseInt(fields[2], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("unexpected df output %q: %v", output, err)
+	}
+	availableKB, err := strconv.ParseInt(fields[3], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("unexpected df output %q: %v", output, err)
+	}
+
+	return &volumeStats{
+		CapacityBytes:  capacityKB * 1024,
+		UsedBytes:      usedKB * 1024,
+		AvailableBytes: availableKB * 1024,
+	}, nil
+}
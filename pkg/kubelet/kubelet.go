@@ -403,6 +403,7 @@ func NewMainKubelet(
 	imageBackOff := flowcontrol.NewBackOff(backOffPeriod, MaxContainerBackOff)
 
 	klet.livenessManager = proberesults.NewManager()
+	klet.readinessManager = proberesults.NewManager()
 
 	klet.podCache = kubecontainer.NewCache()
 	klet.podManager = kubepod.NewBasicPodManager(kubepod.NewBasicMirrorClient(klet.kubeClient))
@@ -472,6 +473,7 @@ func NewMainKubelet(
 			klet.networkPlugin,
 			containerRefManager,
 			klet.livenessManager,
+			klet.readinessManager,
 			klet.kubeClient,
 			imageBackOff,
 			serializeImagePulls,
@@ -515,6 +517,7 @@ func NewMainKubelet(
 	klet.probeManager = prober.NewManager(
 		klet.statusManager,
 		klet.livenessManager,
+		klet.readinessManager,
 		klet.runner,
 		containerRefManager,
 		recorder)
@@ -685,6 +688,8 @@ type Kubelet struct {
 	probeManager prober.Manager
 	// Manages container health check results.
 	livenessManager proberesults.Manager
+	// Manages container readiness check results.
+	readinessManager proberesults.Manager
 
 	// How long to keep idle streaming command execution/port forwarding
 	// connections open before terminating them
@@ -94,7 +94,7 @@ var _ proxy.ProxyProvider = &Proxier{}
 
 // NewProxier returns a new Proxier given an pod-buildin-haproxy Interface instance.
 func NewProxier(syncPeriod time.Duration, kubeClient *kubeclient.Client, disableHyperInternalService bool) (*Proxier, error) {
-	client, err := hyper.NewHyperClient()
+	client, err := hyper.NewHyperClient(hyper.HYPER_SERVER)
 	if err != nil {
 		return nil, err
 	}
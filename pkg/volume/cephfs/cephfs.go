@@ -233,8 +233,18 @@ func (cephfsVolume *cephfs) GetPath() string {
 	return cephfsVolume.plugin.host.GetPodVolumeDir(cephfsVolume.podUID, utilstrings.EscapeQualifiedNameForDisk(name), cephfsVolume.volName)
 }
 
+// GetMetaData exposes the resolved mount parameters, including the secret
+// fetched from the API, so VM-based runtimes can mount CephFS from inside
+// the guest instead of sharing a host mount.
 func (cephfsVolume *cephfs) GetMetaData() map[string]interface{} {
-	return nil
+	return map[string]interface{}{
+		"volume_type": "cephfs",
+		"monitors":    cephfsVolume.mon,
+		"path":        cephfsVolume.path,
+		"user":        cephfsVolume.id,
+		"secret":      cephfsVolume.secret,
+		"readonly":    cephfsVolume.readonly,
+	}
 }
 
 func (cephfsVolume *cephfs) cleanup(dir string) error {
@@ -199,6 +199,9 @@ type flexVolumeDisk struct {
 	// secret for the volume.
 	secrets map[string]string
 	plugin  *flexVolumePlugin
+	// devicePath is the block device reported by the driver's attach call,
+	// empty when the driver does not attach a device.
+	devicePath string
 }
 
 // FlexVolumeUnmounter is the disk that will be cleaned by this plugin.
@@ -298,6 +301,7 @@ func (f *flexVolumeMounter) SetUpAt(dir string, fsGroup *int64) error {
 		}
 		// Attach not supported or required. Continue to mount.
 	}
+	f.devicePath = device
 
 	if err := f.manager.mount(f, device, dir); err != nil {
 		if !isCmdNotSupportedErr(err) {
@@ -339,8 +343,18 @@ func (f *flexVolumeDisk) GetPath() string {
 	return f.plugin.host.GetPodVolumeDir(f.podUID, utilstrings.EscapeQualifiedNameForDisk(name), f.volName)
 }
 
+// GetMetaData exposes the block device reported by the driver's attach
+// call, so VM-based runtimes can attach it directly instead of sharing the
+// host mount. Drivers that only materialize a mount return nil and are
+// consumed through GetPath.
 func (f *flexVolumeDisk) GetMetaData() map[string]interface{} {
-	return nil
+	if f.devicePath == "" {
+		return nil
+	}
+	return map[string]interface{}{
+		"volume_type": "flexvolume",
+		"device":      f.devicePath,
+	}
 }
 
 // TearDown simply deletes everything in the directory.